@@ -0,0 +1,175 @@
+/*
+ * admin shows the status of the cluster and hands the master role over or drains a server.
+ * It signs its requests with the key of the cluster like the servers do.
+ *
+ *	go run ./cmd/admin status
+ *	go run ./cmd/admin handover [successor]
+ *	go run ./cmd/admin drain <server>
+ */
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/adapters/webapi"
+	"github.com/kiryu-dev/tic-tac-toe/internal/config"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/kiryu-dev/tic-tac-toe/pkg/nodeauth"
+	"github.com/pkg/errors"
+)
+
+const requestTimeout = 10 * time.Second
+
+type admin interface {
+	ClusterStatus(ctx context.Context, addr string) (*domain.ClusterStatus, error)
+	Handover(ctx context.Context, addr string, req domain.HandoverRequest) (*domain.HandoverResponse, error)
+	Drain(ctx context.Context, addr string) (*domain.HandoverResponse, error)
+}
+
+var (
+	host       string
+	portByHost = make(map[string]string)
+	repo       admin
+)
+
+func main() {
+	cfgPath := flag.String("config", "./conf/config.yml", "path to config")
+	key := flag.String("key", "", "key of the cluster (NODE_AUTH_KEY or the config one if empty)")
+	flag.StringVar(&host, "host", "localhost", "host the ports of the servers from the config are published on")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: admin [flags] status | handover [successor] | drain <server>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	cfg, err := config.New(*cfgPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, serverCfg := range cfg.Servers {
+		portByHost[serverCfg.Host] = strconv.Itoa(serverCfg.Port)
+	}
+	repo = webapi.New(nodeauth.New(cmp.Or(*key, os.Getenv("NODE_AUTH_KEY"), cfg.NodeAuth.Key), "admin",
+		cfg.NodeAuth.MaxSkew))
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	args := flag.Args()
+	switch {
+	case len(args) == 1 && args[0] == "status":
+		err = printStatus(ctx)
+	case len(args) <= 2 && len(args) > 0 && args[0] == "handover":
+		successor := ""
+		if len(args) == 2 {
+			successor = args[1]
+		}
+		err = handover(ctx, successor)
+	case len(args) == 2 && args[0] == "drain":
+		err = drain(ctx, args[1])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printStatus(ctx context.Context) error {
+	status, err := clusterStatus(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Мастер: %s, эпоха: %d\n", cmp.Or(status.Master, "не выбран"), status.Epoch)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "СЕРВЕР\tРОЛЬ\tЭПОХА\tОТСТАВАНИЕ\tИГРЫ\tКЛИЕНТЫ\tСОСТОЯНИЕ")
+	for _, node := range status.Nodes {
+		if node.Error != "" {
+			_, _ = fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\tнедоступен: %s\n", node.Name, node.Error)
+			continue
+		}
+		lag := "-"
+		if node.Lag >= 0 {
+			lag = strconv.FormatInt(node.Lag, 10)
+		}
+		state := "готов"
+		switch {
+		case node.Draining:
+			state = "выводится из работы"
+		case !node.Ready:
+			state = "догоняет мастера"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%d\t%s\n",
+			node.Name, node.Role, node.Epoch, lag, node.LiveGames, node.Clients, state)
+	}
+	return w.Flush()
+}
+
+func handover(ctx context.Context, successor string) error {
+	status, err := clusterStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Master == "" {
+		return errors.New("there is no master to hand the role over")
+	}
+	resp, err := repo.Handover(ctx, serverAddr(status, status.Master), domain.HandoverRequest{Successor: successor})
+	if err != nil {
+		return errors.WithMessagef(err, "hand the master role of '%s' over", status.Master)
+	}
+	fmt.Printf("Мастер '%s' передал роль серверу '%s'\n", status.Master, resp.Successor)
+	return nil
+}
+
+func drain(ctx context.Context, server string) error {
+	status, err := clusterStatus(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := repo.Drain(ctx, serverAddr(status, server))
+	if err != nil {
+		return errors.WithMessagef(err, "drain '%s'", server)
+	}
+	fmt.Printf("Сервер '%s' больше не принимает новые игры\n", server)
+	if resp.Successor != "" {
+		fmt.Printf("Роль мастера передана серверу '%s'\n", resp.Successor)
+	}
+	return nil
+}
+
+/* clusterStatus asks the servers of the config one by one until one answers */
+func clusterStatus(ctx context.Context) (*domain.ClusterStatus, error) {
+	var lastErr error
+	for name := range portByHost {
+		status, err := repo.ClusterStatus(ctx, serverAddr(nil, name))
+		if err == nil {
+			return status, nil
+		}
+		log.Printf("Не удалось получить состояние кластера у сервера '%s': %v", name, err)
+		lastErr = err
+	}
+	return nil, errors.WithMessage(lastErr, "no server has answered")
+}
+
+/* the servers of the config are reached on the published ports, the ones that have joined later by their address */
+func serverAddr(status *domain.ClusterStatus, name string) string {
+	if port, ok := portByHost[name]; ok {
+		return "http://" + net.JoinHostPort(host, port)
+	}
+	if status != nil {
+		for _, node := range status.Nodes {
+			if node.Name == name {
+				return node.Addr
+			}
+		}
+	}
+	return "http://" + name
+}
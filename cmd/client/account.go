@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+const accountRequestTimeout = 10 * time.Second
+
+var errRejected = errors.New("the server has rejected the credentials")
+
+/*
+ * logIn gets the session token on any server, the registration is sent on to the master
+ * when a reserve answers with the server to register on
+ */
+func logIn(ticker *time.Ticker) {
+	for {
+		for host, port := range portByHost {
+			session, err := requestSession(port)
+			if errors.Is(err, errRejected) {
+				log.Fatal(err)
+			}
+			if err != nil {
+				log.Printf("Не удалось войти через сервер '%s': %v", host, err)
+				continue
+			}
+			sessionToken = session.Token
+			if register {
+				fmt.Printf("Аккаунт '%s' зарегистрирован\n", session.Name)
+				register = false /* the next sessions are got by logging in */
+			}
+			return
+		}
+		<-ticker.C
+	}
+}
+
+func requestSession(port string) (domain.Session, error) {
+	path := "/accounts/login"
+	if register {
+		path = "/accounts/register"
+	}
+	body, err := jsoniter.Marshal(domain.Credentials{Name: accountName, Password: password})
+	if err != nil {
+		return domain.Session{}, errors.WithMessage(err, "marshal credentials")
+	}
+	client := http.Client{Timeout: accountRequestTimeout}
+	for range portByHost {
+		addr := "http://" + net.JoinHostPort("localhost", port) + path
+		resp, err := client.Post(addr, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return domain.Session{}, errors.WithMessagef(err, "post '%s'", addr)
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return domain.Session{}, errors.WithMessage(err, "read response")
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			session := domain.Session{}
+			if err := jsoniter.Unmarshal(data, &session); err != nil {
+				return domain.Session{}, errors.WithMessage(err, "unmarshal session")
+			}
+			return session, nil
+		case http.StatusMisdirectedRequest:
+			master := domain.SwitchServerPayload{}
+			if err := jsoniter.Unmarshal(data, &master); err != nil {
+				return domain.Session{}, errors.WithMessage(err, "unmarshal master server")
+			}
+			var ok bool
+			if port, ok = portByHost[master.MasterServer]; !ok {
+				return domain.Session{}, errors.Errorf("undefined master server '%s'", master.MasterServer)
+			}
+			log.Printf("регистрируемся на мастере '%s'\n", master.MasterServer)
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict:
+			return domain.Session{}, errors.WithMessage(errRejected, strings.TrimSpace(string(data)))
+		default:
+			return domain.Session{}, errors.Errorf("unexpected status %s", resp.Status)
+		}
+	}
+	return domain.Session{}, errors.New("the master server has moved too many times")
+}
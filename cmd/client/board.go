@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+func (c *client) parseCell(text string) (int, error) {
+	fields := strings.Fields(text)
+	rows, cols := c.gridSize()
+	switch len(fields) {
+	case 1: /* порядковый номер клетки */
+		if c.state.Ultimate != nil {
+			return 0, errors.New("expected row and column")
+		}
+		pos, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return 0, err
+		}
+		if pos < 1 || pos > rows*cols {
+			return 0, errors.New("position out of range")
+		}
+		return pos - 1, nil
+	case 2: /* строка и столбец */
+		row, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return 0, err
+		}
+		col, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, err
+		}
+		row, col = row-1, col-1
+		if row < 0 || row >= rows || col < 0 || col >= cols {
+			return 0, errors.New("position out of range")
+		}
+		if c.state.Ultimate != nil {
+			return domain.UltimatePosition(row, col), nil
+		}
+		return row*cols + col, nil
+	default:
+		return 0, errors.New("unexpected input")
+	}
+}
+
+func (c *client) gridSize() (rows int, cols int) {
+	if c.state.Ultimate != nil {
+		side := domain.SubBoardSide * domain.SubBoardSide
+		return side, side
+	}
+	return c.state.Board.Rows, c.state.Board.Cols
+}
+
+func (c *client) cellAt(row int, col int) domain.Cell {
+	if c.state.Ultimate == nil {
+		return c.state.Board.At(row, col)
+	}
+	subBoard, cell := domain.LocateUltimate(domain.UltimatePosition(row, col))
+	return c.state.Ultimate.SubBoards[subBoard].Cells[cell]
+}
+
+func (c *client) printBoard() {
+	fmt.Printf("\033[H\033[J")
+	if c.gameUuid != "" {
+		fmt.Printf("Игра: %s\n", c.gameUuid)
+	}
+	rows, cols := c.gridSize()
+	header := make([]string, 0, cols)
+	for col := 1; col <= cols; col++ {
+		header = append(header, fmt.Sprintf("%2d ", col))
+	}
+	fmt.Printf("   %s\n", strings.Join(header, " "))
+	for row := 0; row < rows; row++ {
+		cells := make([]string, 0, cols)
+		for col := 0; col < cols; col++ {
+			cells = append(cells, fmt.Sprintf(" %c ", c.cellAt(row, col)))
+		}
+		fmt.Printf("%2d %s\n", row+1, c.joinCells(cells))
+		if row < rows-1 {
+			fmt.Printf("   %s\n", c.separator(row, cols))
+		}
+	}
+	if c.state.Ultimate != nil {
+		c.printUltimateInfo()
+	}
+	if clock := c.state.Clock; clock != nil {
+		fmt.Printf("Время: X %s | O %s\n",
+			clock.RemainingX.Round(time.Second), clock.RemainingO.Round(time.Second))
+	}
+}
+
+/* в ultimate-режиме границы малых полей выделяются двойной линией */
+func (c *client) joinCells(cells []string) string {
+	if c.state.Ultimate == nil {
+		return strings.Join(cells, "|")
+	}
+	var sb strings.Builder
+	for i, v := range cells {
+		if i > 0 {
+			if i%domain.SubBoardSide == 0 {
+				sb.WriteString("‖")
+			} else {
+				sb.WriteString("|")
+			}
+		}
+		sb.WriteString(v)
+	}
+	return sb.String()
+}
+
+func (c *client) separator(row int, cols int) string {
+	line := "———"
+	if c.state.Ultimate != nil && (row+1)%domain.SubBoardSide == 0 {
+		line = "==="
+	}
+	parts := make([]string, cols)
+	for i := range parts {
+		parts[i] = line
+	}
+	return strings.Join(parts, "+")
+}
+
+func (c *client) printUltimateInfo() {
+	fmt.Println("\nМалые поля:")
+	for i, v := range c.state.Board.Cells {
+		fmt.Printf("%c ", v)
+		if (i+1)%domain.SubBoardSide == 0 {
+			fmt.Println()
+		}
+	}
+	if next := c.state.Ultimate.NextBoard; next != domain.AnySubBoard {
+		fmt.Printf("Следующий ход в малом поле №%d\n", next+1)
+		return
+	}
+	fmt.Println("Следующий ход в любом открытом малом поле")
+}
@@ -4,17 +4,20 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/kiryu-dev/tic-tac-toe/internal/config"
 	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/rules"
 	"github.com/kiryu-dev/tic-tac-toe/pkg/utils"
 	"github.com/pkg/errors"
 )
@@ -22,22 +25,59 @@ import (
 const connectTryPeriod = 3 * time.Second
 
 var (
-	clientUuid = uuid.NewString()
-	portByHost = make(map[string]string)
+	accountName   string
+	password      string
+	register      bool
+	sessionToken  string
+	variant       string
+	botDifficulty string
+	spectateUuid  string
+	createRoom    bool
+	roomCode      string
+	bestOf        int
+	rematchUuid   string /* the finished game to play again, the next game of a series is its rematch too */
+	tournamentId  string /* the games of the tournament are played one after another until it's over for the player */
+	portByHost    = make(map[string]string)
+	rulesRegistry domain.RulesRegistry
+	input         <-chan string
 )
 
 func main() {
 	cfgPath := flag.String("config", "./conf/config.yml", "path to config")
+	flag.StringVar(&accountName, "name", "", "account name")
+	flag.StringVar(&password, "password", "", "account password")
+	flag.BoolVar(&register, "register", false, "register the account before playing")
+	flag.StringVar(&variant, "variant", "", "game variant (server default if empty)")
+	flag.StringVar(&botDifficulty, "bot", "", "play against bot: easy, medium, hard or perfect")
+	flag.StringVar(&spectateUuid, "spectate", "", "watch the game with this uuid instead of playing")
+	flag.BoolVar(&createRoom, "create-room", false, "create a private room and get an invite code for a friend")
+	flag.StringVar(&roomCode, "join", "", "join a private room by the invite code")
+	flag.IntVar(&bestOf, "best-of", 0, "play a series of 3 or 5 games instead of a single one")
+	flag.StringVar(&tournamentId, "tournament", "", "join the tournament with this id and play its games")
 	flag.Parse()
 	cfg, err := config.New(*cfgPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	rulesRegistry, err = rules.FromConfig(cfg.Game)
+	if err != nil {
+		log.Fatal(err)
+	}
 	for _, serverCfg := range cfg.Servers {
 		portByHost[serverCfg.Host] = strconv.Itoa(serverCfg.Port)
 	}
+	input = readLines(os.Stdin)
 	ticker := time.NewTicker(connectTryPeriod)
 	defer ticker.Stop()
+	switch {
+	case accountName != "" && password != "":
+		logIn(ticker) /* a spectator with an account watches as it, without one it's anonymous */
+	case spectateUuid == "":
+		log.Fatal("Чтобы играть, нужен аккаунт: укажи -name и -password (и -register, если его ещё нет)")
+	}
+	if tournamentId != "" {
+		joinTournament(ticker)
+	}
 	for {
 		for host, port := range portByHost {
 			err := сonnectToServer(port, ticker)
@@ -53,10 +93,38 @@ func сonnectToServer(port string, ticker *time.Ticker) error {
 	for range ticker.C {
 		serverAddress := net.JoinHostPort("localhost", port)
 		u := url.URL{Scheme: "ws", Host: serverAddress, Path: "/game"}
+		if spectateUuid != "" {
+			u.Path = "/spectate/" + spectateUuid
+		}
 		log.Printf("try to connect to server '%s'...\n", serverAddress)
-		conn, _, err := websocket.DefaultDialer.Dial(u.String(), map[string][]string{
-			domain.ClientUuidHeader: {clientUuid},
-		})
+		header := map[string][]string{
+			domain.SessionTokenHeader:  {sessionToken},
+			domain.ClientVariantHeader: {variant},
+		}
+		if botDifficulty != "" {
+			header[domain.BotDifficultyHeader] = []string{botDifficulty}
+		}
+		if createRoom {
+			header[domain.RoomCreateHeader] = []string{"true"}
+		}
+		if roomCode != "" {
+			header[domain.RoomCodeHeader] = []string{roomCode}
+		}
+		if bestOf > 0 {
+			header[domain.SeriesBestOfHeader] = []string{strconv.Itoa(bestOf)}
+		}
+		if rematchUuid != "" {
+			header[domain.RematchHeader] = []string{rematchUuid}
+		}
+		if tournamentId != "" {
+			header[domain.TournamentHeader] = []string{tournamentId}
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(u.String(), header)
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			log.Println("Сессия истекла, входим заново")
+			logIn(ticker)
+			return errors.New("the session has expired")
+		}
 		if err != nil {
 			return errors.WithMessage(err, "websocket dial")
 		}
@@ -67,7 +135,15 @@ func сonnectToServer(port string, ticker *time.Ticker) error {
 			return errors.WithMessage(err, "handle actions")
 		}
 		if !result.shouldSwitchToNewMaster { // буквально означает, что игра закончена
-			return nil
+			rematchUuid = ""
+			if tournamentId != "" {
+				continue /* the next round of the tournament */
+			}
+			if result.finishedGame == "" || !result.nextInSeries && !askRematch() {
+				return nil
+			}
+			rematchUuid = result.finishedGame
+			continue
 		}
 		var ok bool
 		port, ok = portByHost[result.newMasterServer]
@@ -80,91 +156,265 @@ func сonnectToServer(port string, ticker *time.Ticker) error {
 }
 
 type client struct {
-	conn     *websocket.Conn
-	scanner  *bufio.Scanner
-	board    domain.Board
-	cellType domain.Cell
+	conn            *websocket.Conn
+	gameUuid        string
+	seriesId        string
+	state           domain.GameState
+	cellType        domain.Cell
+	isMyTurn        bool
+	enemyOffersDraw bool
+	enemyAsksUndo   bool
 }
 
 func newClient(conn *websocket.Conn) *client {
 	return &client{
-		conn:    conn,
-		scanner: bufio.NewScanner(os.Stdin),
+		conn: conn,
 	}
 }
 
+func readLines(r io.Reader) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			ch <- scanner.Text()
+		}
+	}()
+	return ch
+}
+
+/* finishedGame is the game that may be played again, nextInSeries means that the series goes on */
 type handleActionsResult struct {
 	shouldSwitchToNewMaster bool
 	newMasterServer         string
+	finishedGame            string
+	nextInSeries            bool
+}
+
+type receivedMessage struct {
+	msg *domain.Message
+	err error
+}
+
+func (c *client) readMessages() <-chan receivedMessage {
+	ch := make(chan receivedMessage)
+	go func() {
+		defer close(ch)
+		for {
+			msg := new(domain.Message)
+			err := c.conn.ReadJSON(msg)
+			ch <- receivedMessage{msg: msg, err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch
 }
 
 func (c *client) handleActions() (handleActionsResult, error) {
+	messages := c.readMessages()
 	for {
-		msg := new(domain.Message)
-		if err := c.conn.ReadJSON(msg); err != nil {
-			return handleActionsResult{}, errors.WithMessage(err, "read json msg")
-		}
-		switch msg.Type {
-		case domain.StartGame:
-			if err := c.handleStartGameAction(msg); err != nil {
-				return handleActionsResult{}, errors.WithMessage(err, "handle start game action")
+		select {
+		case v := <-messages:
+			closeErr := new(websocket.CloseError)
+			if errors.As(v.err, &closeErr) && closeErr.Code == websocket.CloseNormalClosure {
+				fmt.Printf("Сервер закрыл соединение: %s\n", closeErr.Text)
+				return handleActionsResult{}, nil
 			}
-		case domain.RequestMove:
-			if err := c.handleRequestMoveAction(); err != nil {
-				return handleActionsResult{}, errors.WithMessage(err, "handle request move action")
+			if v.err != nil {
+				return handleActionsResult{}, errors.WithMessage(v.err, "read json msg")
 			}
-		case domain.PlayerMove:
-			isGameFinished, err := c.handlePlayerMoveAction(msg)
-			if err != nil {
-				return handleActionsResult{}, errors.WithMessage(err, "handle player move action")
+			result, isFinished, err := c.handleMessage(v.msg)
+			if err != nil || isFinished {
+				return result, err
 			}
-			if isGameFinished {
-				return handleActionsResult{}, nil
+		case line, ok := <-input:
+			if !ok {
+				return handleActionsResult{}, errors.New("stdin is closed")
 			}
-		case domain.Walkover:
-			v, err := utils.UnmarshalJson[domain.WalkoverPayload](msg.Payload)
-			if err != nil {
-				return handleActionsResult{}, errors.WithMessage(err, "unmarshal json to 'WalkoverPayload' type")
+			if err := c.handleInput(line); err != nil {
+				return handleActionsResult{}, errors.WithMessage(err, "handle input")
 			}
-			fmt.Println(v.GameResult)
-			return handleActionsResult{}, nil
-		case domain.SwitchServer:
-			v, err := utils.UnmarshalJson[domain.SwitchServerPayload](msg.Payload)
-			if err != nil {
-				return handleActionsResult{}, errors.WithMessage(err, "unmarshal json to 'SwitchServerPayload' type")
-			}
-			return handleActionsResult{
-				shouldSwitchToNewMaster: true,
-				newMasterServer:         v.MasterServer,
-			}, nil
 		}
 	}
 }
 
+func (c *client) handleMessage(msg *domain.Message) (result handleActionsResult, isFinished bool, err error) {
+	switch msg.Type {
+	case domain.StartGame:
+		if err := c.handleStartGameAction(msg); err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "handle start game action")
+		}
+	case domain.RequestMove:
+		c.handleRequestMoveAction()
+	case domain.PlayerMove:
+		isGameFinished, err := c.handlePlayerMoveAction(msg)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "handle player move action")
+		}
+		if isGameFinished {
+			return c.finishGame()
+		}
+	case domain.Walkover:
+		v, err := utils.UnmarshalJson[domain.WalkoverPayload](msg.Payload)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "unmarshal json to 'WalkoverPayload' type")
+		}
+		fmt.Println(v.GameResult)
+		return c.finishGame()
+	case domain.TimeOut:
+		v, err := utils.UnmarshalJson[domain.TimeOutPayload](msg.Payload)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "unmarshal json to 'TimeOutPayload' type")
+		}
+		fmt.Println()
+		fmt.Println(v.GameResult)
+		return c.finishGame()
+	case domain.GameOver:
+		v, err := utils.UnmarshalJson[domain.GameOverPayload](msg.Payload)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "unmarshal json to 'GameOverPayload' type")
+		}
+		fmt.Println()
+		fmt.Println(v.GameResult)
+		return c.finishGame()
+	case domain.OfferDraw:
+		c.enemyOffersDraw = true
+		fmt.Println("\nСоперник предлагает ничью: /accept или /decline")
+	case domain.DeclineDraw:
+		fmt.Println("\nСоперник отклонил предложение ничьей")
+	case domain.RequestTakeback:
+		c.enemyAsksUndo = true
+		fmt.Println("\nСоперник просит вернуть ход: /accept или /decline")
+	case domain.DeclineTakeback:
+		fmt.Println("\nСоперник не разрешил вернуть ход")
+	case domain.AcceptTakeback:
+		if err := c.handleTakebackAction(msg); err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "handle takeback action")
+		}
+	case domain.RoomWaiting:
+		v, err := utils.UnmarshalJson[domain.RoomPayload](msg.Payload)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "unmarshal json to 'RoomPayload' type")
+		}
+		fmt.Printf("Код комнаты: %s\nЖдём соперника...\n", v.Code)
+	case domain.RoomNotFound:
+		v, err := utils.UnmarshalJson[domain.RoomPayload](msg.Payload)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "unmarshal json to 'RoomPayload' type")
+		}
+		fmt.Printf("Комната '%s' не найдена или закрыта\n", v.Code)
+		return handleActionsResult{}, true, nil
+	case domain.SeriesScore:
+		v, err := utils.UnmarshalJson[domain.SeriesPayload](msg.Payload)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "unmarshal json to 'SeriesPayload' type")
+		}
+		result, isFinished := c.handleSeriesScore(v)
+		return result, isFinished, nil
+	case domain.RematchWaiting:
+		fmt.Println("Ждём, вернётся ли соперник...")
+	case domain.RematchNotFound:
+		fmt.Println("Эту партию уже нельзя переиграть")
+		return handleActionsResult{}, true, nil
+	case domain.RematchDeclined:
+		fmt.Println("Соперник не вернулся")
+		return handleActionsResult{}, true, nil
+	case domain.TournamentWaiting:
+		v, err := utils.UnmarshalJson[domain.TournamentPayload](msg.Payload)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "unmarshal json to 'TournamentPayload' type")
+		}
+		fmt.Printf("Турнир, тур %d: ждём соперника...\n", v.Round)
+	case domain.TournamentOver:
+		v, err := utils.UnmarshalJson[domain.TournamentPayload](msg.Payload)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "unmarshal json to 'TournamentPayload' type")
+		}
+		fmt.Printf("Турнир для тебя закончен, место: %d\n", v.Place)
+		if v.Winner != "" {
+			fmt.Printf("Победитель турнира: %s\n", v.Winner)
+		}
+		tournamentId = ""
+		return handleActionsResult{}, true, nil
+	case domain.TournamentNotFound:
+		fmt.Println("Турнир не найден или ты в нём не участвуешь")
+		tournamentId = ""
+		return handleActionsResult{}, true, nil
+	case domain.SwitchServer:
+		v, err := utils.UnmarshalJson[domain.SwitchServerPayload](msg.Payload)
+		if err != nil {
+			return handleActionsResult{}, false, errors.WithMessage(err, "unmarshal json to 'SwitchServerPayload' type")
+		}
+		return handleActionsResult{
+			shouldSwitchToNewMaster: true,
+			newMasterServer:         v.MasterServer,
+		}, true, nil
+	}
+	return handleActionsResult{}, false, nil
+}
+
 func (c *client) handleStartGameAction(msg *domain.Message) error {
 	v, err := utils.UnmarshalJson[domain.StartGamePayload](msg.Payload)
 	if err != nil {
 		return errors.WithMessage(err, "unmarshal json to 'StartGamePayload' type")
 	}
+	gameRules, err := rulesRegistry.Rules(v.Variant)
+	if err != nil {
+		return errors.WithMessage(err, "resolve game rules")
+	}
+	c.gameUuid = v.GameUuid
+	c.seriesId = v.SeriesId
 	c.cellType = v.CellType
-	c.board = v.Board
+	c.state = domain.GameState{
+		Board:       v.Board,
+		Ultimate:    v.Ultimate,
+		Variant:     v.Variant,
+		Round:       v.Round,
+		Rules:       gameRules,
+		TimeControl: v.TimeControl,
+		Clock:       v.Clock,
+	}
 	c.printBoard()
+	if spectateUuid == "" {
+		fmt.Println("Введи /help, чтобы увидеть список команд")
+	}
 	return nil
 }
 
-func (c *client) handleRequestMoveAction() error {
-	var (
-		pos byte
-		err error
-	)
-	for {
-		fmt.Printf("Твой ход: ")
-		pos, err = c.selectCell()
-		if err == nil {
-			break
-		}
+func (c *client) handleRequestMoveAction() {
+	c.isMyTurn = true
+	if limit, ok := c.state.Clock.TurnLimit(c.state.TimeControl, c.cellType); ok {
+		fmt.Printf("На ход осталось: %s\n", limit.Round(time.Second))
+	}
+	fmt.Printf("Твой ход: ")
+}
+
+func (c *client) handleInput(line string) error {
+	line = strings.TrimSpace(line)
+	if spectateUuid != "" {
+		fmt.Println("Ты наблюдатель, ходить нельзя")
+		return nil
+	}
+	if strings.HasPrefix(line, "/") {
+		return c.handleCommand(line)
+	}
+	if !c.isMyTurn {
+		fmt.Println("Сейчас ход соперника")
+		return nil
+	}
+	pos, err := c.parseCell(line)
+	if err == nil {
+		err = c.state.Rules.ValidateMove(&c.state, pos)
+	}
+	if err != nil {
 		fmt.Print("\033[F\033[K")
+		fmt.Printf("Твой ход: ")
+		return nil
 	}
+	c.isMyTurn = false
 	err = c.conn.WriteJSON(domain.Message{
 		Type: domain.PlayerMove,
 		Payload: domain.PlayerMovePayload{
@@ -178,47 +428,121 @@ func (c *client) handleRequestMoveAction() error {
 	return nil
 }
 
+const helpMessage = `Команды:
+  /resign  — сдаться
+  /draw    — предложить ничью
+  /undo    — попросить вернуть ход
+  /accept  — принять предложение соперника
+  /decline — отклонить предложение соперника`
+
+func (c *client) handleCommand(command string) error {
+	var msg domain.Message
+	switch command {
+	case "/resign":
+		msg = domain.Message{Type: domain.Resign}
+	case "/draw":
+		msg = domain.Message{Type: domain.OfferDraw}
+	case "/undo":
+		msg = domain.Message{Type: domain.RequestTakeback}
+	case "/accept", "/decline":
+		switch {
+		case c.enemyOffersDraw && command == "/accept":
+			msg = domain.Message{Type: domain.AcceptDraw}
+		case c.enemyOffersDraw:
+			msg = domain.Message{Type: domain.DeclineDraw}
+		case c.enemyAsksUndo && command == "/accept":
+			msg = domain.Message{Type: domain.AcceptTakeback}
+		case c.enemyAsksUndo:
+			msg = domain.Message{Type: domain.DeclineTakeback}
+		default:
+			fmt.Println("Соперник ничего не предлагал")
+			return nil
+		}
+		c.enemyOffersDraw, c.enemyAsksUndo = false, false
+	default:
+		fmt.Println(helpMessage)
+		return nil
+	}
+	if err := c.conn.WriteJSON(msg); err != nil {
+		return errors.WithMessage(err, "write json msg")
+	}
+	return nil
+}
+
 func (c *client) handlePlayerMoveAction(msg *domain.Message) (isGameFinished bool, err error) {
 	v, err := utils.UnmarshalJson[domain.PlayerMovePayload](msg.Payload)
 	if err != nil {
 		return false, errors.WithMessage(err, "unmarshal json to 'PlayerMovePayload' type")
 	}
-	c.board[v.Position] = v.CellType
+	c.state.Rules.ApplyMove(&c.state, v.Position, v.CellType)
+	c.state.Round++
+	if v.Clock != nil {
+		c.state.Clock = v.Clock
+	}
 	c.printBoard()
 	if v.GameResult != nil {
 		fmt.Println(*v.GameResult)
 		return true, nil
 	}
 	if v.IsMoveRequested {
-		if err := c.handleRequestMoveAction(); err != nil {
-			return false, errors.WithMessage(err, "handle request move action")
-		}
+		c.handleRequestMoveAction()
 	}
 	return false, nil
 }
 
-func (c *client) selectCell() (byte, error) {
-	if ok := c.scanner.Scan(); !ok {
-		return 0, c.scanner.Err()
-	}
-	pos, err := strconv.ParseUint(c.scanner.Text(), 10, 8)
+func (c *client) handleTakebackAction(msg *domain.Message) error {
+	v, err := utils.UnmarshalJson[domain.TakebackPayload](msg.Payload)
 	if err != nil {
-		return 0, err
+		return errors.WithMessage(err, "unmarshal json to 'TakebackPayload' type")
+	}
+	c.state.Board = v.Board
+	c.state.Ultimate = v.Ultimate
+	c.state.Round = v.Round
+	if v.Clock != nil {
+		c.state.Clock = v.Clock
 	}
-	return byte(pos - 1), nil
+	c.isMyTurn = false
+	c.printBoard()
+	fmt.Println("Ход возвращён")
+	return nil
 }
 
-func (c *client) printBoard() {
-	fmt.Printf("\033[H\033[J")
-	for i, cell := range c.board {
-		if (i+1)%3 == 0 {
-			fmt.Printf("%c ", cell)
-			if i < 6 {
-				fmt.Printf("\n——|———|——\n")
-			}
-		} else {
-			fmt.Printf("%c | ", cell)
-		}
+/* finishGame waits for the score of the series if the game is a part of it */
+func (c *client) finishGame() (handleActionsResult, bool, error) {
+	if c.seriesId != "" {
+		return handleActionsResult{}, false, nil
+	}
+	return handleActionsResult{finishedGame: c.gameUuid}, true, nil
+}
+
+/* the score may come before RematchDeclined too, then the client waits for the reason */
+func (c *client) handleSeriesScore(v domain.SeriesPayload) (result handleActionsResult, isFinished bool) {
+	if v.BestOf > 0 {
+		fmt.Printf("Счёт серии до %d побед: %s : %s (сыграно партий: %d)\n",
+			v.BestOf/2+1, formatScore(v.Score), formatScore(v.EnemyScore), v.Games)
+	} else {
+		fmt.Printf("Счёт встреч: %s : %s (сыграно партий: %d)\n", formatScore(v.Score), formatScore(v.EnemyScore), v.Games)
 	}
-	fmt.Println()
+	if v.SeriesResult != nil {
+		fmt.Println(*v.SeriesResult)
+	}
+	switch {
+	case c.gameUuid == "":
+		return handleActionsResult{}, false
+	case v.SeriesResult != nil, v.BestOf == 0:
+		return handleActionsResult{finishedGame: c.gameUuid}, true
+	}
+	fmt.Println("Следующая партия серии, цвета меняются")
+	return handleActionsResult{finishedGame: c.gameUuid, nextInSeries: true}, true
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+/* askRematch offers to play the finished game again with the colors swapped */
+func askRematch() bool {
+	fmt.Println("Сыграть ещё раз с этим соперником? /rematch — да, Enter — выйти")
+	line, ok := <-input
+	return ok && strings.TrimSpace(line) == "/rematch"
 }
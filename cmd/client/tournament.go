@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+/* joinTournament registers the player to the tournament on the master, like the registration of the account */
+func joinTournament(ticker *time.Ticker) {
+	for {
+		for host, port := range portByHost {
+			err := requestJoinTournament(port)
+			if errors.Is(err, errRejected) {
+				log.Fatal(err)
+			}
+			if err != nil {
+				log.Printf("Не удалось записаться на турнир через сервер '%s': %v", host, err)
+				continue
+			}
+			log.Printf("Ты записан на турнир '%s'\n", tournamentId)
+			return
+		}
+		<-ticker.C
+	}
+}
+
+func requestJoinTournament(port string) error {
+	client := http.Client{Timeout: accountRequestTimeout}
+	for range portByHost {
+		addr := "http://" + net.JoinHostPort("localhost", port) + "/tournaments/" + tournamentId + "/players"
+		req, err := http.NewRequest(http.MethodPost, addr, nil)
+		if err != nil {
+			return errors.WithMessage(err, "new request")
+		}
+		req.Header.Set(domain.SessionTokenHeader, sessionToken)
+		resp, err := client.Do(req)
+		if err != nil {
+			return errors.WithMessagef(err, "post '%s'", addr)
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return errors.WithMessage(err, "read response")
+		}
+		switch resp.StatusCode {
+		case http.StatusNoContent:
+			return nil
+		case http.StatusMisdirectedRequest:
+			master := domain.SwitchServerPayload{}
+			if err := jsoniter.Unmarshal(data, &master); err != nil {
+				return errors.WithMessage(err, "unmarshal master server")
+			}
+			var ok bool
+			if port, ok = portByHost[master.MasterServer]; !ok {
+				return errors.Errorf("undefined master server '%s'", master.MasterServer)
+			}
+		case http.StatusConflict:
+			/* the registration is closed, the player may still be one of the players */
+			return nil
+		case http.StatusNotFound, http.StatusUnauthorized:
+			return errors.WithMessage(errRejected, strings.TrimSpace(string(data)))
+		default:
+			return errors.Errorf("unexpected status %s", resp.Status)
+		}
+	}
+	return errors.New("the master server has moved too many times")
+}
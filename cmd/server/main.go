@@ -1,18 +1,29 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"flag"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/kiryu-dev/tic-tac-toe/internal/adapters/filestore"
 	"github.com/kiryu-dev/tic-tac-toe/internal/adapters/webapi"
 	"github.com/kiryu-dev/tic-tac-toe/internal/config"
 	"github.com/kiryu-dev/tic-tac-toe/internal/transport/ws"
+	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/account"
+	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/bot"
 	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/game"
 	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/hub"
+	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/journal"
+	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/rating"
+	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/rules"
+	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/spectator"
+	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/stats"
 	"github.com/kiryu-dev/tic-tac-toe/internal/usecase/synchronizer"
+	"github.com/kiryu-dev/tic-tac-toe/pkg/nodeauth"
+	"github.com/kiryu-dev/tic-tac-toe/pkg/session"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
@@ -32,7 +43,7 @@ func main() {
 	if err != nil {
 		logger.Fatal(err.Error())
 	}
-	sigChan := make(chan os.Signal)
+	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	errGroup := new(errgroup.Group)
 	errGroup.Go(func() error {
@@ -41,13 +52,72 @@ func main() {
 			return errors.Errorf("captured signal: %v", s)
 		}
 	})
+	rulesRegistry, err := rules.FromConfig(cfg.Game)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	storage, err := filestore.New(cfg.Storage.Dir, cfg.Storage.SnapshotEvery)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	defer func() {
+		_ = storage.Close()
+	}()
+	accountStorage, err := filestore.NewAccounts(cfg.Storage.Dir, cfg.Storage.SnapshotEvery)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	defer func() {
+		_ = accountStorage.Close()
+	}()
+	ratingStorage, err := filestore.NewRatings(cfg.Storage.Dir, cfg.Storage.SnapshotEvery)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	defer func() {
+		_ = ratingStorage.Close()
+	}()
+	statsStorage, err := filestore.NewStats(cfg.Storage.Dir, cfg.Storage.SnapshotEvery)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	defer func() {
+		_ = statsStorage.Close()
+	}()
+	sessions := session.New(cmp.Or(os.Getenv("SESSION_KEY"), cfg.Accounts.SessionKey), cfg.Accounts.SessionTTL)
+	if sessions == nil {
+		logger.Fatal("the session key isn't set, the servers can't check the sessions of the players")
+	}
+	auth := nodeauth.New(cmp.Or(os.Getenv("NODE_AUTH_KEY"), cfg.NodeAuth.Key), os.Getenv("SERVER_NAME"),
+		cfg.NodeAuth.MaxSkew)
+	if !auth.Enabled() {
+		logger.Warn("node authentication is off, anyone reaching the server can change its state")
+	}
 	var (
-		repo   = webapi.New()
-		sync   = synchronizer.New(repo, cfg.Servers, logger)
-		game   = game.New(logger)
-		hub    = hub.New(game, logger)
-		server = ws.New(hub, sync, logger)
+		repo        = webapi.New(auth)
+		sync        = synchronizer.New(repo, cfg.Servers, cfg.Election, cfg.Replication, cfg.Membership, logger)
+		accounts    = account.New(accountStorage, sync, sessions, logger)
+		ratings     = rating.New(ratingStorage, accounts, logger)
+		playerStats = stats.New(statsStorage, accounts, logger)
+		bots        = bot.New(rulesRegistry, logger)
+		spectators  = spectator.New(logger)
+		game        = game.New(journal.New(storage, spectators, ratings, sync), ratings, logger) /* replication last */
+		hub         = hub.New(game, rulesRegistry, bots, storage, accounts, ratings, playerStats, spectators, sync, sync,
+			cfg.Game, cfg.Matchmaking, cfg.Bot, cfg.Tournament, logger)
+		server = ws.New(hub, sync, accounts, ratings, auth, logger)
 	)
+	if err := accounts.Restore(context.Background()); err != nil {
+		logger.Fatal(err.Error())
+	}
+	if err := ratings.Restore(context.Background()); err != nil {
+		logger.Fatal(err.Error())
+	}
+	if err := playerStats.Restore(context.Background()); err != nil {
+		logger.Fatal(err.Error())
+	}
+	if err := hub.Restore(context.Background()); err != nil {
+		logger.Fatal(err.Error())
+	}
 	go server.ListenAndServe(context.Background())
 	if err := errGroup.Wait(); err != nil {
 		logger.Info("gracefully shutting down the server: " + err.Error())
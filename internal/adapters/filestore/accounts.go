@@ -0,0 +1,44 @@
+package filestore
+
+import (
+	"context"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+const accountsName = "accounts"
+
+type accountStorage struct {
+	*records[domain.Account]
+}
+
+func NewAccounts(dir string, snapshotEvery int) (*accountStorage, error) {
+	r, err := openRecords[domain.Account](dir, accountsName, snapshotEvery)
+	if err != nil {
+		return nil, err
+	}
+	return &accountStorage{records: r}, nil
+}
+
+func (s *accountStorage) Save(_ context.Context, account *domain.Account) error {
+	if err := s.save(account.Id, account); err != nil {
+		return errors.WithMessagef(err, "save account '%s'", account.Id)
+	}
+	return nil
+}
+
+func (s *accountStorage) Delete(_ context.Context, accountId string) error {
+	if err := s.delete(accountId); err != nil {
+		return errors.WithMessagef(err, "delete account '%s'", accountId)
+	}
+	return nil
+}
+
+func (s *accountStorage) Load(_ context.Context) (map[string]*domain.Account, error) {
+	accounts, err := s.load()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load accounts")
+	}
+	return accounts, nil
+}
@@ -0,0 +1,44 @@
+package filestore
+
+import (
+	"context"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+const ratingsName = "ratings"
+
+type ratingStorage struct {
+	*records[domain.Rating]
+}
+
+func NewRatings(dir string, snapshotEvery int) (*ratingStorage, error) {
+	r, err := openRecords[domain.Rating](dir, ratingsName, snapshotEvery)
+	if err != nil {
+		return nil, err
+	}
+	return &ratingStorage{records: r}, nil
+}
+
+func (s *ratingStorage) Save(_ context.Context, rating *domain.Rating) error {
+	if err := s.save(rating.AccountId, rating); err != nil {
+		return errors.WithMessagef(err, "save rating '%s'", rating.AccountId)
+	}
+	return nil
+}
+
+func (s *ratingStorage) Delete(_ context.Context, accountId string) error {
+	if err := s.delete(accountId); err != nil {
+		return errors.WithMessagef(err, "delete rating '%s'", accountId)
+	}
+	return nil
+}
+
+func (s *ratingStorage) Load(_ context.Context) (map[string]*domain.Rating, error) {
+	ratings, err := s.load()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load ratings")
+	}
+	return ratings, nil
+}
@@ -0,0 +1,49 @@
+package filestore
+
+import (
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+)
+
+/* records keeps values of one type by key next to the games, in a log and a snapshot of their own */
+type records[T any] struct {
+	store *storage
+}
+
+func openRecords[T any](dir string, name string, snapshotEvery int) (*records[T], error) {
+	store, err := open(dir, name, snapshotEvery)
+	if err != nil {
+		return nil, err
+	}
+	return &records[T]{store: store}, nil
+}
+
+func (r *records[T]) save(key string, value *T) error {
+	data, err := jsoniter.Marshal(value)
+	if err != nil {
+		return errors.WithMessage(err, "marshal record")
+	}
+	return r.store.put(key, data)
+}
+
+func (r *records[T]) delete(key string) error {
+	return r.store.remove(key)
+}
+
+func (r *records[T]) load() (map[string]*T, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	values := make(map[string]*T, len(r.store.states))
+	for key, data := range r.store.states {
+		value := new(T)
+		if err := jsoniter.Unmarshal(data, value); err != nil {
+			return nil, errors.WithMessagef(err, "unmarshal record '%s'", key)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func (r *records[T]) Close() error {
+	return r.store.Close()
+}
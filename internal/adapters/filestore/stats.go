@@ -0,0 +1,44 @@
+package filestore
+
+import (
+	"context"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+const statsName = "stats"
+
+type statsStorage struct {
+	*records[domain.PlayerStats]
+}
+
+func NewStats(dir string, snapshotEvery int) (*statsStorage, error) {
+	r, err := openRecords[domain.PlayerStats](dir, statsName, snapshotEvery)
+	if err != nil {
+		return nil, err
+	}
+	return &statsStorage{records: r}, nil
+}
+
+func (s *statsStorage) Save(_ context.Context, stats *domain.PlayerStats) error {
+	if err := s.save(stats.AccountId, stats); err != nil {
+		return errors.WithMessagef(err, "save player stats '%s'", stats.AccountId)
+	}
+	return nil
+}
+
+func (s *statsStorage) Delete(_ context.Context, accountId string) error {
+	if err := s.delete(accountId); err != nil {
+		return errors.WithMessagef(err, "delete player stats '%s'", accountId)
+	}
+	return nil
+}
+
+func (s *statsStorage) Load(_ context.Context) (map[string]*domain.PlayerStats, error) {
+	stats, err := s.load()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load player stats")
+	}
+	return stats, nil
+}
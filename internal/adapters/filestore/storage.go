@@ -0,0 +1,259 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+const (
+	gamesName            = "games"
+	logFileSuffix        = ".log"
+	snapshotFileSuffix   = ".snapshot"
+	defaultDir           = "./data"
+	defaultSnapshotEvery = 1000
+)
+
+type operation string
+
+const (
+	saveOperation   operation = "save"
+	deleteOperation operation = "delete"
+)
+
+/* the entries written before the storage kept anything but games have only GameUuid */
+type logEntry struct {
+	Op       operation           `json:"op"`
+	Key      string              `json:"key,omitempty"`
+	GameUuid string              `json:"game_uuid,omitempty"`
+	State    jsoniter.RawMessage `json:"state,omitempty"`
+}
+
+/*
+ * storage keeps game states (or other values by key, see records) in an append-only log of saves and deletes.
+ * Every snapshotEvery entries the current states are written to a snapshot file and the log is truncated,
+ * so on startup only the snapshot and the tail of the log are read
+ */
+type storage struct {
+	dir           string
+	name          string
+	snapshotEvery int
+	states        map[string]jsoniter.RawMessage
+	logFile       *os.File
+	logEntries    int
+	mu            *sync.Mutex
+}
+
+func New(dir string, snapshotEvery int) (*storage, error) {
+	return open(dir, gamesName, snapshotEvery)
+}
+
+func open(dir string, name string, snapshotEvery int) (*storage, error) {
+	if dir == "" {
+		dir = defaultDir
+	}
+	if snapshotEvery <= 0 {
+		snapshotEvery = defaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.WithMessagef(err, "create storage dir '%s'", dir)
+	}
+	s := &storage{
+		dir:           dir,
+		name:          name,
+		snapshotEvery: snapshotEvery,
+		states:        make(map[string]jsoniter.RawMessage),
+		mu:            &sync.Mutex{},
+	}
+	if err := s.readSnapshot(); err != nil {
+		return nil, errors.WithMessage(err, "read snapshot")
+	}
+	if err := s.replayLog(); err != nil {
+		return nil, errors.WithMessage(err, "replay log")
+	}
+	return s, nil
+}
+
+func (s *storage) Save(_ context.Context, gameUuid string, state *domain.GameState) error {
+	data, err := jsoniter.Marshal(state)
+	if err != nil {
+		return errors.WithMessage(err, "marshal game state")
+	}
+	if err := s.put(gameUuid, data); err != nil {
+		return errors.WithMessagef(err, "save game '%s'", gameUuid)
+	}
+	return nil
+}
+
+func (s *storage) Delete(_ context.Context, gameUuid string) error {
+	if err := s.remove(gameUuid); err != nil {
+		return errors.WithMessagef(err, "delete game '%s'", gameUuid)
+	}
+	return nil
+}
+
+func (s *storage) Load(_ context.Context) (map[string]*domain.GameState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make(map[string]*domain.GameState, len(s.states))
+	for gameUuid, data := range s.states {
+		state := new(domain.GameState)
+		if err := jsoniter.Unmarshal(data, state); err != nil {
+			return nil, errors.WithMessagef(err, "unmarshal game '%s'", gameUuid)
+		}
+		states[gameUuid] = state
+	}
+	return states, nil
+}
+
+func (s *storage) put(key string, data jsoniter.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(logEntry{Op: saveOperation, Key: key, State: data}); err != nil {
+		return err
+	}
+	s.states[key] = data
+	return s.compactIfNeeded()
+}
+
+func (s *storage) remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.states[key]; !ok {
+		return nil
+	}
+	if err := s.append(logEntry{Op: deleteOperation, Key: key}); err != nil {
+		return err
+	}
+	delete(s.states, key)
+	return s.compactIfNeeded()
+}
+
+func (s *storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logFile.Close()
+}
+
+func (s *storage) readSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, s.name+snapshotFileSuffix))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return jsoniter.Unmarshal(data, &s.states)
+}
+
+/* replayLog applies the log over the snapshot, a torn last line (crash in the middle of a write) is cut off */
+func (s *storage) replayLog() error {
+	file, err := os.OpenFile(filepath.Join(s.dir, s.name+logFileSuffix), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return errors.WithMessage(err, "open log file")
+	}
+	s.logFile = file
+	var (
+		reader = bufio.NewReader(file)
+		offset int64
+	)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return errors.WithMessage(err, "read log file")
+		}
+		entry := logEntry{}
+		if err := jsoniter.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			break
+		}
+		key := cmp.Or(entry.Key, entry.GameUuid)
+		switch entry.Op {
+		case saveOperation:
+			s.states[key] = entry.State
+		case deleteOperation:
+			delete(s.states, key)
+		}
+		offset += int64(len(line))
+		s.logEntries++
+	}
+	if err := file.Truncate(offset); err != nil {
+		return errors.WithMessage(err, "truncate torn log tail")
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return errors.WithMessage(err, "seek log file")
+	}
+	return nil
+}
+
+func (s *storage) append(entry logEntry) error {
+	data, err := jsoniter.Marshal(entry)
+	if err != nil {
+		return errors.WithMessage(err, "marshal log entry")
+	}
+	if _, err := s.logFile.Write(append(data, '\n')); err != nil {
+		return errors.WithMessage(err, "write log entry")
+	}
+	if err := s.logFile.Sync(); err != nil {
+		return errors.WithMessage(err, "sync log file")
+	}
+	s.logEntries++
+	return nil
+}
+
+/*
+ * compactIfNeeded writes a snapshot through a temp file and rename, so a crash leaves either the old or the new one.
+ * If it crashes before the log is truncated the log is just replayed over the new snapshot once more
+ */
+func (s *storage) compactIfNeeded() error {
+	if s.logEntries < s.snapshotEvery {
+		return nil
+	}
+	data, err := jsoniter.Marshal(s.states)
+	if err != nil {
+		return errors.WithMessage(err, "marshal snapshot")
+	}
+	snapshotPath := filepath.Join(s.dir, s.name+snapshotFileSuffix)
+	tmpPath := snapshotPath + ".tmp"
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return errors.WithMessage(err, "write snapshot")
+	}
+	if err := os.Rename(tmpPath, snapshotPath); err != nil {
+		return errors.WithMessage(err, "rename snapshot")
+	}
+	if err := s.logFile.Truncate(0); err != nil {
+		return errors.WithMessage(err, "truncate log file")
+	}
+	if _, err := s.logFile.Seek(0, io.SeekStart); err != nil {
+		return errors.WithMessage(err, "seek log file")
+	}
+	s.logEntries = 0
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -8,60 +8,194 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/kiryu-dev/tic-tac-toe/pkg/nodeauth"
 	"github.com/pkg/errors"
 )
 
 const (
 	clientTimeout       = 5 * time.Second
 	syncStatesEndpoint  = "/sync"
+	forwardEndpoint     = "/sync/forward"
+	snapshotEndpoint    = "/sync/snapshot"
+	chunkEndpoint       = "/sync/snapshot/chunk"
 	healthCheckEndpoint = "/health"
+	voteEndpoint        = "/election/vote"
+	heartbeatEndpoint   = "/election/heartbeat"
+	joinEndpoint        = "/cluster/join"
+	gossipEndpoint      = "/cluster/gossip"
+	takeoverEndpoint    = "/election/takeover"
+	nodeStatusEndpoint  = "/cluster/node"
+	statusEndpoint      = "/cluster/status"
+	handoverEndpoint    = "/cluster/handover"
+	drainEndpoint       = "/cluster/drain"
 )
 
 type repository struct {
-	cli *http.Client
+	cli  *http.Client
+	auth *nodeauth.Authenticator
 }
 
-func New() repository {
+/* auth signs every request, so the other servers know it comes from the cluster */
+func New(auth *nodeauth.Authenticator) repository {
 	return repository{
-		cli: &http.Client{Timeout: clientTimeout},
+		cli:  &http.Client{Timeout: clientTimeout},
+		auth: auth,
 	}
 }
 
-func (r repository) Sync(ctx context.Context, addr string, states map[string]*domain.GameState) error {
-	body, err := jsoniter.Marshal(states)
-	if err != nil {
-		return errors.WithMessage(err, "marshal json body")
+func (r repository) Replicate(ctx context.Context, addr string,
+	req domain.ReplicationRequest) (*domain.ReplicationResponse, error) {
+	result := new(domain.ReplicationResponse)
+	if err := r.post(ctx, addr, syncStatesEndpoint, req, result); err != nil {
+		return nil, err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+syncStatesEndpoint, bytes.NewReader(body))
-	if err != nil {
-		return errors.WithMessage(err, "new post request")
+	return result, nil
+}
+
+func (r repository) HealthCheck(ctx context.Context, addr string) (*domain.HealthCheckResponse, error) {
+	result := new(domain.HealthCheckResponse)
+	if err := r.get(ctx, addr, healthCheckEndpoint, result); err != nil {
+		return nil, err
 	}
-	resp, err := r.cli.Do(req)
-	if err != nil {
-		return errors.WithMessagef(err, "call http endpoint '%s'", syncStatesEndpoint)
+	return result, nil
+}
+
+func (r repository) RequestVote(ctx context.Context, addr string, req domain.VoteRequest) (*domain.VoteResponse, error) {
+	result := new(domain.VoteResponse)
+	if err := r.post(ctx, addr, voteEndpoint, req, result); err != nil {
+		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("unexpected response status '%s'", resp.Status)
+	return result, nil
+}
+
+func (r repository) Heartbeat(ctx context.Context, addr string,
+	req domain.HeartbeatRequest) (*domain.HeartbeatResponse, error) {
+	result := new(domain.HeartbeatResponse)
+	if err := r.post(ctx, addr, heartbeatEndpoint, req, result); err != nil {
+		return nil, err
 	}
-	return nil
+	return result, nil
 }
 
-func (r repository) HealthCheck(ctx context.Context, addr string) (*domain.HealthCheckResponse, error) {
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+healthCheckEndpoint, nil)
+func (r repository) Forward(ctx context.Context, addr string, req domain.ForwardRequest) (*domain.ForwardResponse, error) {
+	result := new(domain.ForwardResponse)
+	if err := r.post(ctx, addr, forwardEndpoint, req, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r repository) Snapshot(ctx context.Context, addr string, req domain.SnapshotRequest) (*domain.SnapshotInfo, error) {
+	result := new(domain.SnapshotInfo)
+	if err := r.post(ctx, addr, snapshotEndpoint, req, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r repository) SnapshotChunk(ctx context.Context, addr string,
+	req domain.ChunkRequest) (*domain.ChunkResponse, error) {
+	result := new(domain.ChunkResponse)
+	if err := r.post(ctx, addr, chunkEndpoint, req, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r repository) Join(ctx context.Context, addr string, req domain.JoinRequest) (*domain.MembersResponse, error) {
+	result := new(domain.MembersResponse)
+	if err := r.post(ctx, addr, joinEndpoint, req, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r repository) Gossip(ctx context.Context, addr string, req domain.GossipRequest) (*domain.MembersResponse, error) {
+	result := new(domain.MembersResponse)
+	if err := r.post(ctx, addr, gossipEndpoint, req, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r repository) NodeStatus(ctx context.Context, addr string) (*domain.NodeStatus, error) {
+	result := new(domain.NodeStatus)
+	if err := r.get(ctx, addr, nodeStatusEndpoint, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r repository) Takeover(ctx context.Context, addr string,
+	req domain.TakeoverRequest) (*domain.TakeoverResponse, error) {
+	result := new(domain.TakeoverResponse)
+	if err := r.post(ctx, addr, takeoverEndpoint, req, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/* ClusterStatus, Handover and Drain are called by the admin tool */
+func (r repository) ClusterStatus(ctx context.Context, addr string) (*domain.ClusterStatus, error) {
+	result := new(domain.ClusterStatus)
+	if err := r.get(ctx, addr, statusEndpoint, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r repository) Handover(ctx context.Context, addr string,
+	req domain.HandoverRequest) (*domain.HandoverResponse, error) {
+	result := new(domain.HandoverResponse)
+	if err := r.post(ctx, addr, handoverEndpoint, req, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r repository) Drain(ctx context.Context, addr string) (*domain.HandoverResponse, error) {
+	result := new(domain.HandoverResponse)
+	if err := r.post(ctx, addr, drainEndpoint, struct{}{}, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r repository) get(ctx context.Context, addr string, endpoint string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+endpoint, nil)
+	if err != nil {
+		return errors.WithMessage(err, "new get request")
+	}
+	r.auth.Sign(req, nil)
+	return r.do(req, endpoint, result)
+}
+
+func (r repository) post(ctx context.Context, addr string, endpoint string, body any, result any) error {
+	data, err := jsoniter.Marshal(body)
 	if err != nil {
-		return nil, errors.WithMessage(err, "new get request")
+		return errors.WithMessage(err, "marshal json body")
 	}
-	resp, err := r.cli.Do(request)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+endpoint, bytes.NewReader(data))
 	if err != nil {
-		return nil, errors.WithMessagef(err, "call http endpoint '%s'", healthCheckEndpoint)
+		return errors.WithMessage(err, "new post request")
 	}
+	r.auth.Sign(req, data)
+	return r.do(req, endpoint, result)
+}
+
+func (r repository) do(req *http.Request, endpoint string, result any) error {
+	resp, err := r.cli.Do(req)
+	if err != nil {
+		return errors.WithMessagef(err, "call http endpoint '%s'", endpoint)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("unexpected response status '%s'", resp.Status)
+		return errors.Errorf("unexpected response status '%s'", resp.Status)
 	}
-	result := new(domain.HealthCheckResponse)
 	if err := jsoniter.NewDecoder(resp.Body).Decode(result); err != nil {
-		return nil, errors.WithMessage(err, "decode json response body")
+		return errors.WithMessage(err, "decode json response body")
 	}
-	_ = resp.Body.Close()
-	return result, nil
+	return nil
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
@@ -16,8 +17,106 @@ type ServerConfig struct {
 	Port int    `yaml:"port"`
 }
 
+type VariantConfig struct {
+	Name      string `yaml:"name"`
+	Rows      int    `yaml:"rows"`
+	Cols      int    `yaml:"cols"`
+	WinLength int    `yaml:"win_length"`
+}
+
+type TimeControlConfig struct {
+	Total     time.Duration `yaml:"total"`
+	Increment time.Duration `yaml:"increment"`
+	PerMove   time.Duration `yaml:"per_move"`
+}
+
+type GameConfig struct {
+	DefaultVariant string            `yaml:"default_variant"`
+	Variants       []VariantConfig   `yaml:"variants"`
+	TimeControl    TimeControlConfig `yaml:"time_control"`
+	RecordTTL      time.Duration     `yaml:"record_ttl"`
+	RoomTTL        time.Duration     `yaml:"room_ttl"`
+	RematchTimeout time.Duration     `yaml:"rematch_timeout"`
+}
+
+/*
+ * The players of a rated game are paired within RatingWindow of each other,
+ * the window widens by WindowGrowth rating points every second of waiting. A zero window pairs anyone
+ */
+type MatchmakingConfig struct {
+	RatingWindow float64 `yaml:"rating_window"`
+	WindowGrowth float64 `yaml:"window_growth"`
+}
+
+/*
+ * A tournament game nobody has come to within StartTimeout is forfeited,
+ * a finished tournament is kept with its standings for FinishedTTL
+ */
+type TournamentConfig struct {
+	StartTimeout time.Duration `yaml:"start_timeout"`
+	FinishedTTL  time.Duration `yaml:"finished_ttl"`
+}
+
+type BotConfig struct {
+	WaitTimeout time.Duration `yaml:"wait_timeout"`
+	Difficulty  string        `yaml:"difficulty"`
+}
+
+type StorageConfig struct {
+	Dir           string `yaml:"dir"`
+	SnapshotEvery int    `yaml:"snapshot_every"`
+}
+
+type ElectionConfig struct {
+	HeartbeatPeriod time.Duration `yaml:"heartbeat_period"`
+	ElectionTimeout time.Duration `yaml:"election_timeout"`
+}
+
+/*
+ * Durability is "async" (a move is confirmed right away) or "quorum" (after the majority of servers has it).
+ * Sharding spreads games across all the servers instead of serving them all on the master
+ */
+type ReplicationConfig struct {
+	Durability string        `yaml:"durability"`
+	AckTimeout time.Duration `yaml:"ack_timeout"`
+	Sharding   bool          `yaml:"sharding"`
+}
+
+/* GossipPeriod is how often a server exchanges the member list with a random peer */
+type MembershipConfig struct {
+	GossipPeriod time.Duration `yaml:"gossip_period"`
+}
+
+/*
+ * Key is shared by the servers of the cluster to sign the requests to each other, an empty key turns the check off.
+ * MaxSkew is how old a signed request may be
+ */
+type NodeAuthConfig struct {
+	Key     string        `yaml:"key"`
+	MaxSkew time.Duration `yaml:"max_skew"`
+}
+
+/*
+ * SessionKey signs the session tokens of the players, every server of the cluster needs the same one.
+ * SessionTTL is how long a token is valid
+ */
+type AccountsConfig struct {
+	SessionKey string        `yaml:"session_key"`
+	SessionTTL time.Duration `yaml:"session_ttl"`
+}
+
 type config struct {
-	Servers []ServerConfig `yaml:"outer_servers"`
+	Servers     []ServerConfig    `yaml:"outer_servers"`
+	Game        GameConfig        `yaml:"game"`
+	Tournament  TournamentConfig  `yaml:"tournament"`
+	Matchmaking MatchmakingConfig `yaml:"matchmaking"`
+	Bot         BotConfig         `yaml:"bot"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Election    ElectionConfig    `yaml:"election"`
+	Replication ReplicationConfig `yaml:"replication"`
+	Membership  MembershipConfig  `yaml:"membership"`
+	NodeAuth    NodeAuthConfig    `yaml:"node_auth"`
+	Accounts    AccountsConfig    `yaml:"accounts"`
 }
 
 func New(cfgPath string) (config, error) {
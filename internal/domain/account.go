@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrAccountExists   = errors.New("the account name is already taken")
+	ErrBadAccountName  = errors.New("the account name has to be 3 to 32 letters, digits, '_' or '-'")
+	ErrWeakPassword    = errors.New("the password has to be at least 8 characters and at most 72 bytes long")
+	ErrBadCredentials  = errors.New("wrong account name or password")
+	ErrUnauthenticated = errors.New("the session token is missing or invalid")
+)
+
+const SessionTokenHeader = "X-Session-Token"
+
+/* Account is replicated and stored on every server, so a player may log in on any of them */
+type Account struct {
+	Id           string
+	Name         string
+	PasswordHash []byte
+	CreatedAt    time.Time
+}
+
+type Credentials struct {
+	Name     string
+	Password string
+}
+
+/* Session is what registration and login return, the client sends the Token in SessionTokenHeader */
+type Session struct {
+	AccountId string
+	Name      string
+	Token     string
+	ExpiresAt time.Time
+}
+
+type AccountStorage interface {
+	Save(ctx context.Context, account *Account) error
+	Delete(ctx context.Context, accountId string) error
+	Load(ctx context.Context) (map[string]*Account, error)
+}
+
+/* AccountCommitter ships a new account to the reserves, it returns once the account is as durable as a move */
+type AccountCommitter interface {
+	CommitAccount(ctx context.Context, account *Account) error
+}
+
+/*
+ * AccountUseCase registers players and checks their sessions. Only the master registers them,
+ * the reserves get the accounts with the rest of the hub state (see HubState.Accounts)
+ */
+type AccountUseCase interface {
+	Register(ctx context.Context, creds Credentials) (Session, error)
+	Login(ctx context.Context, creds Credentials) (Session, error)
+	Authenticate(token string) (string, error)
+	Name(accountId string) (string, bool)
+	Restore(ctx context.Context) error
+	State() map[string]*Account
+	ApplyStates(ctx context.Context, accounts map[string]*Account)
+	ApplyAccount(ctx context.Context, account *Account)
+}
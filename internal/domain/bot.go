@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnknownDifficulty = errors.New("unknown bot difficulty")
+
+const BotUuidPrefix = "bot-"
+
+type BotDifficulty string
+
+const (
+	EasyBot    = BotDifficulty("easy")
+	MediumBot  = BotDifficulty("medium")
+	HardBot    = BotDifficulty("hard")
+	PerfectBot = BotDifficulty("perfect")
+)
+
+func ParseBotDifficulty(s string) (BotDifficulty, error) {
+	switch v := BotDifficulty(strings.ToLower(strings.TrimSpace(s))); v {
+	case EasyBot, MediumBot, HardBot, PerfectBot:
+		return v, nil
+	default:
+		return "", errors.WithMessagef(ErrUnknownDifficulty, "difficulty '%s'", s)
+	}
+}
+
+func IsBot(playerUuid string) bool {
+	return strings.HasPrefix(playerUuid, BotUuidPrefix)
+}
+
+type BotProvider interface {
+	NewBot(botUuid string, variant string, difficulty BotDifficulty) Client
+}
@@ -6,10 +6,17 @@ import (
 
 var (
 	ErrConnectionClosed = errors.New("connection closed")
+	ErrServerSwitched   = errors.New("the client has been sent to another server")
 )
 
 const (
-	ClientUuidHeader = "X-Client-Key"
+	ClientVariantHeader = "X-Game-Variant"
+	BotDifficultyHeader = "X-Bot-Difficulty"
+	RoomCreateHeader    = "X-Room-Create"
+	RoomCodeHeader      = "X-Room-Code"
+	SeriesBestOfHeader  = "X-Series-Best-Of"
+	RematchHeader       = "X-Rematch"
+	TournamentHeader    = "X-Tournament"
 )
 
 type messageType byte
@@ -20,6 +27,24 @@ const (
 	PlayerMove
 	Walkover
 	SwitchServer
+	TimeOut
+	Resign
+	OfferDraw
+	AcceptDraw
+	DeclineDraw
+	RequestTakeback
+	AcceptTakeback
+	DeclineTakeback
+	GameOver
+	RoomWaiting
+	RoomNotFound
+	SeriesScore
+	RematchWaiting
+	RematchNotFound
+	RematchDeclined
+	TournamentWaiting
+	TournamentOver
+	TournamentNotFound
 )
 
 type Message struct {
@@ -28,25 +53,52 @@ type Message struct {
 }
 
 type StartGamePayload struct {
-	CellType Cell
-	Board    Board
+	GameUuid    string `json:",omitempty"`
+	CellType    Cell
+	Variant     string
+	Board       Board
+	Ultimate    *UltimateBoard `json:",omitempty"`
+	Round       int
+	TimeControl *TimeControl `json:",omitempty"`
+	Clock       *Clock       `json:",omitempty"`
+	SeriesId    string       `json:",omitempty"`
 }
 
 type PlayerMovePayload struct {
 	CellType        Cell
-	Position        byte
+	Position        int
 	IsMoveRequested bool
 	GameResult      *string
+	Clock           *Clock `json:",omitempty"`
 }
 
 type WalkoverPayload struct {
 	GameResult string
 }
 
+type TimeOutPayload struct {
+	GameResult string
+}
+
+type GameOverPayload struct {
+	GameResult string
+}
+
+type TakebackPayload struct {
+	Board    Board
+	Ultimate *UltimateBoard `json:",omitempty"`
+	Round    int
+	Clock    *Clock `json:",omitempty"`
+}
+
 type SwitchServerPayload struct {
 	MasterServer string
 }
 
+type RoomPayload struct {
+	Code string
+}
+
 type PlayerMovePayloadOption func(p *PlayerMovePayload)
 
 func RequestMoveBack() PlayerMovePayloadOption {
@@ -61,14 +113,32 @@ func WithGameResult(gameResultMsg string) PlayerMovePayloadOption {
 	}
 }
 
+func WithClock(clock *Clock) PlayerMovePayloadOption {
+	return func(p *PlayerMovePayload) {
+		p.Clock = clock
+	}
+}
+
 func WithCellType(cellType Cell) PlayerMovePayloadOption {
 	return func(p *PlayerMovePayload) {
 		p.CellType = cellType
 	}
 }
 
+type Preferences struct {
+	Variant       string
+	BotDifficulty BotDifficulty
+	CreateRoom    bool
+	RoomCode      string
+	BestOf        int
+	Rematch       string /* the uuid of the finished game to play again with the colors swapped */
+	Tournament    string /* the id of the tournament to play the next game of */
+}
+
 type Client interface {
 	WriteMessage(msg Message) error
 	ReadMessage() (Message, error)
 	Uuid() string
+	Preferences() Preferences
+	Ping() error /* checks that the connection is still alive while nothing is read from it */
 }
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"time"
+)
+
+type TimeControl struct {
+	Total     time.Duration
+	Increment time.Duration
+	PerMove   time.Duration
+}
+
+type Clock struct {
+	RemainingX time.Duration
+	RemainingO time.Duration
+}
+
+func NewClock(tc *TimeControl) *Clock {
+	if tc == nil || tc.Total <= 0 {
+		return nil
+	}
+	return &Clock{
+		RemainingX: tc.Total,
+		RemainingO: tc.Total,
+	}
+}
+
+func (c *Clock) Remaining(cellType Cell) time.Duration {
+	if cellType == X {
+		return c.RemainingX
+	}
+	return c.RemainingO
+}
+
+/*
+ * TurnLimit returns how long the player may think over the current move, false means no limit.
+ * A drained clock gives no time at all, the move can only be late
+ */
+func (c *Clock) TurnLimit(tc *TimeControl, cellType Cell) (time.Duration, bool) {
+	if tc == nil {
+		return 0, false
+	}
+	var (
+		limit   time.Duration
+		limited bool
+	)
+	if c != nil {
+		limit, limited = max(c.Remaining(cellType), 0), true
+	}
+	if tc.PerMove > 0 && (!limited || tc.PerMove < limit) {
+		limit, limited = tc.PerMove, true
+	}
+	return limit, limited
+}
+
+/* IsLate reports whether the move made after the elapsed time is beyond the limit of the turn, it loses on time */
+func (c *Clock) IsLate(tc *TimeControl, cellType Cell, elapsed time.Duration) bool {
+	limit, limited := c.TurnLimit(tc, cellType)
+	return limited && elapsed > limit
+}
+
+/* Spend charges the elapsed time to the player and adds the increment, a late move isn't charged but loses on time */
+func (c *Clock) Spend(tc *TimeControl, cellType Cell, elapsed time.Duration) {
+	if c == nil {
+		return
+	}
+	remaining := &c.RemainingO
+	if cellType == X {
+		remaining = &c.RemainingX
+	}
+	*remaining = max(*remaining-elapsed, 0) + tc.Increment
+}
+
+func (c *Clock) Clone() *Clock {
+	if c == nil {
+		return nil
+	}
+	v := *c
+	return &v
+}
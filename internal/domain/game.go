@@ -2,14 +2,20 @@ package domain
 
 import (
 	"context"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
+var ErrGameNotFound = errors.New("game not found")
+
 type Cell byte
 
 const (
 	None = Cell(' ')
 	X    = Cell('X')
 	O    = Cell('O')
+	Tie  = Cell('-')
 )
 
 type MoveStatus byte
@@ -22,15 +28,97 @@ const (
 	WinX
 	WinO
 	Disconnect
+	TimeIsUp
+	Resigned
+	DrawOffered
+	DrawAccepted
+	DrawDeclined
+	TakebackRequested
+	TakebackAccepted
+	TakebackDeclined
+	Suspended /* the server has sent the players to another one, it's not a disconnect */
 )
 
 type Move struct {
 	CellType Cell
-	Position byte
+	Position int
 	Status   MoveStatus
 }
 
-type Board [9]Cell
+/* ClockBefore is the clock before the move is charged, it's set back when the move is taken back */
+type MoveRecord struct {
+	PlayerUuid  string
+	CellType    Cell
+	Position    int
+	MadeAt      time.Time
+	ClockBefore *Clock `json:",omitempty"`
+}
+
+type OutcomeReason string
+
+const (
+	ReasonWin       = OutcomeReason("win")
+	ReasonDraw      = OutcomeReason("draw")
+	ReasonWalkover  = OutcomeReason("walkover")
+	ReasonTimeout   = OutcomeReason("timeout")
+	ReasonResign    = OutcomeReason("resign")
+	ReasonAgreement = OutcomeReason("agreement")
+)
+
+/* Outcome of a finished game, Winner is None for a draw */
+type Outcome struct {
+	Winner Cell
+	Reason OutcomeReason
+}
+
+type Board struct {
+	Rows  int
+	Cols  int
+	Cells []Cell
+}
+
+func NewBoard(rows int, cols int) Board {
+	cells := make([]Cell, rows*cols)
+	for i := range cells {
+		cells[i] = None
+	}
+	return Board{
+		Rows:  rows,
+		Cols:  cols,
+		Cells: cells,
+	}
+}
+
+func (b Board) Size() int {
+	return len(b.Cells)
+}
+
+func (b Board) Contains(row int, col int) bool {
+	return row >= 0 && row < b.Rows && col >= 0 && col < b.Cols
+}
+
+func (b Board) At(row int, col int) Cell {
+	return b.Cells[row*b.Cols+col]
+}
+
+func (b Board) IsFull() bool {
+	for _, v := range b.Cells {
+		if v == None {
+			return false
+		}
+	}
+	return true
+}
+
+func (b Board) Clone() Board {
+	cells := make([]Cell, len(b.Cells))
+	copy(cells, b.Cells)
+	return Board{
+		Rows:  b.Rows,
+		Cols:  b.Cols,
+		Cells: cells,
+	}
+}
 
 type status byte
 
@@ -42,16 +130,105 @@ const (
 
 type GameState struct {
 	Board             Board
-	PlayerX           string
+	Ultimate          *UltimateBoard `json:",omitempty"`
+	Variant           string
+	PlayerX           string /* PlayerX and PlayerO are the account ids of the players or the uuids of bots */
 	PlayerO           string
-	RecoveredPlayer   string `json:"-"` /* TODO: `RecoveredPlayer` такой себе нейминг.. другой бы.. */
+	BotDifficulty     BotDifficulty `json:",omitempty"`
+	Owner             string        `json:",omitempty"` /* the server serving the game when games are sharded */
+	TimeControl       *TimeControl  `json:",omitempty"`
+	Clock             *Clock        `json:",omitempty"`
+	RecoveredPlayer   string        `json:"-"` /* TODO: `RecoveredPlayer` такой себе нейминг.. другой бы.. */
 	CurrentMove       Cell
 	Status            status
-	Round             uint8
-	ActivePlayerCount uint8     `json:"-"`
-	MoveChan          chan Move `json:"-"`
+	Round             int
+	Moves             []MoveRecord
+	Outcome           *Outcome `json:",omitempty"`
+	Rated             bool     `json:",omitempty"` /* the game between accounts found by matchmaking or its rematch */
+	Ratings           []Rating `json:",omitempty"` /* the ratings of X and O after the rated game */
+	SeriesId          string   `json:",omitempty"`
+	TournamentId      string   `json:",omitempty"`
+	CreatedAt         time.Time
+	FinishedAt        time.Time
+	ActivePlayerCount uint8         `json:"-"`
+	MoveChan          *MoveChannels `json:"-"`
+	Rules             GameRules     `json:"-"`
+}
+
+/* Clone copies the replicated part of the state, channels and counters of the running game aren't copied */
+func (s *GameState) Clone() *GameState {
+	moves := make([]MoveRecord, len(s.Moves))
+	copy(moves, s.Moves)
+	var outcome *Outcome
+	if s.Outcome != nil {
+		v := *s.Outcome
+		outcome = &v
+	}
+	var ratings []Rating
+	if s.Ratings != nil {
+		ratings = make([]Rating, len(s.Ratings))
+		copy(ratings, s.Ratings)
+	}
+	return &GameState{
+		Board:         s.Board.Clone(),
+		Ultimate:      s.Ultimate.Clone(),
+		Variant:       s.Variant,
+		PlayerX:       s.PlayerX,
+		PlayerO:       s.PlayerO,
+		BotDifficulty: s.BotDifficulty,
+		Owner:         s.Owner,
+		TimeControl:   s.TimeControl,
+		Clock:         s.Clock.Clone(),
+		CurrentMove:   s.CurrentMove,
+		Status:        s.Status,
+		Round:         s.Round,
+		Moves:         moves,
+		Outcome:       outcome,
+		Rated:         s.Rated,
+		Ratings:       ratings,
+		SeriesId:      s.SeriesId,
+		TournamentId:  s.TournamentId,
+		CreatedAt:     s.CreatedAt,
+		FinishedAt:    s.FinishedAt,
+		Rules:         s.Rules,
+	}
+}
+
+type GameRecord struct {
+	GameUuid     string
+	Variant      string
+	PlayerX      string
+	PlayerO      string
+	Status       status
+	Outcome      *Outcome
+	Ratings      []Rating `json:",omitempty"`
+	SeriesId     string   `json:",omitempty"`
+	TournamentId string   `json:",omitempty"`
+	Moves        []MoveRecord
+	CreatedAt    time.Time
+	FinishedAt   time.Time
+}
+
+func NewGameRecord(gameUuid string, state *GameState) GameRecord {
+	v := state.Clone()
+	return GameRecord{
+		GameUuid:     gameUuid,
+		Variant:      v.Variant,
+		PlayerX:      v.PlayerX,
+		PlayerO:      v.PlayerO,
+		Status:       v.Status,
+		Outcome:      v.Outcome,
+		Ratings:      v.Ratings,
+		SeriesId:     v.SeriesId,
+		TournamentId: v.TournamentId,
+		Moves:        v.Moves,
+		CreatedAt:    v.CreatedAt,
+		FinishedAt:   v.FinishedAt,
+	}
 }
 
 type GameUseCase interface {
 	Play(ctx context.Context, player Player, state *GameState) error
+	/* Snapshot copies the state of a game that may be played right now */
+	Snapshot(state *GameState) *GameState
 }
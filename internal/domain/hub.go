@@ -4,8 +4,29 @@ import (
 	"context"
 )
 
+/* HubState is the part of the hub replicated from the master to reserves */
+type HubState struct {
+	Games       map[string]*GameState
+	Rooms       map[string]*Room
+	Accounts    map[string]*Account
+	Ratings     map[string]*Rating
+	Stats       map[string]*PlayerStats
+	Series      map[string]*Series
+	Tournaments map[string]*Tournament
+}
+
 type HubUseCase interface {
 	Handle(ctx context.Context, client Client) error
-	GamesStates() <-chan map[string]*GameState
-	ApplyStates(ctx context.Context, states map[string]*GameState)
+	State() HubState
+	ApplyStates(ctx context.Context, state HubState)
+	ApplyChanges(ctx context.Context, changes []Change)
+	GameRecord(ctx context.Context, gameUuid string) (GameRecord, error)
+	Restore(ctx context.Context) error
+	Spectate(ctx context.Context, gameUuid string, client Client) error
+	Owner(gameUuid string) (string, bool)
+	ActiveGame(clientUuid string) (string, bool)
+	LiveGames() int
+	PlayerStats(accountId string) (StatsEntry, bool)
+	StatsLeaderboard(stat Stat, offset int, limit int) ([]StatsEntry, int)
+	TournamentUseCase
 }
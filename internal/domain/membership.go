@@ -0,0 +1,34 @@
+package domain
+
+import "github.com/pkg/errors"
+
+var ErrUnknownMember = errors.New("the server is not a member of the cluster")
+
+/*
+ * Member is a server of the cluster. Version grows with every change of the entry, so the newer entry wins
+ * when member lists are merged, a member that has left is kept with Left set, see synchronizer
+ */
+type Member struct {
+	Name    string
+	Addr    string
+	Version uint64
+	Left    bool `json:",omitempty"`
+}
+
+type JoinRequest struct {
+	Name string
+	Addr string
+}
+
+type LeaveRequest struct {
+	Name string
+}
+
+type GossipRequest struct {
+	From    string
+	Members []Member
+}
+
+type MembersResponse struct {
+	Members []Member
+}
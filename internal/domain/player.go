@@ -1,20 +1,52 @@
 package domain
 
+const moveChanBufSize = 16
+
+/* MoveChannels are the inboxes of both players of a game: a player reads its own and writes to the enemy's one */
+type MoveChannels struct {
+	X chan Move
+	O chan Move
+}
+
+func NewMoveChannels() *MoveChannels {
+	return &MoveChannels{
+		X: make(chan Move, moveChanBufSize),
+		O: make(chan Move, moveChanBufSize),
+	}
+}
+
+/* the channels are nil for a game served by another server, its players are only sent there */
+func (c *MoveChannels) inbox(cellType Cell) chan Move {
+	if c == nil {
+		return nil
+	}
+	if cellType == X {
+		return c.X
+	}
+	return c.O
+}
+
 type Player struct {
 	uuid      string
 	gameUuid  string
 	playerCli Client
 	cell      Cell
-	ch        chan Move
+	inbox     <-chan Move
+	outbox    chan<- Move
 }
 
-func NewPlayer(gameUuid string, cli Client, cellType Cell, ch chan Move) Player {
+func NewPlayer(gameUuid string, cli Client, cellType Cell, channels *MoveChannels) Player {
+	enemyCell := O
+	if cellType == O {
+		enemyCell = X
+	}
 	return Player{
 		uuid:      cli.Uuid(),
 		gameUuid:  gameUuid,
 		playerCli: cli,
 		cell:      cellType,
-		ch:        ch,
+		inbox:     channels.inbox(cellType),
+		outbox:    channels.inbox(enemyCell),
 	}
 }
 
@@ -39,9 +71,9 @@ func (p Player) Cell() Cell {
 }
 
 func (p Player) GetEnemyMove() <-chan Move {
-	return p.ch
+	return p.inbox
 }
 
 func (p Player) MakeMove(move Move) {
-	p.ch <- move
+	p.outbox <- move
 }
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+/*
+ * Rating is the Glicko-2 rating of an account: Rating and Deviation are on the familiar Elo-like scale,
+ * a new player starts at 1500 with a large deviation, so the first games move the rating a lot.
+ * UpdatedAt is the finish time of the last rated game, an older result never overwrites a newer one
+ */
+type Rating struct {
+	AccountId  string
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+	Games      int
+	UpdatedAt  time.Time
+}
+
+/* RatingEntry is a rating with the name of its account, Rank is the place on the leaderboard */
+type RatingEntry struct {
+	Rank int `json:",omitempty"`
+	Name string
+	Rating
+}
+
+type LeaderboardResponse struct {
+	Entries []RatingEntry
+	Page
+}
+
+type RatingStorage interface {
+	Save(ctx context.Context, rating *Rating) error
+	Delete(ctx context.Context, accountId string) error
+	Load(ctx context.Context) (map[string]*Rating, error)
+}
+
+/* Rater is called by the game usecase when it finalizes the result of a game */
+type Rater interface {
+	Rate(state *GameState)
+}
+
+/*
+ * RatingUseCase rates the games between accounts found by matchmaking. The server playing the game rates it,
+ * the ratings after the game are shipped with the finished game state (GameState.Ratings),
+ * and every server applies them as a listener of the journal or of the replicated changes
+ */
+type RatingUseCase interface {
+	Rater
+	StateCommitter
+	Rating(accountId string) Rating
+	Entry(accountId string) (RatingEntry, bool)
+	Leaderboard(offset int, limit int) ([]RatingEntry, int)
+	Restore(ctx context.Context) error
+	State() map[string]*Rating
+	ApplyStates(ctx context.Context, ratings map[string]*Rating)
+}
@@ -0,0 +1,121 @@
+package domain
+
+import "github.com/pkg/errors"
+
+var (
+	ErrNotLeader          = errors.New("the server is not the master")
+	ErrReplicationTimeout = errors.New("the majority of servers hasn't acknowledged the change in time")
+	ErrNotOwner           = errors.New("the game is owned by another server")
+	ErrSnapshotExpired    = errors.New("the master has replaced the snapshot")
+	ErrSnapshotCorrupted  = errors.New("the snapshot doesn't match its checksum")
+)
+
+type ChangeKind string
+
+const (
+	GameChanged       ChangeKind = "game"
+	GameRemoved       ChangeKind = "game_removed"
+	RoomChanged       ChangeKind = "room"
+	RoomRemoved       ChangeKind = "room_removed"
+	AccountChanged    ChangeKind = "account"
+	SeriesChanged     ChangeKind = "series"
+	SeriesRemoved     ChangeKind = "series_removed"
+	TournamentChanged ChangeKind = "tournament"
+	TournamentRemoved ChangeKind = "tournament_removed"
+)
+
+/* Change is an entry of the replicated log, a changed game, room, account, series or tournament is shipped as a whole */
+type Change struct {
+	Seq          uint64
+	Kind         ChangeKind
+	GameUuid     string      `json:",omitempty"`
+	State        *GameState  `json:",omitempty"`
+	RoomCode     string      `json:",omitempty"`
+	Room         *Room       `json:",omitempty"`
+	Account      *Account    `json:",omitempty"`
+	SeriesId     string      `json:",omitempty"`
+	Series       *Series     `json:",omitempty"`
+	TournamentId string      `json:",omitempty"`
+	Tournament   *Tournament `json:",omitempty"`
+}
+
+type ReplicationLog interface {
+	Append(change Change)
+}
+
+/*
+ * ReplicationRequest ships the changes following PrevSeq of the master's log started in LogTerm.
+ * The log continues the previous one from BaseSeq of the log started in BaseTerm, a reserve at that position
+ * follows the new log as is. The master keeps the changes from FirstSeq to LastSeq, a reserve that follows
+ * another log or needs older changes bootstraps: it downloads a snapshot of the master and then gets the changes
+ * following it. A reserve that has LastSeq is caught up
+ */
+type ReplicationRequest struct {
+	Term     uint64
+	Leader   string
+	LogTerm  uint64
+	BaseTerm uint64
+	BaseSeq  uint64
+	PrevSeq  uint64
+	FirstSeq uint64
+	LastSeq  uint64
+	Changes  []Change `json:",omitempty"`
+}
+
+type ReplicationResponse struct {
+	Term    uint64
+	Success bool
+	LogTerm uint64
+	LastSeq uint64
+}
+
+type SnapshotRequest struct {
+	Term   uint64
+	Server string
+}
+
+/*
+ * SnapshotInfo describes the master's state serialized as of LastSeq of the log started in LogTerm.
+ * The reserve downloads it in Chunks by Id and checks the SHA-256 Checksum of the whole before applying it
+ */
+type SnapshotInfo struct {
+	Term     uint64
+	Success  bool
+	Id       string
+	LogTerm  uint64
+	LastSeq  uint64
+	Size     int
+	Chunks   int
+	Checksum string
+}
+
+type ChunkRequest struct {
+	Term  uint64
+	Id    string
+	Index int
+}
+
+/* Success is false if the server isn't the master or the snapshot has been replaced by a newer one */
+type ChunkResponse struct {
+	Term    uint64
+	Success bool
+	Data    []byte
+}
+
+/* ForwardRequest hands a change of a game the server owns over to the master's log, see ShardRouter */
+type ForwardRequest struct {
+	Term   uint64
+	Server string
+	Change Change
+}
+
+/*
+ * Owner is the owner of the game known to the master, the change is rejected if it's not the sender.
+ * Unacknowledged is set if the master has put the change into its log, but the majority hasn't acknowledged it in time
+ */
+type ForwardResponse struct {
+	Term           uint64
+	Success        bool
+	Owner          string
+	Unacknowledged bool
+}
@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRoomNotFound = errors.New("room not found")
+	ErrRoomTaken    = errors.New("another guest is already waiting in the room")
+)
+
+/* Room is a private game that starts only when a friend joins with the invite code */
+type Room struct {
+	Code      string
+	Owner     string
+	Variant   string
+	BestOf    int `json:",omitempty"`
+	CreatedAt time.Time
+}
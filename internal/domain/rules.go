@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidPosition = errors.New("invalid selected cell position")
+	ErrIllegalMove     = errors.New("illegal move")
+	ErrUnknownVariant  = errors.New("unknown game variant")
+)
+
+type GameRules interface {
+	Variant() string
+	Init(state *GameState)
+	ValidateMove(state *GameState, position int) error
+	LegalMoves(state *GameState) []int
+	ApplyMove(state *GameState, position int, cellType Cell)
+	IsWin(state *GameState, cellType Cell) bool
+	IsDraw(state *GameState) bool
+}
+
+type RulesRegistry interface {
+	Rules(variant string) (GameRules, error)
+	Choose(variant string) (GameRules, error)
+}
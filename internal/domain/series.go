@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrBadBestOf       = errors.New("a series is best of 3 or 5 games")
+	ErrRematchNotFound = errors.New("the game can't be rematched")
+	ErrRematchDeclined = errors.New("the enemy hasn't come back for the rematch")
+)
+
+func ParseBestOf(s string) (int, error) {
+	switch n, _ := strconv.Atoi(s); n {
+	case 3, 5:
+		return n, nil
+	default:
+		return 0, errors.WithMessagef(ErrBadBestOf, "best of '%s'", s)
+	}
+}
+
+type SeriesStatus string
+
+const (
+	SeriesInProgress = SeriesStatus("in_progress")
+	SeriesFinished   = SeriesStatus("finished")
+)
+
+/* SeriesGame is a game of a series, Winner is the account id of the winner, empty for a draw */
+type SeriesGame struct {
+	GameUuid string
+	Finished bool
+	Winner   string `json:",omitempty"`
+}
+
+/*
+ * Series is a run of games between the same players, the colors are swapped every game.
+ * A win scores 1 and a draw 0.5. A best of N series is won by the one who scores more than N/2,
+ * after N games it's drawn on equal scores. BestOf is 0 for the rematches without a limit, they only keep the score.
+ * Winner is empty for a drawn series, Walkover means that the loser hasn't come back for the next game
+ */
+type Series struct {
+	Id        string
+	Players   [2]string
+	Variant   string
+	BestOf    int `json:",omitempty"`
+	Rated     bool
+	Games     []SeriesGame
+	Score     [2]float64
+	Status    SeriesStatus
+	Winner    string `json:",omitempty"`
+	Walkover  bool   `json:",omitempty"`
+	UpdatedAt time.Time
+}
+
+func (s *Series) Clone() *Series {
+	series := *s
+	series.Games = append([]SeriesGame(nil), s.Games...)
+	return &series
+}
+
+/* LastGame returns the uuid of the latest game of the series */
+func (s *Series) LastGame() string {
+	if len(s.Games) == 0 {
+		return ""
+	}
+	return s.Games[len(s.Games)-1].GameUuid
+}
+
+/* index returns the index of the player in Players, -1 if it doesn't play the series */
+func (s *Series) index(player string) int {
+	for i, v := range s.Players {
+		if v == player {
+			return i
+		}
+	}
+	return -1
+}
+
+/* Record scores the finished game, false means that it isn't a game of the series or it's already scored */
+func (s *Series) Record(gameUuid string, winner string, at time.Time) bool {
+	i := -1
+	for j, v := range s.Games {
+		if v.GameUuid == gameUuid {
+			i = j
+		}
+	}
+	if i < 0 || s.Games[i].Finished {
+		return false
+	}
+	s.Games[i].Finished, s.Games[i].Winner = true, winner
+	if j := s.index(winner); j >= 0 {
+		s.Score[j]++
+	} else {
+		s.Score[0] += 0.5
+		s.Score[1] += 0.5
+	}
+	s.UpdatedAt = at
+	if s.BestOf == 0 || s.Status == SeriesFinished {
+		return true
+	}
+	for j, score := range s.Score {
+		if score*2 > float64(s.BestOf) {
+			s.finish(s.Players[j], false)
+			return true
+		}
+	}
+	if i+1 >= s.BestOf {
+		s.finish("", false) /* only a draw is possible after N games without the majority */
+	}
+	return true
+}
+
+/* Forfeit finishes the series in favor of the player who has come back for the next game */
+func (s *Series) Forfeit(winner string, at time.Time) {
+	s.finish(winner, true)
+	s.UpdatedAt = at
+}
+
+func (s *Series) finish(winner string, walkover bool) {
+	s.Status = SeriesFinished
+	s.Winner = winner
+	s.Walkover = walkover
+}
+
+/* SeriesPayload is the score of the series for the player it's sent to, SeriesResult is set once it's over */
+type SeriesPayload struct {
+	SeriesId     string
+	BestOf       int
+	Games        int
+	Score        float64
+	EnemyScore   float64
+	SeriesResult *string `json:",omitempty"`
+}
+
+/* NewSeriesPayload returns the score of the series from the player's side */
+func NewSeriesPayload(s *Series, player string, result *string) SeriesPayload {
+	i := max(s.index(player), 0)
+	return SeriesPayload{
+		SeriesId:     s.Id,
+		BestOf:       s.BestOf,
+		Games:        len(s.Games),
+		Score:        s.Score[i],
+		EnemyScore:   s.Score[1-i],
+		SeriesResult: result,
+	}
+}
+
+type RematchPayload struct {
+	GameUuid string
+}
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+/* TestSeriesRecord plays the games with the winners in order, an empty winner is a draw */
+func TestSeriesRecord(t *testing.T) {
+	tests := []struct {
+		name       string
+		bestOf     int
+		winners    []string
+		wantScore  [2]float64
+		wantStatus SeriesStatus
+		wantWinner string
+	}{
+		{
+			name:       "best of 3 won in two games",
+			bestOf:     3,
+			winners:    []string{"a", "a"},
+			wantScore:  [2]float64{2, 0},
+			wantStatus: SeriesFinished,
+			wantWinner: "a",
+		},
+		{
+			name:       "best of 3 in progress",
+			bestOf:     3,
+			winners:    []string{"a", "b"},
+			wantScore:  [2]float64{1, 1},
+			wantStatus: SeriesInProgress,
+		},
+		{
+			name:       "best of 3 won after draws",
+			bestOf:     3,
+			winners:    []string{"", "", "b"},
+			wantScore:  [2]float64{1, 2},
+			wantStatus: SeriesFinished,
+			wantWinner: "b",
+		},
+		{
+			name:       "best of 3 drawn on equal scores",
+			bestOf:     3,
+			winners:    []string{"a", "b", ""},
+			wantScore:  [2]float64{1.5, 1.5},
+			wantStatus: SeriesFinished,
+		},
+		{
+			name:       "best of 5 isn't won by a half of the games",
+			bestOf:     5,
+			winners:    []string{"a", "", "a"},
+			wantScore:  [2]float64{2.5, 0.5},
+			wantStatus: SeriesInProgress,
+		},
+		{
+			name:       "best of 5 won by the majority",
+			bestOf:     5,
+			winners:    []string{"a", "", "a", "a"},
+			wantScore:  [2]float64{3.5, 0.5},
+			wantStatus: SeriesFinished,
+			wantWinner: "a",
+		},
+		{
+			name:       "rematches only keep the score",
+			winners:    []string{"a", "a", "a", "b"},
+			wantScore:  [2]float64{3, 1},
+			wantStatus: SeriesInProgress,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Series{Players: [2]string{"a", "b"}, BestOf: tt.bestOf, Status: SeriesInProgress}
+			for i, winner := range tt.winners {
+				gameUuid := strconv.Itoa(i)
+				s.Games = append(s.Games, SeriesGame{GameUuid: gameUuid})
+				if !s.Record(gameUuid, winner, time.Now()) {
+					t.Fatalf("game %d isn't recorded", i)
+				}
+			}
+			if s.Score != tt.wantScore || s.Status != tt.wantStatus || s.Winner != tt.wantWinner {
+				t.Fatalf("got score %v, %s, winner '%s', want %v, %s, winner '%s'",
+					s.Score, s.Status, s.Winner, tt.wantScore, tt.wantStatus, tt.wantWinner)
+			}
+		})
+	}
+}
+
+func TestSeriesRecordOnce(t *testing.T) {
+	s := &Series{
+		Players: [2]string{"a", "b"},
+		BestOf:  3,
+		Games:   []SeriesGame{{GameUuid: "0"}},
+		Status:  SeriesInProgress,
+	}
+	if !s.Record("0", "a", time.Now()) {
+		t.Fatalf("the game isn't recorded")
+	}
+	if s.Record("0", "a", time.Now()) {
+		t.Fatalf("the game is recorded twice")
+	}
+	if s.Record("1", "a", time.Now()) {
+		t.Fatalf("a game of another series is recorded")
+	}
+	if s.Score != [2]float64{1, 0} {
+		t.Fatalf("got score %v, want [1 0]", s.Score)
+	}
+}
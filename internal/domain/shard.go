@@ -0,0 +1,14 @@
+package domain
+
+/*
+ * ShardRouter tells where games live when they're sharded across the servers: the master places new games
+ * on the least loaded servers and reassigns the games of failed ones, every server serves the games it owns.
+ * LiveServers and AcceptingServers make sense on the master only, a draining server is live but doesn't accept new games
+ */
+type ShardRouter interface {
+	Sharded() bool
+	ServerName() string
+	MasterName() string
+	LiveServers() []string
+	AcceptingServers() []string
+}
@@ -0,0 +1,11 @@
+package domain
+
+import (
+	"context"
+)
+
+type SpectatorUseCase interface {
+	/* Watch streams the game to a read-only client until the game is over, dropped or the client leaves */
+	Watch(ctx context.Context, gameUuid string, client Client, state *GameState) error
+	Drop(gameUuid string)
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnknownStat = errors.New("unknown leaderboard stat")
+
+/*
+ * PlayerStats sums up the finished games of an account. CurrentStreak is the number of the last games
+ * won in a row (lost if it's negative), a draw breaks it. Moves and Duration add up the games' lengths
+ */
+type PlayerStats struct {
+	AccountId        string
+	Games            int
+	WinsAsX          int
+	WinsAsO          int
+	Losses           int
+	Draws            int
+	WalkoverWins     int
+	WalkoverLosses   int
+	Moves            int
+	Duration         time.Duration
+	CurrentStreak    int
+	LongestWinStreak int
+	LastGameAt       time.Time
+}
+
+/* StatsEntry is what the API returns: the stats with the name of the account and the average game length */
+type StatsEntry struct {
+	Rank            int `json:",omitempty"`
+	Name            string
+	AverageMoves    float64
+	AverageDuration time.Duration
+	PlayerStats
+}
+
+/* Stat is what a stats leaderboard is sorted by */
+type Stat string
+
+const (
+	StatWins   = Stat("wins")
+	StatGames  = Stat("games")
+	StatStreak = Stat("streak")
+)
+
+func ParseStat(s string) (Stat, error) {
+	switch v := Stat(s); v {
+	case StatWins, StatGames, StatStreak:
+		return v, nil
+	default:
+		return "", errors.WithMessagef(ErrUnknownStat, "stat '%s'", s)
+	}
+}
+
+/* Page is a part of a leaderboard, Total is the number of the entries of the whole one */
+type Page struct {
+	Offset int
+	Limit  int
+	Total  int
+}
+
+type StatsLeaderboardResponse struct {
+	Stat    Stat
+	Entries []StatsEntry
+	Page
+}
+
+type StatsStorage interface {
+	Save(ctx context.Context, stats *PlayerStats) error
+	Delete(ctx context.Context, accountId string) error
+	Load(ctx context.Context) (map[string]*PlayerStats, error)
+}
+
+/*
+ * StatsUseCase keeps the stats of the games the hub has removed, the hub records them right before the removal.
+ * The finished games the hub still keeps are passed as recent (sorted by FinishedAt) and counted on the fly,
+ * so every game is counted exactly once and the stats are up to date
+ */
+type StatsUseCase interface {
+	Record(states []*GameState)
+	Persist(ctx context.Context)
+	Stats(accountId string, recent []*GameState) (StatsEntry, bool)
+	Leaderboard(stat Stat, offset int, limit int, recent []*GameState) ([]StatsEntry, int)
+	Restore(ctx context.Context) error
+	State() map[string]*PlayerStats
+	ApplyStates(stats map[string]*PlayerStats)
+}
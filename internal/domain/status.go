@@ -0,0 +1,58 @@
+package domain
+
+import "github.com/pkg/errors"
+
+var (
+	ErrNoSuccessor        = errors.New("there is no server to hand the master role over to")
+	ErrTakeoverRefused    = errors.New("the successor refused to take the master role over")
+	ErrHandoverInProgress = errors.New("the master is already handing its role over")
+	ErrHandoverTimeout    = errors.New("the successor hasn't become the master in time")
+)
+
+/*
+ * NodeStatus is what a server tells about itself. Lag is how many changes of the master's log the server
+ * hasn't applied yet, it's -1 if the server follows another log (it bootstraps) or there is no master.
+ * LiveGames are the games being played on the server, Clients are the connected players and spectators
+ */
+type NodeStatus struct {
+	Name      string
+	Addr      string
+	Role      ServerRole
+	Master    string
+	Epoch     uint64
+	Ready     bool
+	Draining  bool
+	LogTerm   uint64
+	LastSeq   uint64
+	Lag       int64
+	LiveGames int
+	Clients   int
+	Error     string `json:",omitempty"`
+}
+
+/* ClusterStatus gathers the statuses of every member, an unreachable one has only Name, Addr and Error */
+type ClusterStatus struct {
+	Master string
+	Epoch  uint64
+	Nodes  []NodeStatus
+}
+
+/* HandoverRequest asks the master to hand its role over, the most caught up reserve is chosen if Successor is empty */
+type HandoverRequest struct {
+	Successor string
+}
+
+type HandoverResponse struct {
+	Successor string
+}
+
+/* TakeoverRequest asks the successor to start the election right away, without waiting for the master to fail */
+type TakeoverRequest struct {
+	Term   uint64
+	Leader string
+}
+
+type TakeoverResponse struct {
+	Term    uint64
+	Success bool
+}
@@ -0,0 +1,16 @@
+package domain
+
+import (
+	"context"
+)
+
+type GameStorage interface {
+	Save(ctx context.Context, gameUuid string, state *GameState) error
+	Delete(ctx context.Context, gameUuid string) error
+	Load(ctx context.Context) (map[string]*GameState, error)
+}
+
+/* StateCommitter receives a snapshot of a game state every time the game usecase changes it */
+type StateCommitter interface {
+	Commit(ctx context.Context, gameUuid string, state *GameState) error
+}
@@ -11,32 +11,84 @@ const (
 	ReserveServer = ServerRole("reserve")
 )
 
+/*
+ * Term of the election is the cluster epoch: it only grows, every request between servers carries it
+ * and a server rejects requests from lower epochs, so a stale master can't overwrite newer state.
+ * Successor is the server the master hands its role over to, the players are sent there
+ */
 type ServerInfo struct {
 	ServerRole       ServerRole
 	MasterServerName string
+	Term             uint64
+	Successor        string
 }
 
-type DefineMasterRequest struct {
-	InitiatorMasterServerName string
-	MasterToIgnore            string
+/* Ready is false while a reserve hasn't caught up with the master */
+type HealthCheckResponse struct {
+	Role  ServerRole
+	Epoch uint64
+	Ready bool
 }
 
-type DefineMasterResponse struct {
-	MasterServerName string
+/* VoteRequest and HeartbeatRequest are the messages of the master election, see synchronizer */
+type VoteRequest struct {
+	Term      uint64
+	Candidate string
+	LogTerm   uint64
+	LastSeq   uint64
+	PreVote   bool
 }
 
-type HealthCheckResponse struct {
-	Role ServerRole
+type VoteResponse struct {
+	Term    uint64
+	Granted bool
+}
+
+type HeartbeatRequest struct {
+	Term   uint64
+	Leader string
+}
+
+/* a draining reserve tells the master, so that the master doesn't place new games on it */
+type HeartbeatResponse struct {
+	Term     uint64
+	Success  bool
+	Draining bool `json:",omitempty"`
 }
 
 type SyncUseCase interface {
-	Sync(ctx context.Context, statesChan <-chan map[string]*GameState)
+	Sync(ctx context.Context, hub HubUseCase)
 	DefineMasterServer(ctx context.Context)
-	CheckMasterHealth(ctx context.Context) error
 	ServerInfoChan() <-chan ServerInfo
+	Epoch() uint64
+	Ready() bool
+	HandleVote(ctx context.Context, req VoteRequest) VoteResponse
+	HandleHeartbeat(ctx context.Context, req HeartbeatRequest) HeartbeatResponse
+	HandleReplication(ctx context.Context, req ReplicationRequest) ReplicationResponse
+	HandleForward(ctx context.Context, req ForwardRequest) ForwardResponse
+	HandleSnapshot(ctx context.Context, req SnapshotRequest) SnapshotInfo
+	HandleSnapshotChunk(ctx context.Context, req ChunkRequest) ChunkResponse
+	HandleJoin(ctx context.Context, req JoinRequest) MembersResponse
+	HandleLeave(ctx context.Context, req LeaveRequest) (MembersResponse, error)
+	HandleGossip(ctx context.Context, req GossipRequest) MembersResponse
+	Members() []Member
+	NodeStatus() NodeStatus
+	ClusterStatus(ctx context.Context, local NodeStatus) ClusterStatus
+	Handover(ctx context.Context, successor string) (string, error)
+	HandleTakeover(ctx context.Context, req TakeoverRequest) TakeoverResponse
+	Drain(ctx context.Context) (string, error)
 }
 
 type SyncRepository interface {
-	Sync(ctx context.Context, addr string, states map[string]*GameState) error
+	Replicate(ctx context.Context, addr string, req ReplicationRequest) (*ReplicationResponse, error)
 	HealthCheck(ctx context.Context, addr string) (*HealthCheckResponse, error)
+	RequestVote(ctx context.Context, addr string, req VoteRequest) (*VoteResponse, error)
+	Heartbeat(ctx context.Context, addr string, req HeartbeatRequest) (*HeartbeatResponse, error)
+	Forward(ctx context.Context, addr string, req ForwardRequest) (*ForwardResponse, error)
+	Snapshot(ctx context.Context, addr string, req SnapshotRequest) (*SnapshotInfo, error)
+	SnapshotChunk(ctx context.Context, addr string, req ChunkRequest) (*ChunkResponse, error)
+	Join(ctx context.Context, addr string, req JoinRequest) (*MembersResponse, error)
+	Gossip(ctx context.Context, addr string, req GossipRequest) (*MembersResponse, error)
+	NodeStatus(ctx context.Context, addr string) (*NodeStatus, error)
+	Takeover(ctx context.Context, addr string, req TakeoverRequest) (*TakeoverResponse, error)
 }
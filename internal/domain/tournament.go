@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrTournamentNotFound = errors.New("tournament not found")
+	ErrBadTournament      = errors.New("bad tournament")
+	ErrRegistrationClosed = errors.New("the registration to the tournament is closed")
+	ErrTournamentFull     = errors.New("the tournament is full")
+	ErrNotOrganizer       = errors.New("only the organizer may start the tournament")
+	ErrNotEnoughPlayers   = errors.New("a tournament needs at least 2 players")
+	ErrNotRegistered      = errors.New("the player isn't registered to the tournament")
+	ErrTournamentFinished = errors.New("the tournament is over for the player")
+	ErrUnknownFormat      = errors.New("unknown tournament format")
+)
+
+type TournamentFormat string
+
+const (
+	RoundRobin        = TournamentFormat("round_robin")
+	SingleElimination = TournamentFormat("single_elimination")
+)
+
+func ParseTournamentFormat(s string) (TournamentFormat, error) {
+	switch v := TournamentFormat(s); v {
+	case RoundRobin, SingleElimination:
+		return v, nil
+	default:
+		return "", errors.WithMessagef(ErrUnknownFormat, "format '%s'", s)
+	}
+}
+
+type TournamentStatus string
+
+const (
+	TournamentRegistration = TournamentStatus("registration")
+	TournamentInProgress   = TournamentStatus("in_progress")
+	TournamentFinished     = TournamentStatus("finished")
+)
+
+/*
+ * Pairing is a match of a round. PlayerO is empty for a bye, PlayerX goes through it without a game.
+ * Winner is the account id of the winner, empty for a draw. Forfeit means that nobody has come to play the game.
+ * A drawn knockout game is replayed with the colors swapped, Draws counts the replays
+ */
+type Pairing struct {
+	PlayerX  string
+	PlayerO  string `json:",omitempty"`
+	GameUuid string `json:",omitempty"`
+	Finished bool
+	Winner   string `json:",omitempty"`
+	Draws    int    `json:",omitempty"`
+	Forfeit  bool   `json:",omitempty"`
+}
+
+func (p Pairing) IsBye() bool {
+	return p.PlayerO == ""
+}
+
+type TournamentRound struct {
+	Pairings []Pairing
+}
+
+/*
+ * Tournament is run by the master. Players are the seeds once it has started: the registered players
+ * sorted by rating. A round robin has all of its rounds generated at the start, a knockout gets the next round
+ * when the current one is over. Round is the index of the current round
+ */
+type Tournament struct {
+	Id         string
+	Name       string
+	Format     TournamentFormat
+	Variant    string
+	Organizer  string
+	MaxPlayers int `json:",omitempty"`
+	Players    []string
+	Status     TournamentStatus
+	Rounds     []TournamentRound `json:",omitempty"`
+	Round      int
+	Winner     string `json:",omitempty"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (t *Tournament) Clone() *Tournament {
+	tournament := *t
+	tournament.Players = append([]string(nil), t.Players...)
+	tournament.Rounds = make([]TournamentRound, len(t.Rounds))
+	for i, round := range t.Rounds {
+		tournament.Rounds[i].Pairings = append([]Pairing(nil), round.Pairings...)
+	}
+	return &tournament
+}
+
+type CreateTournamentRequest struct {
+	Name       string
+	Format     TournamentFormat
+	Variant    string
+	MaxPlayers int
+}
+
+/*
+ * StandingEntry is a line of the standings: a win scores 1 and a draw 0.5, byes aren't counted.
+ * Eliminated is set for the players knocked out of a knockout tournament
+ */
+type StandingEntry struct {
+	Rank       int
+	AccountId  string
+	Name       string
+	Played     int
+	Wins       int
+	Draws      int
+	Losses     int
+	Points     float64
+	Eliminated bool `json:",omitempty"`
+}
+
+type TournamentResponse struct {
+	Tournament
+	Standings []StandingEntry
+}
+
+type TournamentsResponse struct {
+	Tournaments []Tournament
+}
+
+/* TournamentPayload tells the player about its tournament, Place and Winner are set once it's over for the player */
+type TournamentPayload struct {
+	TournamentId string
+	Round        int
+	Place        int    `json:",omitempty"`
+	Winner       string `json:",omitempty"`
+}
+
+/* TournamentUseCase is served by the hub, the changes are accepted by the master only */
+type TournamentUseCase interface {
+	CreateTournament(ctx context.Context, organizer string, req CreateTournamentRequest) (Tournament, error)
+	JoinTournament(ctx context.Context, tournamentId string, accountId string) error
+	StartTournament(ctx context.Context, tournamentId string, accountId string) error
+	Tournament(tournamentId string) (TournamentResponse, bool)
+	Tournaments() []Tournament
+}
@@ -0,0 +1,54 @@
+package domain
+
+const (
+	AnySubBoard   = -1
+	SubBoardSide  = 3
+	SubBoardCount = SubBoardSide * SubBoardSide
+	subBoardCells = SubBoardSide * SubBoardSide
+)
+
+type UltimateBoard struct {
+	SubBoards []Board
+	NextBoard int
+}
+
+func NewUltimateBoard() *UltimateBoard {
+	subBoards := make([]Board, SubBoardCount)
+	for i := range subBoards {
+		subBoards[i] = NewBoard(SubBoardSide, SubBoardSide)
+	}
+	return &UltimateBoard{
+		SubBoards: subBoards,
+		NextBoard: AnySubBoard,
+	}
+}
+
+func (u *UltimateBoard) Clone() *UltimateBoard {
+	if u == nil {
+		return nil
+	}
+	subBoards := make([]Board, len(u.SubBoards))
+	for i, v := range u.SubBoards {
+		subBoards[i] = v.Clone()
+	}
+	return &UltimateBoard{
+		SubBoards: subBoards,
+		NextBoard: u.NextBoard,
+	}
+}
+
+/* position encodes the sub-board index and the cell inside it: subBoard*9 + cell */
+func LocateUltimate(position int) (subBoard int, cell int) {
+	return position / subBoardCells, position % subBoardCells
+}
+
+/* converts a cell of the whole 9x9 grid to the nested position */
+func UltimatePosition(row int, col int) int {
+	subBoard := (row/SubBoardSide)*SubBoardSide + col/SubBoardSide
+	cell := (row%SubBoardSide)*SubBoardSide + col%SubBoardSide
+	return NestedPosition(subBoard, cell)
+}
+
+func NestedPosition(subBoard int, cell int) int {
+	return subBoard*subBoardCells + cell
+}
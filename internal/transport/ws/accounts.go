@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"cmp"
+	"net/http"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+/* register is served by the master only, a reserve answers 421 with the server to register on */
+func (s *server) register(w http.ResponseWriter, r *http.Request) {
+	creds := domain.Credentials{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&creds); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	session, err := s.accounts.Register(r.Context(), creds)
+	switch {
+	case errors.Is(err, domain.ErrNotLeader):
+		s.misdirected(w)
+		return
+	case errors.Is(err, domain.ErrBadAccountName), errors.Is(err, domain.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, domain.ErrAccountExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		s.logger.Error("register account", zap.Error(err))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	s.writeSession(w, session)
+}
+
+func (s *server) login(w http.ResponseWriter, r *http.Request) {
+	creds := domain.Credentials{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&creds); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	session, err := s.accounts.Login(r.Context(), creds)
+	switch {
+	case errors.Is(err, domain.ErrBadCredentials):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		s.logger.Error("log in", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.writeSession(w, session)
+}
+
+func (s *server) writeSession(w http.ResponseWriter, session domain.Session) {
+	if err := jsoniter.NewEncoder(w).Encode(session); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) misdirected(w http.ResponseWriter) {
+	route := s.routing()
+	server := cmp.Or(route.successor, route.masterHost)
+	if server == "" || server == s.name {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusMisdirectedRequest)
+	if err := jsoniter.NewEncoder(w).Encode(domain.SwitchServerPayload{MasterServer: server}); err != nil {
+		s.logger.Warn(err.Error())
+	}
+}
@@ -0,0 +1,65 @@
+package ws
+
+import (
+	"bytes"
+	"expvar"
+	"io"
+	"net/http"
+
+	"github.com/kiryu-dev/tic-tac-toe/pkg/nodeauth"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+/* rejected requests to the inter-node endpoints by reason, expvar serves them at /debug/vars */
+var rejectedRequests = expvar.NewMap("node_auth_rejected")
+
+/* maxNodeRequestSize bounds the body read before the signature is checked, a batch of the log fits in it */
+const maxNodeRequestSize = 32 << 20
+
+/* authenticated lets through only the requests signed by a server of the cluster */
+func (s *server) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxNodeRequestSize)
+		if !s.auth.Enabled() {
+			handler(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if maxBytesErr := new(http.MaxBytesError); errors.As(err, &maxBytesErr) {
+			rejectedRequests.Add("too_large", 1)
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			s.logger.Warn(err.Error(), zap.String("remote addr", r.RemoteAddr), zap.String("path", r.URL.Path))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			s.logger.Warn(err.Error())
+			return
+		}
+		_ = r.Body.Close()
+		if err := s.auth.Verify(r, body); err != nil {
+			rejectedRequests.Add(rejectReason(err), 1)
+			s.logger.Warn("rejected unauthenticated request", zap.String("remote addr", r.RemoteAddr),
+				zap.String("method", r.Method), zap.String("path", r.URL.Path),
+				zap.String("node", r.Header.Get(nodeauth.NodeHeader)), zap.Error(err))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler(w, r)
+	}
+}
+
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, nodeauth.ErrNotSigned):
+		return "not_signed"
+	case errors.Is(err, nodeauth.ErrBadTimestamp):
+		return "bad_timestamp"
+	case errors.Is(err, nodeauth.ErrReplayed):
+		return "replayed"
+	default:
+		return "bad_signature"
+	}
+}
@@ -1,24 +1,42 @@
 package ws
 
 import (
+	"sync"
+	"time"
+
 	"github.com/gorilla/websocket"
 	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
 	"github.com/pkg/errors"
+	"go.uber.org/atomic"
 )
 
+const pingTimeout = time.Second
+
+/*
+ * writeMu is needed since the server may switch the client to another master while the game writes to it,
+ * switched tells the game that the connection is closed by the server and the player hasn't left
+ */
 type client struct {
-	conn *websocket.Conn
-	uuid string
+	conn     *websocket.Conn
+	uuid     string
+	prefs    domain.Preferences
+	writeMu  *sync.Mutex
+	switched *atomic.Bool
 }
 
-func newClient(conn *websocket.Conn, uuid string) client {
+func newClient(conn *websocket.Conn, uuid string, prefs domain.Preferences) client {
 	return client{
-		conn: conn,
-		uuid: uuid,
+		conn:     conn,
+		uuid:     uuid,
+		prefs:    prefs,
+		writeMu:  &sync.Mutex{},
+		switched: atomic.NewBool(false),
 	}
 }
 
 func (c client) WriteMessage(msg domain.Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
 	if err := c.conn.WriteJSON(msg); err != nil {
 		return errors.WithMessage(err, "websocket conn write json")
 	}
@@ -29,6 +47,8 @@ func (c client) ReadMessage() (domain.Message, error) {
 	var msg domain.Message
 	err := c.conn.ReadJSON(&msg)
 	switch {
+	case err != nil && c.switched.Load():
+		return domain.Message{}, domain.ErrServerSwitched
 	case websocket.IsUnexpectedCloseError(err):
 		return domain.Message{}, domain.ErrConnectionClosed
 	case err != nil:
@@ -37,10 +57,21 @@ func (c client) ReadMessage() (domain.Message, error) {
 	return msg, nil
 }
 
+func (c client) Ping() error {
+	if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingTimeout)); err != nil {
+		return errors.WithMessage(err, "websocket conn write ping")
+	}
+	return nil
+}
+
 func (c client) Uuid() string {
 	return c.uuid
 }
 
+func (c client) Preferences() domain.Preferences {
+	return c.prefs
+}
+
 func (c client) Close() {
 	_ = c.conn.Close()
 }
@@ -1,52 +1,160 @@
 package ws
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
+const anonymousViewerPrefix = "viewer-"
+
 func (s *server) serveWs(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("new connection", zap.String("master host", s.masterHost), zap.Any("role", s.role))
+	route := s.routing()
+	s.logger.Info("new connection", zap.String("master host", route.masterHost), zap.Any("role", route.role))
+	/* the player is the account of the session, the client can't choose whom to play for */
+	clientUuid, err := s.accounts.Authenticate(strings.TrimSpace(r.Header.Get(domain.SessionTokenHeader)))
+	if err != nil {
+		s.logger.Warn("rejected the player", zap.String("remote addr", r.RemoteAddr), zap.Error(err))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	prefs, err := parsePreferences(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		s.logger.Error(err.Error())
 		return
 	}
-	clientUuid := strings.TrimSpace(r.Header.Get(domain.ClientUuidHeader))
-	if clientUuid == "" {
-		s.logger.Warn(fmt.Sprintf("empty '%s' header", domain.ClientUuidHeader))
+	client := newClient(conn, clientUuid, prefs)
+	defer client.Close()
+	gameUuid, _ := s.hub.ActiveGame(clientUuid)
+	switch {
+	case route.role == domain.MasterServer && route.successor != "" && gameUuid == "":
+		s.switchServer(client) /* the master handing its role over takes no new games */
+	case route.role == domain.MasterServer, route.role == domain.ReserveServer && s.owns(route, gameUuid):
+		s.track(client)
+		defer s.untrack(client)
+		if err := s.hub.Handle(r.Context(), client); err != nil {
+			s.logger.Error(err.Error())
+		}
+	case route.role == domain.ReserveServer:
+		s.switchServer(client)
+	default:
+		s.logger.Warn("the client connected before the server role was determined")
+	}
+}
+
+/* a spectator is the account of the session if it has one, otherwise it watches anonymously */
+func (s *server) spectate(w http.ResponseWriter, r *http.Request) {
+	viewerUuid := anonymousViewerPrefix + uuid.NewString()
+	if token := strings.TrimSpace(r.Header.Get(domain.SessionTokenHeader)); token != "" {
+		accountId, err := s.accounts.Authenticate(token)
+		if err != nil {
+			s.logger.Warn("rejected the spectator", zap.String("remote addr", r.RemoteAddr), zap.Error(err))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		viewerUuid = accountId
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error(err.Error())
 		return
 	}
-	client := newClient(conn, clientUuid)
+	client := newClient(conn, viewerUuid, domain.Preferences{})
 	defer client.Close()
-	switch s.role {
-	case domain.ReserveServer:
-		s.logger.Info("request client to switch server", zap.String("master host", s.masterHost))
-		err := client.WriteMessage(domain.Message{
-			Type:    domain.SwitchServer,
-			Payload: domain.SwitchServerPayload{MasterServer: s.masterHost},
-		})
-		if err != nil {
-			s.logger.Error(err.Error())
+	gameUuid := r.PathValue("uuid")
+	route := s.routing()
+	switch {
+	case route.role == domain.MasterServer, route.role == domain.ReserveServer && s.owns(route, gameUuid):
+		s.track(client)
+		defer s.untrack(client)
+		err := s.hub.Spectate(r.Context(), gameUuid, client)
+		if errors.Is(err, domain.ErrGameNotFound) {
+			_ = conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "game not found"))
+			return
 		}
-	case domain.MasterServer:
-		if err := s.hub.Handle(r.Context(), client); err != nil {
+		if err != nil {
 			s.logger.Error(err.Error())
 		}
+	case route.role == domain.ReserveServer:
+		s.switchServer(client)
 	default:
-		s.logger.Warn("the client connected before the server role was determined")
+		s.logger.Warn("the spectator connected before the server role was determined")
+	}
+}
+
+/* owns tells whether the server serves the game itself when games are sharded, it doesn't without the master */
+func (s *server) owns(route routing, gameUuid string) bool {
+	if gameUuid == "" || route.masterHost == "" {
+		return false
+	}
+	owner, ok := s.hub.Owner(gameUuid)
+	return ok && owner != "" && owner == s.name
+}
+
+func (s *server) switchServer(client client) {
+	route := s.routing()
+	server := route.masterHost
+	if route.successor != "" {
+		server = route.successor
+	}
+	s.logger.Info("request client to switch server", zap.String("server", server))
+	err := client.WriteMessage(domain.Message{
+		Type:    domain.SwitchServer,
+		Payload: domain.SwitchServerPayload{MasterServer: server},
+	})
+	if err != nil {
+		s.logger.Error(err.Error())
 	}
 }
 
+func parsePreferences(r *http.Request) (domain.Preferences, error) {
+	prefs := domain.Preferences{
+		Variant:    strings.TrimSpace(r.Header.Get(domain.ClientVariantHeader)),
+		CreateRoom: r.Header.Get(domain.RoomCreateHeader) != "",
+		RoomCode:   strings.ToUpper(strings.TrimSpace(r.Header.Get(domain.RoomCodeHeader))),
+		Rematch:    strings.TrimSpace(r.Header.Get(domain.RematchHeader)),
+		Tournament: strings.TrimSpace(r.Header.Get(domain.TournamentHeader)),
+	}
+	if v := r.Header.Get(domain.BotDifficultyHeader); v != "" {
+		difficulty, err := domain.ParseBotDifficulty(v)
+		if err != nil {
+			return domain.Preferences{}, errors.WithMessagef(err, "parse '%s' header", domain.BotDifficultyHeader)
+		}
+		prefs.BotDifficulty = difficulty
+	}
+	if v := r.Header.Get(domain.SeriesBestOfHeader); v != "" {
+		bestOf, err := domain.ParseBestOf(strings.TrimSpace(v))
+		if err != nil {
+			return domain.Preferences{}, errors.WithMessagef(err, "parse '%s' header", domain.SeriesBestOfHeader)
+		}
+		prefs.BestOf = bestOf
+	}
+	return prefs, nil
+}
+
+/* a reserve that hasn't caught up with the master answers 503, so it isn't considered ready */
 func (s *server) healthCheck(w http.ResponseWriter, _ *http.Request) {
 	s.logger.Info("health checking...")
 	resp := domain.HealthCheckResponse{
-		Role: s.role,
+		Role:  s.routing().role,
+		Epoch: s.sync.Epoch(),
+		Ready: s.sync.Ready(),
+	}
+	if !resp.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
 	}
 	if err := jsoniter.NewEncoder(w).Encode(resp); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -54,13 +162,230 @@ func (s *server) healthCheck(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
-func (s *server) applyStates(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("sync states")
-	req := make(map[string]*domain.GameState)
+func (s *server) replicate(w http.ResponseWriter, r *http.Request) {
+	req := domain.ReplicationRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.HandleReplication(r.Context(), req)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) forward(w http.ResponseWriter, r *http.Request) {
+	req := domain.ForwardRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.HandleForward(r.Context(), req)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) snapshot(w http.ResponseWriter, r *http.Request) {
+	req := domain.SnapshotRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.HandleSnapshot(r.Context(), req)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) snapshotChunk(w http.ResponseWriter, r *http.Request) {
+	req := domain.ChunkRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.HandleSnapshotChunk(r.Context(), req)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) vote(w http.ResponseWriter, r *http.Request) {
+	req := domain.VoteRequest{}
 	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		s.logger.Warn(err.Error())
 		return
 	}
-	s.hub.ApplyStates(r.Context(), req)
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.HandleVote(r.Context(), req)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) heartbeat(w http.ResponseWriter, r *http.Request) {
+	req := domain.HeartbeatRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.HandleHeartbeat(r.Context(), req)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) members(w http.ResponseWriter, _ *http.Request) {
+	if err := jsoniter.NewEncoder(w).Encode(domain.MembersResponse{Members: s.sync.Members()}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) join(w http.ResponseWriter, r *http.Request) {
+	req := domain.JoinRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	if req.Name == "" || req.Addr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.HandleJoin(r.Context(), req)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) leave(w http.ResponseWriter, r *http.Request) {
+	req := domain.LeaveRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	resp, err := s.sync.HandleLeave(r.Context(), req)
+	if errors.Is(err, domain.ErrUnknownMember) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(resp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) gossip(w http.ResponseWriter, r *http.Request) {
+	req := domain.GossipRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.HandleGossip(r.Context(), req)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) takeover(w http.ResponseWriter, r *http.Request) {
+	req := domain.TakeoverRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.HandleTakeover(r.Context(), req)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) nodeStatus(w http.ResponseWriter, _ *http.Request) {
+	if err := jsoniter.NewEncoder(w).Encode(s.localStatus()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) clusterStatus(w http.ResponseWriter, r *http.Request) {
+	if err := jsoniter.NewEncoder(w).Encode(s.sync.ClusterStatus(r.Context(), s.localStatus())); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) localStatus() domain.NodeStatus {
+	status := s.sync.NodeStatus()
+	status.LiveGames = s.hub.LiveGames()
+	status.Clients = s.clientCount()
+	return status
+}
+
+func (s *server) handover(w http.ResponseWriter, r *http.Request) {
+	req := domain.HandoverRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	successor, err := s.sync.Handover(r.Context(), req.Successor)
+	if err != nil {
+		s.logger.Warn("hand the master role over", zap.Error(err))
+		w.WriteHeader(handoverStatus(err))
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(domain.HandoverResponse{Successor: successor}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) drain(w http.ResponseWriter, r *http.Request) {
+	successor, err := s.sync.Drain(r.Context())
+	if err != nil {
+		s.logger.Warn("hand the master role over before draining", zap.Error(err))
+		w.WriteHeader(handoverStatus(err))
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(domain.HandoverResponse{Successor: successor}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func handoverStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrNotLeader), errors.Is(err, domain.ErrHandoverInProgress):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrUnknownMember):
+		return http.StatusNotFound
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+func (s *server) gameRecord(w http.ResponseWriter, r *http.Request) {
+	gameUuid := r.PathValue("uuid")
+	record, err := s.hub.GameRecord(r.Context(), gameUuid)
+	switch {
+	case errors.Is(err, domain.ErrGameNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(record); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
 }
@@ -0,0 +1,62 @@
+package ws
+
+import (
+	"net/http"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+)
+
+const (
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+)
+
+func (s *server) rating(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.ratings.Entry(r.PathValue("account"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(entry); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+/* leaderboard returns a page of the best rated players */
+func (s *server) leaderboard(w http.ResponseWriter, r *http.Request) {
+	page, ok := parsePage(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp := domain.LeaderboardResponse{Page: page}
+	resp.Entries, resp.Total = s.ratings.Leaderboard(page.Offset, page.Limit)
+	if err := jsoniter.NewEncoder(w).Encode(resp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+/* parsePage reads ?offset= and ?limit= of a leaderboard, the limit is up to maxLeaderboardLimit */
+func parsePage(r *http.Request) (domain.Page, bool) {
+	page := domain.Page{Limit: defaultLeaderboardLimit}
+	query := r.URL.Query()
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return domain.Page{}, false
+		}
+		page.Offset = n
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return domain.Page{}, false
+		}
+		page.Limit = min(n, maxLeaderboardLimit)
+	}
+	return page, true
+}
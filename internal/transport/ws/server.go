@@ -4,36 +4,61 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/kiryu-dev/tic-tac-toe/pkg/nodeauth"
 	"go.uber.org/zap"
 )
 
-type server struct {
-	srv        *http.Server
-	hub        domain.HubUseCase
-	sync       domain.SyncUseCase
+const handoverTimeout = 10 * time.Second
+
+/* routing is where the server sends the clients, it's changed by the server info and read by every handler */
+type routing struct {
 	role       domain.ServerRole
 	masterHost string
-	upgrader   websocket.Upgrader
-	logger     *zap.Logger
-	done       chan struct{}
+	successor  string /* the server the master hands its role over to */
+}
+
+type server struct {
+	srv       *http.Server
+	name      string
+	hub       domain.HubUseCase
+	sync      domain.SyncUseCase
+	accounts  domain.AccountUseCase
+	ratings   domain.RatingUseCase
+	auth      *nodeauth.Authenticator
+	route     routing
+	routeMu   *sync.RWMutex
+	upgrader  websocket.Upgrader
+	clients   map[*websocket.Conn]client
+	clientsMu *sync.Mutex
+	logger    *zap.Logger
+	done      chan struct{}
 }
 
-func New(hub domain.HubUseCase, sync domain.SyncUseCase, logger *zap.Logger) *server {
+func New(hub domain.HubUseCase, syncUseCase domain.SyncUseCase, accounts domain.AccountUseCase,
+	ratings domain.RatingUseCase, auth *nodeauth.Authenticator, logger *zap.Logger) *server {
 	return &server{
-		srv:  &http.Server{Addr: os.Getenv("SERVER_PORT")},
-		hub:  hub,
-		sync: sync,
+		srv:      &http.Server{Addr: os.Getenv("SERVER_PORT")},
+		name:     os.Getenv("SERVER_NAME"),
+		hub:      hub,
+		sync:     syncUseCase,
+		accounts: accounts,
+		ratings:  ratings,
+		auth:     auth,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Пропускаем любой запрос
 			},
 		},
-		logger: logger,
-		done:   make(chan struct{}),
+		routeMu:   &sync.RWMutex{},
+		clients:   make(map[*websocket.Conn]client),
+		clientsMu: &sync.Mutex{},
+		logger:    logger,
+		done:      make(chan struct{}),
 	}
 }
 
@@ -46,16 +71,32 @@ func (s *server) ListenAndServe(ctx context.Context) {
 		}
 	}()
 	time.Sleep(3 * time.Second)
-	go s.sync.Sync(ctx, s.hub.GamesStates())
+	go s.sync.Sync(ctx, s.hub)
 	go s.sync.DefineMasterServer(ctx)
 	for {
 		select {
 		case info := <-s.sync.ServerInfoChan():
 			s.logger.Info("server info", zap.Any("info", info))
-			s.masterHost = info.MasterServerName
-			s.role = info.ServerRole
-			if err := s.sync.CheckMasterHealth(ctx); err != nil {
-				s.logger.Error(err.Error())
+			route := routing{
+				role:       info.ServerRole,
+				masterHost: info.MasterServerName,
+				successor:  info.Successor,
+			}
+			s.routeMu.Lock()
+			wasMaster := s.route.role == domain.MasterServer
+			s.route = route
+			s.routeMu.Unlock()
+			switch {
+			case wasMaster && route.role != domain.MasterServer && route.successor != "":
+				s.logger.Info("handed the master role over", zap.String("successor", route.successor),
+					zap.Uint64("epoch", info.Term))
+				s.switchClients()
+			case wasMaster && route.role != domain.MasterServer:
+				s.logger.Warn("demoted to reserve", zap.Uint64("epoch", info.Term))
+				s.switchClients()
+			case route.role != domain.MasterServer && route.masterHost == "":
+				/* the games of a reserve owning them are going to be reassigned by the master */
+				s.switchClients()
 			}
 		case <-s.done:
 			return
@@ -63,13 +104,94 @@ func (s *server) ListenAndServe(ctx context.Context) {
 	}
 }
 
+func (s *server) routing() routing {
+	s.routeMu.RLock()
+	defer s.routeMu.RUnlock()
+	return s.route
+}
+
+func (s *server) track(c client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	s.clients[c.conn] = c
+}
+
+func (s *server) clientCount() int {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	return len(s.clients)
+}
+
+func (s *server) untrack(c client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	delete(s.clients, c.conn)
+}
+
+/*
+ * switchClients sends the connected players and spectators to the new master (or the successor) and drops them.
+ * Everyone is told before anyone is dropped, otherwise a player would get a walkover for the enemy's dropped connection
+ */
+func (s *server) switchClients() {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	for _, c := range s.clients {
+		c.switched.Store(true)
+		s.switchServer(c)
+	}
+	for conn, c := range s.clients {
+		c.Close()
+		delete(s.clients, conn)
+	}
+}
+
+/* Shutdown hands the master role over first, so the players are sent to the successor instead of being dropped */
 func (s *server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), handoverTimeout)
+	defer cancel()
+	successor, err := s.sync.Drain(ctx)
+	switch {
+	case err != nil:
+		s.logger.Warn("hand the master role over before shutting down", zap.Error(err))
+	case successor != "":
+		s.routeMu.Lock()
+		s.route.successor = successor
+		s.routeMu.Unlock()
+		s.switchClients()
+	}
 	s.done <- struct{}{}
 	return s.srv.Shutdown(context.Background())
 }
 
 func (s *server) initRoutes() {
 	http.HandleFunc("/game", s.serveWs)
-	http.HandleFunc("GET /health", s.healthCheck)
-	http.HandleFunc("POST /sync", s.applyStates)
+	http.HandleFunc("POST /accounts/register", s.register)
+	http.HandleFunc("POST /accounts/login", s.login)
+	http.HandleFunc("GET /health", s.authenticated(s.healthCheck))
+	http.HandleFunc("POST /sync", s.authenticated(s.replicate))
+	http.HandleFunc("POST /sync/forward", s.authenticated(s.forward))
+	http.HandleFunc("POST /sync/snapshot", s.authenticated(s.snapshot))
+	http.HandleFunc("POST /sync/snapshot/chunk", s.authenticated(s.snapshotChunk))
+	http.HandleFunc("POST /election/vote", s.authenticated(s.vote))
+	http.HandleFunc("POST /election/heartbeat", s.authenticated(s.heartbeat))
+	http.HandleFunc("GET /cluster/members", s.authenticated(s.members))
+	http.HandleFunc("POST /cluster/join", s.authenticated(s.join))
+	http.HandleFunc("POST /cluster/leave", s.authenticated(s.leave))
+	http.HandleFunc("POST /cluster/gossip", s.authenticated(s.gossip))
+	http.HandleFunc("POST /election/takeover", s.authenticated(s.takeover))
+	http.HandleFunc("GET /cluster/node", s.authenticated(s.nodeStatus))
+	http.HandleFunc("GET /cluster/status", s.authenticated(s.clusterStatus))
+	http.HandleFunc("POST /cluster/handover", s.authenticated(s.handover))
+	http.HandleFunc("POST /cluster/drain", s.authenticated(s.drain))
+	http.HandleFunc("GET /games/{uuid}", s.gameRecord)
+	http.HandleFunc("GET /spectate/{uuid}", s.spectate)
+	http.HandleFunc("GET /ratings/{account}", s.rating)
+	http.HandleFunc("GET /leaderboard", s.leaderboard)
+	http.HandleFunc("GET /players/{account}/stats", s.playerStats)
+	http.HandleFunc("GET /leaderboard/{stat}", s.statsLeaderboard)
+	http.HandleFunc("POST /tournaments", s.createTournament)
+	http.HandleFunc("GET /tournaments", s.tournaments)
+	http.HandleFunc("GET /tournaments/{id}", s.tournament)
+	http.HandleFunc("POST /tournaments/{id}/players", s.joinTournament)
+	http.HandleFunc("POST /tournaments/{id}/start", s.startTournament)
 }
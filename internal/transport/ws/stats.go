@@ -0,0 +1,40 @@
+package ws
+
+import (
+	"net/http"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+)
+
+func (s *server) playerStats(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.hub.PlayerStats(r.PathValue("account"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(entry); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+/* statsLeaderboard returns a page of the players sorted by wins, games or the longest win streak */
+func (s *server) statsLeaderboard(w http.ResponseWriter, r *http.Request) {
+	stat, err := domain.ParseStat(r.PathValue("stat"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, ok := parsePage(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp := domain.StatsLeaderboardResponse{Stat: stat, Page: page}
+	resp.Entries, resp.Total = s.hub.StatsLeaderboard(stat, page.Offset, page.Limit)
+	if err := jsoniter.NewEncoder(w).Encode(resp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
@@ -0,0 +1,110 @@
+package ws
+
+import (
+	"net/http"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+/*
+ * the hub changes the tournaments on the master only, on another server it returns domain.ErrNotLeader,
+ * and the handlers answer 421 with the address of the master like on registration (503 while there's none)
+ */
+func (s *server) createTournament(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := s.sessionAccount(w, r)
+	if !ok {
+		return
+	}
+	req := domain.CreateTournamentRequest{}
+	if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.logger.Warn(err.Error())
+		return
+	}
+	tournament, err := s.hub.CreateTournament(r.Context(), accountId, req)
+	if !s.handleTournamentError(w, err) {
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	if err := jsoniter.NewEncoder(w).Encode(tournament); err != nil {
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) joinTournament(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := s.sessionAccount(w, r)
+	if !ok {
+		return
+	}
+	if s.handleTournamentError(w, s.hub.JoinTournament(r.Context(), r.PathValue("id"), accountId)) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *server) startTournament(w http.ResponseWriter, r *http.Request) {
+	accountId, ok := s.sessionAccount(w, r)
+	if !ok {
+		return
+	}
+	if s.handleTournamentError(w, s.hub.StartTournament(r.Context(), r.PathValue("id"), accountId)) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+/* tournament returns the tournament with its rounds and the standings */
+func (s *server) tournament(w http.ResponseWriter, r *http.Request) {
+	resp, ok := s.hub.Tournament(r.PathValue("id"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := jsoniter.NewEncoder(w).Encode(resp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) tournaments(w http.ResponseWriter, _ *http.Request) {
+	resp := domain.TournamentsResponse{Tournaments: s.hub.Tournaments()}
+	if err := jsoniter.NewEncoder(w).Encode(resp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn(err.Error())
+	}
+}
+
+func (s *server) sessionAccount(w http.ResponseWriter, r *http.Request) (string, bool) {
+	accountId, err := s.accounts.Authenticate(strings.TrimSpace(r.Header.Get(domain.SessionTokenHeader)))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+	return accountId, true
+}
+
+/* handleTournamentError answers the error of a change of the tournament, false means that it's been answered */
+func (s *server) handleTournamentError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, domain.ErrNotLeader):
+		s.misdirected(w)
+	case errors.Is(err, domain.ErrBadTournament), errors.Is(err, domain.ErrUnknownFormat),
+		errors.Is(err, domain.ErrUnknownVariant):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrNotOrganizer):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, domain.ErrTournamentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, domain.ErrRegistrationClosed), errors.Is(err, domain.ErrTournamentFull),
+		errors.Is(err, domain.ErrNotEnoughPlayers):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		s.logger.Error("change tournament", zap.Error(err))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return false
+}
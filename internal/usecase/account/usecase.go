@@ -0,0 +1,227 @@
+package account
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/kiryu-dev/tic-tac-toe/pkg/session"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordBytes  = 72 /* bcrypt ignores the rest */
+)
+
+var namePattern = regexp.MustCompile(`^[\p{L}\p{N}_-]{3,32}$`)
+
+/*
+ * useCase keeps the accounts of the players. The master registers them and ships them through the log,
+ * every server stores its copy, so a player logs in anywhere. Names are unique regardless of the case
+ */
+type useCase struct {
+	storage   domain.AccountStorage
+	committer domain.AccountCommitter
+	sessions  *session.Issuer
+	accounts  map[string]*domain.Account
+	idByName  map[string]string
+	mu        *sync.RWMutex
+	logger    *zap.Logger
+}
+
+func New(storage domain.AccountStorage, committer domain.AccountCommitter, sessions *session.Issuer,
+	logger *zap.Logger) *useCase {
+	return &useCase{
+		storage:   storage,
+		committer: committer,
+		sessions:  sessions,
+		accounts:  make(map[string]*domain.Account),
+		idByName:  make(map[string]string),
+		mu:        &sync.RWMutex{},
+		logger:    logger,
+	}
+}
+
+/*
+ * Register creates the account on the master. The name is taken before the account is committed,
+ * so two players can't register it at once; it's released if the account doesn't get into the log.
+ * An account the majority hasn't acknowledged in time is in the master's log already, so it's kept
+ * and reaches the reserves with the next changes
+ */
+func (u *useCase) Register(ctx context.Context, creds domain.Credentials) (domain.Session, error) {
+	name := strings.TrimSpace(creds.Name)
+	if !namePattern.MatchString(name) {
+		return domain.Session{}, domain.ErrBadAccountName
+	}
+	if utf8.RuneCountInString(creds.Password) < minPasswordLength || len(creds.Password) > maxPasswordBytes {
+		return domain.Session{}, domain.ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return domain.Session{}, errors.WithMessage(err, "hash password")
+	}
+	account := &domain.Account{
+		Id:           uuid.NewString(),
+		Name:         name,
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
+	}
+	u.mu.Lock()
+	if _, ok := u.idByName[nameKey(name)]; ok {
+		u.mu.Unlock()
+		return domain.Session{}, errors.WithMessagef(domain.ErrAccountExists, "account '%s'", name)
+	}
+	u.add(account)
+	u.mu.Unlock()
+
+	err = u.committer.CommitAccount(ctx, account)
+	switch {
+	case errors.Is(err, domain.ErrReplicationTimeout):
+		u.logger.Warn("account isn't acknowledged by the majority in time, it's kept in the log",
+			zap.String("account id", account.Id), zap.Error(err))
+	case err != nil:
+		u.mu.Lock()
+		u.remove(account)
+		u.mu.Unlock()
+		return domain.Session{}, errors.WithMessage(err, "commit account")
+	}
+	if err = u.storage.Save(ctx, account); err != nil {
+		u.logger.Error("save account", zap.String("account id", account.Id), zap.Error(err))
+	}
+	u.logger.Info("account registered", zap.String("account id", account.Id), zap.String("name", name))
+	return u.newSession(account)
+}
+
+func (u *useCase) Login(_ context.Context, creds domain.Credentials) (domain.Session, error) {
+	u.mu.RLock()
+	account, ok := u.accounts[u.idByName[nameKey(strings.TrimSpace(creds.Name))]]
+	u.mu.RUnlock()
+	if !ok {
+		return domain.Session{}, domain.ErrBadCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword(account.PasswordHash, []byte(creds.Password)); err != nil {
+		return domain.Session{}, domain.ErrBadCredentials
+	}
+	return u.newSession(account)
+}
+
+/* Authenticate returns the account id of the session, the signature is enough, so a lagging reserve lets it in */
+func (u *useCase) Authenticate(token string) (string, error) {
+	if token == "" {
+		return "", domain.ErrUnauthenticated
+	}
+	accountId, err := u.sessions.Verify(token)
+	if err != nil {
+		return "", errors.WithMessagef(domain.ErrUnauthenticated, "%v", err)
+	}
+	return accountId, nil
+}
+
+func (u *useCase) Name(accountId string) (string, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	account, ok := u.accounts[accountId]
+	if !ok {
+		return "", false
+	}
+	return account.Name, true
+}
+
+func (u *useCase) newSession(account *domain.Account) (domain.Session, error) {
+	token, expiresAt, err := u.sessions.Issue(account.Id)
+	if err != nil {
+		return domain.Session{}, errors.WithMessage(err, "issue session token")
+	}
+	return domain.Session{
+		AccountId: account.Id,
+		Name:      account.Name,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+/* Restore loads the accounts saved before the restart */
+func (u *useCase) Restore(ctx context.Context) error {
+	accounts, err := u.storage.Load(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "load accounts")
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, account := range accounts {
+		u.add(account)
+	}
+	u.logger.Info("restored accounts", zap.Int("count", len(accounts)))
+	return nil
+}
+
+func (u *useCase) State() map[string]*domain.Account {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	accounts := make(map[string]*domain.Account, len(u.accounts))
+	for id, v := range u.accounts {
+		account := *v
+		accounts[id] = &account
+	}
+	return accounts
+}
+
+/* ApplyStates replaces the accounts with the master's ones, the accounts the master doesn't know are dropped */
+func (u *useCase) ApplyStates(ctx context.Context, accounts map[string]*domain.Account) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id, account := range u.accounts {
+		if _, ok := accounts[id]; ok {
+			continue
+		}
+		u.remove(account)
+		if err := u.storage.Delete(ctx, id); err != nil {
+			u.logger.Error("delete stored account", zap.String("account id", id), zap.Error(err))
+		}
+	}
+	for _, account := range accounts {
+		u.apply(ctx, account)
+	}
+}
+
+func (u *useCase) ApplyAccount(ctx context.Context, account *domain.Account) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.apply(ctx, account)
+}
+
+/* apply is called under the lock */
+func (u *useCase) apply(ctx context.Context, account *domain.Account) {
+	if prev, ok := u.accounts[account.Id]; ok {
+		u.remove(prev)
+	}
+	u.add(account)
+	if err := u.storage.Save(ctx, account); err != nil {
+		u.logger.Error("save replicated account", zap.String("account id", account.Id), zap.Error(err))
+	}
+}
+
+/* add and remove are called under the lock */
+func (u *useCase) add(account *domain.Account) {
+	u.accounts[account.Id] = account
+	u.idByName[nameKey(account.Name)] = account.Id
+}
+
+func (u *useCase) remove(account *domain.Account) {
+	delete(u.accounts, account.Id)
+	if u.idByName[nameKey(account.Name)] == account.Id {
+		delete(u.idByName, nameKey(account.Name))
+	}
+}
+
+func nameKey(name string) string {
+	return strings.ToLower(name)
+}
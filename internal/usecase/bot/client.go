@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"sync"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/kiryu-dev/tic-tac-toe/pkg/utils"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const movesBufSize = 16
+
+type provider struct {
+	rules  domain.RulesRegistry
+	logger *zap.Logger
+}
+
+func New(rules domain.RulesRegistry, logger *zap.Logger) provider {
+	return provider{
+		rules:  rules,
+		logger: logger,
+	}
+}
+
+func (p provider) NewBot(botUuid string, variant string, difficulty domain.BotDifficulty) domain.Client {
+	return &client{
+		uuid:       botUuid,
+		variant:    variant,
+		difficulty: difficulty,
+		rules:      p.rules,
+		strategy:   newStrategy(difficulty),
+		moves:      make(chan domain.Message, movesBufSize),
+		done:       make(chan struct{}),
+		once:       &sync.Once{},
+		logger:     p.logger,
+	}
+}
+
+/*
+ * client is a server-side player: it keeps its own copy of the game state,
+ * updated from the messages the game usecase sends to it, and answers every move request
+ */
+type client struct {
+	uuid       string
+	variant    string
+	difficulty domain.BotDifficulty
+	rules      domain.RulesRegistry
+	strategy   strategy
+	state      domain.GameState
+	cellType   domain.Cell
+	moves      chan domain.Message
+	done       chan struct{}
+	once       *sync.Once
+	logger     *zap.Logger
+}
+
+func (c *client) WriteMessage(msg domain.Message) error {
+	switch msg.Type {
+	case domain.StartGame:
+		v, err := utils.UnmarshalJson[domain.StartGamePayload](msg.Payload)
+		if err != nil {
+			return errors.WithMessage(err, "unmarshal json to 'StartGamePayload' type")
+		}
+		rules, err := c.rules.Rules(v.Variant)
+		if err != nil {
+			return errors.WithMessage(err, "resolve game rules")
+		}
+		c.cellType = v.CellType
+		c.state = domain.GameState{
+			Board:    v.Board,
+			Ultimate: v.Ultimate,
+			Variant:  v.Variant,
+			Round:    v.Round,
+			Rules:    rules,
+		}
+	case domain.RequestMove:
+		c.makeMove()
+	case domain.PlayerMove:
+		v, err := utils.UnmarshalJson[domain.PlayerMovePayload](msg.Payload)
+		if err != nil {
+			return errors.WithMessage(err, "unmarshal json to 'PlayerMovePayload' type")
+		}
+		c.state.Rules.ApplyMove(&c.state, v.Position, v.CellType)
+		c.state.Round++
+		if v.GameResult != nil {
+			c.Close()
+			return nil
+		}
+		if v.IsMoveRequested {
+			c.makeMove()
+		}
+	case domain.AcceptTakeback:
+		v, err := utils.UnmarshalJson[domain.TakebackPayload](msg.Payload)
+		if err != nil {
+			return errors.WithMessage(err, "unmarshal json to 'TakebackPayload' type")
+		}
+		c.state.Board = v.Board
+		c.state.Ultimate = v.Ultimate
+		c.state.Round = v.Round
+	case domain.OfferDraw:
+		c.send(domain.Message{Type: domain.DeclineDraw})
+	case domain.RequestTakeback:
+		/* the weak bots are forgiving, the strong ones are not */
+		if c.difficulty == domain.EasyBot || c.difficulty == domain.MediumBot {
+			c.send(domain.Message{Type: domain.AcceptTakeback})
+			break
+		}
+		c.send(domain.Message{Type: domain.DeclineTakeback})
+	case domain.Walkover, domain.TimeOut, domain.GameOver:
+		c.Close()
+	}
+	return nil
+}
+
+func (c *client) makeMove() {
+	pos, ok := c.strategy.choose(&c.state, c.cellType)
+	if !ok {
+		c.logger.Warn("bot has no legal moves", zap.String("bot uuid", c.uuid))
+		return
+	}
+	c.send(domain.Message{
+		Type: domain.PlayerMove,
+		Payload: domain.PlayerMovePayload{
+			CellType: c.cellType,
+			Position: pos,
+		},
+	})
+}
+
+func (c *client) send(msg domain.Message) {
+	select {
+	case c.moves <- msg:
+	case <-c.done:
+	}
+}
+
+func (c *client) ReadMessage() (domain.Message, error) {
+	select {
+	case msg := <-c.moves:
+		return msg, nil
+	case <-c.done:
+		return domain.Message{}, domain.ErrConnectionClosed
+	}
+}
+
+func (c *client) Uuid() string {
+	return c.uuid
+}
+
+func (c *client) Preferences() domain.Preferences {
+	return domain.Preferences{
+		Variant:       c.variant,
+		BotDifficulty: c.difficulty,
+	}
+}
+
+func (c *client) Ping() error {
+	select {
+	case <-c.done:
+		return domain.ErrConnectionClosed
+	default:
+		return nil
+	}
+}
+
+func (c *client) Close() {
+	c.once.Do(func() {
+		close(c.done)
+	})
+}
@@ -0,0 +1,179 @@
+package bot
+
+import (
+	"math"
+	"math/rand/v2"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+)
+
+const (
+	winScore          = 1000
+	hardDepth         = 2
+	perfectDepth      = 4
+	unlimitedDepth    = math.MaxInt
+	smallBoardSize    = 9
+	neighbourhoodSize = 1
+)
+
+type strategy interface {
+	choose(state *domain.GameState, cellType domain.Cell) (int, bool)
+}
+
+func newStrategy(difficulty domain.BotDifficulty) strategy {
+	switch difficulty {
+	case domain.EasyBot:
+		return randomStrategy{}
+	case domain.MediumBot:
+		return greedyStrategy{}
+	case domain.HardBot:
+		return minimaxStrategy{depth: hardDepth}
+	default:
+		return minimaxStrategy{depth: unlimitedDepth}
+	}
+}
+
+type randomStrategy struct{}
+
+func (randomStrategy) choose(state *domain.GameState, _ domain.Cell) (int, bool) {
+	moves := state.Rules.LegalMoves(state)
+	if len(moves) == 0 {
+		return 0, false
+	}
+	return moves[rand.IntN(len(moves))], true
+}
+
+/* greedyStrategy wins immediately if it can, blocks the opponent's immediate win, otherwise plays randomly */
+type greedyStrategy struct{}
+
+func (greedyStrategy) choose(state *domain.GameState, cellType domain.Cell) (int, bool) {
+	moves := state.Rules.LegalMoves(state)
+	if len(moves) == 0 {
+		return 0, false
+	}
+	for _, cell := range []domain.Cell{cellType, opponent(cellType)} {
+		for _, pos := range moves {
+			next := cloneState(state)
+			next.Rules.ApplyMove(next, pos, cell)
+			if next.Rules.IsWin(next, cell) {
+				return pos, true
+			}
+		}
+	}
+	return moves[rand.IntN(len(moves))], true
+}
+
+/*
+ * minimaxStrategy searches the game tree with alpha-beta pruning.
+ * The search is exhaustive on the classic board; on bigger boards the depth is capped
+ * and only cells next to already occupied ones are considered.
+ */
+type minimaxStrategy struct {
+	depth int
+}
+
+func (s minimaxStrategy) choose(state *domain.GameState, cellType domain.Cell) (int, bool) {
+	moves := candidateMoves(state)
+	if len(moves) == 0 {
+		return 0, false
+	}
+	depth := s.depth
+	if depth == unlimitedDepth && !isSmallBoard(state) {
+		depth = perfectDepth
+	}
+	best, bestScore := moves[0], math.MinInt
+	alpha, beta := math.MinInt+1, math.MaxInt
+	for _, pos := range moves {
+		score := -s.search(play(state, pos, cellType), cellType, depth-1, 1, -beta, -alpha)
+		if score > bestScore {
+			best, bestScore = pos, score
+		}
+		alpha = max(alpha, score)
+	}
+	return best, true
+}
+
+/* negamax: the score is returned from the point of view of the side to move, i.e. the opponent of `lastMove` */
+func (s minimaxStrategy) search(state *domain.GameState, lastMove domain.Cell, depth int, ply int, alpha int, beta int) int {
+	if state.Rules.IsWin(state, lastMove) {
+		return -(winScore - ply)
+	}
+	if state.Rules.IsDraw(state) || depth <= 0 {
+		return 0
+	}
+	moves := candidateMoves(state)
+	if len(moves) == 0 {
+		return 0
+	}
+	toMove := opponent(lastMove)
+	best := math.MinInt + 1
+	for _, pos := range moves {
+		score := -s.search(play(state, pos, toMove), toMove, depth-1, ply+1, -beta, -alpha)
+		best = max(best, score)
+		alpha = max(alpha, score)
+		if alpha >= beta {
+			break
+		}
+	}
+	return best
+}
+
+func candidateMoves(state *domain.GameState) []int {
+	moves := state.Rules.LegalMoves(state)
+	if state.Ultimate != nil || isSmallBoard(state) {
+		return moves
+	}
+	board := state.Board
+	result := make([]int, 0, len(moves))
+	for _, pos := range moves {
+		if hasNeighbour(board, pos) {
+			result = append(result, pos)
+		}
+	}
+	if len(result) == 0 {
+		/* the board is empty: start from the center */
+		return []int{(board.Rows/2)*board.Cols + board.Cols/2}
+	}
+	return result
+}
+
+func hasNeighbour(board domain.Board, pos int) bool {
+	row, col := pos/board.Cols, pos%board.Cols
+	for dr := -neighbourhoodSize; dr <= neighbourhoodSize; dr++ {
+		for dc := -neighbourhoodSize; dc <= neighbourhoodSize; dc++ {
+			r, c := row+dr, col+dc
+			if (dr != 0 || dc != 0) && board.Contains(r, c) && board.At(r, c) != domain.None {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isSmallBoard(state *domain.GameState) bool {
+	return state.Ultimate == nil && state.Board.Size() <= smallBoardSize
+}
+
+func play(state *domain.GameState, pos int, cellType domain.Cell) *domain.GameState {
+	next := cloneState(state)
+	next.Rules.ApplyMove(next, pos, cellType)
+	next.Round++
+	return next
+}
+
+func cloneState(state *domain.GameState) *domain.GameState {
+	return &domain.GameState{
+		Board:    state.Board.Clone(),
+		Ultimate: state.Ultimate.Clone(),
+		Variant:  state.Variant,
+		Round:    state.Round,
+		Rules:    state.Rules,
+	}
+}
+
+func opponent(cellType domain.Cell) domain.Cell {
+	if cellType == domain.X {
+		return domain.O
+	}
+	return domain.X
+}
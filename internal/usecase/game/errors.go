@@ -5,6 +5,7 @@ import (
 )
 
 var (
-	errUnexpectedMoveStatus    = errors.New("unexpected move status")
-	errInvalidSelectedPosition = errors.New("invalid selected cell position")
+	errUnexpectedMoveStatus = errors.New("unexpected move status")
+	errGameFinished         = errors.New("game is already finished")
+	errMoveIsLate           = errors.New("move is made after the time of the turn is up")
 )
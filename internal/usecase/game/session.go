@@ -0,0 +1,408 @@
+package game
+
+import (
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/kiryu-dev/tic-tac-toe/pkg/utils"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type receivedMessage struct {
+	msg domain.Message
+	err error
+}
+
+/*
+ * session is a single player's side of the game. It reads the player's connection all the time,
+ * not only during the player's turn, so that resign, draw and takeback requests
+ * can be sent while the enemy is thinking
+ */
+type session struct {
+	u                   useCase
+	player              domain.Player
+	state               *domain.GameState
+	incoming            chan receivedMessage
+	done                chan struct{}
+	isMyTurn            bool
+	turnStartedAt       time.Time
+	turnTimer           *time.Timer
+	reconnectTimer      *time.Timer
+	drawOffered         bool
+	enemyOffersDraw     bool
+	enemyAsksTakeback   bool
+	takebackIsRequested bool
+}
+
+func newSession(u useCase, player domain.Player, state *domain.GameState) *session {
+	s := &session{
+		u:              u,
+		player:         player,
+		state:          state,
+		incoming:       make(chan receivedMessage),
+		done:           make(chan struct{}),
+		reconnectTimer: time.NewTimer(maxReconnectionTime),
+	}
+	go s.readMessages()
+	return s
+}
+
+func (s *session) readMessages() {
+	for {
+		msg, err := s.player.ReceiveMessage()
+		select {
+		case s.incoming <- receivedMessage{msg: msg, err: err}:
+		case <-s.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *session) close() {
+	s.stopTurnTimer()
+	s.reconnectTimer.Stop()
+	close(s.done)
+}
+
+func (s *session) run() error {
+	for {
+		var (
+			isGameFinished bool
+			err            error
+		)
+		select {
+		case v := <-s.player.GetEnemyMove():
+			isGameFinished, err = s.handleEnemyMove(v)
+		case v := <-s.incoming:
+			isGameFinished, err = s.handleMessage(v)
+		case <-s.turnDeadline():
+			isGameFinished, err = s.handleTimeIsUp()
+		case <-s.reconnectTimer.C:
+			if s.u.activePlayerCount(s.state) == 2 {
+				continue
+			}
+			if err := s.u.handleEnemyDisconnect(s.player, s.state); err != nil {
+				return errors.WithMessage(err, "handle enemy disconnect")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if isGameFinished {
+			return nil
+		}
+	}
+}
+
+func (s *session) turnDeadline() <-chan time.Time {
+	if !s.isMyTurn || s.turnTimer == nil {
+		return nil
+	}
+	return s.turnTimer.C
+}
+
+func (s *session) beginTurn() error {
+	if err := s.player.SendMessage(domain.Message{Type: domain.RequestMove}); err != nil {
+		return errors.WithMessage(err, "send message to player")
+	}
+	s.startTurn()
+	return nil
+}
+
+func (s *session) startTurn() {
+	s.stopTurnTimer()
+	s.isMyTurn = true
+	s.turnStartedAt = time.Now()
+	if limit, ok := s.u.turnLimit(s.state, s.player.Cell()); ok {
+		s.turnTimer = time.NewTimer(limit)
+	}
+}
+
+func (s *session) endTurn() {
+	s.stopTurnTimer()
+	s.isMyTurn = false
+}
+
+func (s *session) stopTurnTimer() {
+	if s.turnTimer != nil {
+		s.turnTimer.Stop()
+		s.turnTimer = nil
+	}
+}
+
+func (s *session) handleEnemyMove(v domain.Move) (isGameFinished bool, err error) {
+	switch v.Status {
+	case domain.NoneMove:
+		if err := s.beginTurn(); err != nil {
+			return false, errors.WithMessage(err, "begin turn")
+		}
+	case domain.MoveX, domain.MoveO:
+		err := sendMoveMessage(s.player, v.Position, domain.WithCellType(v.CellType), domain.RequestMoveBack(),
+			domain.WithClock(s.u.clock(s.state)))
+		if err != nil {
+			return false, errors.WithMessage(err, "send message")
+		}
+		s.startTurn()
+	case domain.Disconnect:
+		if err := s.u.handleEnemyDisconnect(s.player, s.state); err != nil {
+			return false, errors.WithMessage(err, "handle enemy disconnect")
+		}
+		return true, nil
+	case domain.Suspended:
+		return false, domain.ErrServerSwitched
+	case domain.TimeIsUp:
+		if err := sendTimeOut(s.player, TimeWinGameResult); err != nil {
+			return false, errors.WithMessage(err, "handle enemy's time is up")
+		}
+		return true, nil
+	case domain.Resigned:
+		if err := sendGameOver(s.player, ResignWinGameResult); err != nil {
+			return false, errors.WithMessage(err, "send game over")
+		}
+		return true, nil
+	case domain.DrawAccepted:
+		if err := sendGameOver(s.player, AgreedDrawGameResult); err != nil {
+			return false, errors.WithMessage(err, "send game over")
+		}
+		return true, nil
+	case domain.DrawOffered:
+		s.enemyOffersDraw = true
+		return false, s.notify(domain.Message{Type: domain.OfferDraw})
+	case domain.DrawDeclined:
+		s.drawOffered = false
+		return false, s.notify(domain.Message{Type: domain.DeclineDraw})
+	case domain.TakebackRequested:
+		s.enemyAsksTakeback = true
+		return false, s.notify(domain.Message{Type: domain.RequestTakeback})
+	case domain.TakebackDeclined:
+		s.takebackIsRequested = false
+		return false, s.notify(domain.Message{Type: domain.DeclineTakeback})
+	case domain.TakebackAccepted:
+		s.takebackIsRequested = false
+		if err := s.sendTakeback(); err != nil {
+			return false, errors.WithMessage(err, "send takeback")
+		}
+		if err := s.beginTurn(); err != nil {
+			return false, errors.WithMessage(err, "begin turn")
+		}
+	default:
+		gameResult, err := toGameResult(v.Status, s.player)
+		if err != nil {
+			return false, errors.WithMessage(err, "to game result")
+		}
+		err = sendMoveMessage(s.player, v.Position, domain.WithCellType(v.CellType), domain.WithGameResult(gameResult))
+		if err != nil {
+			return false, errors.WithMessage(err, "send move message")
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *session) handleMessage(v receivedMessage) (isGameFinished bool, err error) {
+	if errors.Is(v.err, domain.ErrServerSwitched) {
+		s.player.MakeMove(domain.Move{Status: domain.Suspended})
+		return false, v.err
+	}
+	if v.err != nil {
+		s.player.MakeMove(domain.Move{Status: domain.Disconnect})
+		if errors.Is(v.err, domain.ErrConnectionClosed) {
+			return true, nil
+		}
+		return false, errors.WithMessage(v.err, "read message from player")
+	}
+	switch v.msg.Type {
+	case domain.PlayerMove:
+		return s.handlePlayersMove(v.msg)
+	case domain.Resign:
+		outcome := domain.Outcome{Winner: invertCellType(s.player.Cell()), Reason: domain.ReasonResign}
+		if !s.u.finish(s.player.GameUuid(), s.state, outcome) {
+			return false, nil /* the enemy has just finished the game, wait for the result */
+		}
+		s.player.MakeMove(domain.Move{Status: domain.Resigned})
+		if err := sendGameOver(s.player, ResignLoseGameResult); err != nil {
+			return false, errors.WithMessage(err, "send game over")
+		}
+		return true, nil
+	case domain.OfferDraw:
+		if s.enemyOffersDraw {
+			return s.acceptDraw()
+		}
+		if !s.drawOffered {
+			s.drawOffered = true
+			s.player.MakeMove(domain.Move{Status: domain.DrawOffered})
+		}
+	case domain.AcceptDraw:
+		if s.enemyOffersDraw {
+			return s.acceptDraw()
+		}
+	case domain.DeclineDraw:
+		if s.enemyOffersDraw {
+			s.enemyOffersDraw = false
+			s.player.MakeMove(domain.Move{Status: domain.DrawDeclined})
+		}
+	case domain.RequestTakeback:
+		if !s.takebackIsRequested {
+			s.takebackIsRequested = true
+			s.player.MakeMove(domain.Move{Status: domain.TakebackRequested})
+		}
+	case domain.AcceptTakeback:
+		if !s.enemyAsksTakeback {
+			return false, nil
+		}
+		s.enemyAsksTakeback = false
+		if err := s.acceptTakeback(); err != nil {
+			return false, errors.WithMessage(err, "accept takeback")
+		}
+	case domain.DeclineTakeback:
+		if s.enemyAsksTakeback {
+			s.enemyAsksTakeback = false
+			s.player.MakeMove(domain.Move{Status: domain.TakebackDeclined})
+		}
+	default:
+		s.u.logger.Warn("unexpected message type",
+			zap.String("player uuid", s.player.Uuid()), zap.Any("type", v.msg.Type))
+	}
+	return false, nil
+}
+
+func (s *session) handlePlayersMove(msg domain.Message) (isGameFinished bool, err error) {
+	if !s.isMyTurn {
+		s.u.logger.Warn("move out of turn", zap.String("player uuid", s.player.Uuid()))
+		return false, nil
+	}
+	move, err := utils.UnmarshalJson[domain.PlayerMovePayload](msg.Payload)
+	if err != nil {
+		return false, errors.WithMessage(err, "unmarshal player's move")
+	}
+	if s.player.Cell() != move.CellType {
+		return false, errors.Errorf("expected cell type '%c', got '%c'", s.player.Cell(), move.CellType)
+	}
+	err = s.u.validateMove(move, s.state)
+	switch {
+	case errors.Is(err, domain.ErrInvalidPosition), errors.Is(err, domain.ErrIllegalMove):
+		if err := s.player.SendMessage(domain.Message{Type: domain.RequestMove}); err != nil {
+			return false, errors.WithMessage(err, "send message to player")
+		}
+		return false, nil
+	case err != nil:
+		return false, errors.WithMessage(err, "validate player's move")
+	}
+
+	moveStatus, err := s.u.executeMove(s.player, move, s.state, time.Since(s.turnStartedAt))
+	switch {
+	case errors.Is(err, errGameFinished):
+		s.endTurn()
+		return false, nil
+	case errors.Is(err, errMoveIsLate):
+		return s.handleTimeIsUp()
+	case errors.Is(err, domain.ErrNotLeader), errors.Is(err, domain.ErrNotOwner):
+		s.endTurn()
+		s.u.logger.Warn("move isn't confirmed, the server no longer serves the game",
+			zap.String("player uuid", s.player.Uuid()), zap.Error(err))
+		return false, nil
+	case errors.Is(err, domain.ErrReplicationTimeout):
+		/* the enemy's session stops too, both players come back to the suspended game */
+		s.endTurn()
+		s.u.logger.Warn("move isn't confirmed, the majority hasn't acknowledged it",
+			zap.String("player uuid", s.player.Uuid()), zap.Error(err))
+		s.player.MakeMove(domain.Move{Status: domain.Suspended})
+		return false, domain.ErrServerSwitched
+	case err != nil:
+		s.player.MakeMove(domain.Move{Status: domain.Disconnect})
+		return false, errors.WithMessage(err, "execute player's move")
+	}
+	s.endTurn()
+	s.player.MakeMove(domain.Move{
+		CellType: s.player.Cell(),
+		Position: move.Position,
+		Status:   moveStatus,
+	})
+
+	gameResult, err := toGameResult(moveStatus, s.player)
+	switch {
+	case errors.Is(err, errUnexpectedMoveStatus):
+		/* the game isn't over, it's still in progress */
+		if err := sendMoveMessage(s.player, move.Position, domain.WithClock(s.u.clock(s.state))); err != nil {
+			return false, errors.WithMessage(err, "send move message")
+		}
+		return false, nil
+	case err != nil:
+		return false, errors.WithMessage(err, "to game result") /* impossible case but.... */
+	default:
+		err := sendMoveMessage(s.player, move.Position, domain.WithGameResult(gameResult))
+		if err != nil {
+			return false, errors.WithMessage(err, "send move message")
+		}
+		return true, nil
+	}
+}
+
+func (s *session) handleTimeIsUp() (isGameFinished bool, err error) {
+	s.endTurn()
+	outcome := domain.Outcome{Winner: invertCellType(s.player.Cell()), Reason: domain.ReasonTimeout}
+	if !s.u.finish(s.player.GameUuid(), s.state, outcome) {
+		return false, nil
+	}
+	s.player.MakeMove(domain.Move{CellType: s.player.Cell(), Status: domain.TimeIsUp})
+	if err := sendTimeOut(s.player, TimeLoseGameResult); err != nil {
+		return false, errors.WithMessage(err, "handle player's time is up")
+	}
+	return true, nil
+}
+
+func (s *session) acceptDraw() (isGameFinished bool, err error) {
+	if !s.u.finish(s.player.GameUuid(), s.state, domain.Outcome{Winner: domain.None, Reason: domain.ReasonAgreement}) {
+		return false, nil
+	}
+	s.player.MakeMove(domain.Move{Status: domain.DrawAccepted})
+	if err := sendGameOver(s.player, AgreedDrawGameResult); err != nil {
+		return false, errors.WithMessage(err, "send game over")
+	}
+	return true, nil
+}
+
+func (s *session) acceptTakeback() error {
+	enemyCell := invertCellType(s.player.Cell())
+	if ok := s.u.takeback(s.player.GameUuid(), s.state, enemyCell); !ok {
+		s.player.MakeMove(domain.Move{Status: domain.TakebackDeclined})
+		return nil
+	}
+	s.endTurn()
+	if err := s.sendTakeback(); err != nil {
+		return errors.WithMessage(err, "send takeback")
+	}
+	s.player.MakeMove(domain.Move{Status: domain.TakebackAccepted})
+	return nil
+}
+
+func (s *session) sendTakeback() error {
+	s.u.mu.Lock()
+	payload := domain.TakebackPayload{
+		Board:    s.state.Board.Clone(),
+		Ultimate: s.state.Ultimate.Clone(),
+		Round:    s.state.Round,
+		Clock:    s.state.Clock.Clone(),
+	}
+	s.u.mu.Unlock()
+	err := s.player.SendMessage(domain.Message{
+		Type:    domain.AcceptTakeback,
+		Payload: payload,
+	})
+	if err != nil {
+		return errors.WithMessage(err, "send message to player")
+	}
+	return nil
+}
+
+func (s *session) notify(msg domain.Message) error {
+	if err := s.player.SendMessage(msg); err != nil {
+		return errors.WithMessage(err, "send message to player")
+	}
+	return nil
+}
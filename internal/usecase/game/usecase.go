@@ -2,12 +2,11 @@ package game
 
 import (
 	"context"
-	"fmt"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
-	"github.com/kiryu-dev/tic-tac-toe/pkg/utils"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -17,14 +16,18 @@ const (
 )
 
 type useCase struct {
-	mu     *sync.Mutex
-	logger *zap.Logger
+	committer domain.StateCommitter
+	rater     domain.Rater
+	mu        *sync.Mutex
+	logger    *zap.Logger
 }
 
-func New(logger *zap.Logger) useCase {
+func New(committer domain.StateCommitter, rater domain.Rater, logger *zap.Logger) useCase {
 	return useCase{
-		mu:     &sync.Mutex{},
-		logger: logger,
+		committer: committer,
+		rater:     rater,
+		mu:        &sync.Mutex{},
+		logger:    logger,
 	}
 }
 
@@ -33,148 +36,141 @@ func (u useCase) Play(_ context.Context, player domain.Player, state *domain.Gam
 	u.logger.Info("start playing", zap.String("player uuid", player.Uuid()))
 	state.Status = domain.InProgress
 	state.ActivePlayerCount++
-	if err := startGame(player, state.Board); err != nil {
+	if err := startGame(player, state); err != nil {
+		u.mu.Unlock()
 		return errors.WithMessage(err, "start game")
 	}
+	isRecovered, isFirstRound := state.RecoveredPlayer == player.Uuid(), state.Round == 0
 	u.mu.Unlock()
+	u.commit(player.GameUuid(), state)
 
-	go u.handleEnemyReconnect(player, state)
+	s := newSession(u, player, state)
+	defer s.close()
 
 	switch {
-	case state.RecoveredPlayer == player.Uuid():
-		if err := player.SendMessage(domain.Message{Type: domain.RequestMove}); err != nil {
-			return errors.WithMessage(err, "send message to player")
+	case isRecovered:
+		if err := s.beginTurn(); err != nil {
+			return errors.WithMessage(err, "begin turn")
 		}
-		isGameFinished, err := u.handlePlayersMove(player, state)
-		if err != nil {
-			return errors.WithMessage(err, "handle player's move")
-		}
-		if isGameFinished {
-			return nil
-		}
-	case state.Round == 0 && player.Cell() == domain.O:
+	case isFirstRound && player.Cell() == domain.O:
 		player.MakeMove(domain.Move{Status: domain.NoneMove})
 	}
 
-	for {
-		select {
-		case v := <-player.GetEnemyMove():
-			switch v.Status {
-			case domain.NoneMove:
-				if err := player.SendMessage(domain.Message{Type: domain.RequestMove}); err != nil {
-					return errors.WithMessage(err, "send message to player")
-				}
-			case domain.MoveX, domain.MoveO:
-				err := sendMoveMessage(player, v.Position, domain.WithCellType(v.CellType), domain.RequestMoveBack())
-				if err != nil {
-					return errors.WithMessage(err, "send message")
-				}
-			case domain.Disconnect:
-				if err := u.handleEnemyDisconnect(player, state); err != nil {
-					return errors.WithMessage(err, "handle enemy disconnect")
-				}
-				return nil
-			default:
-				u.mu.Lock()
-				state.Status = domain.Finished
-				u.mu.Unlock()
+	if err := s.run(); err != nil {
+		return errors.WithMessage(err, "play session")
+	}
+	return nil
+}
+
+func (u useCase) Snapshot(state *domain.GameState) *domain.GameState {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return state.Clone()
+}
 
-				gameResult, err := toGameResult(v.Status, player)
-				if err != nil {
-					return errors.WithMessage(err, "to game result")
-				}
-				err = sendMoveMessage(player, v.Position, domain.WithCellType(v.CellType), domain.WithGameResult(gameResult))
-				if err != nil {
-					return errors.WithMessage(err, "send move message")
-				}
-				return nil
-			}
+func (u useCase) handleEnemyDisconnect(player domain.Player, state *domain.GameState) error {
+	u.finish(player.GameUuid(), state, domain.Outcome{Winner: player.Cell(), Reason: domain.ReasonWalkover})
 
-			isGameFinished, err := u.handlePlayersMove(player, state)
-			if err != nil {
-				return errors.WithMessage(err, "handle player's move")
-			}
-			if isGameFinished {
-				return nil
-			}
-		}
+	err := player.SendMessage(domain.Message{
+		Type:    domain.Walkover,
+		Payload: domain.WalkoverPayload{GameResult: WalkoverGameResult},
+	})
+	if err != nil {
+		return errors.WithMessage(err, "send message to player")
 	}
+	return nil
 }
 
-func (u useCase) handlePlayersMove(player domain.Player, state *domain.GameState) (isGameFinished bool, err error) {
-	move, err := receiveMoveMessage(player, state.Board)
-	switch {
-	case errors.Is(err, domain.ErrConnectionClosed):
-		player.MakeMove(domain.Move{Status: domain.Disconnect})
-		return true, nil
-	case err != nil:
-		return false, errors.WithMessage(err, "receive move message")
+func sendTimeOut(player domain.Player, gameResult string) error {
+	err := player.SendMessage(domain.Message{
+		Type:    domain.TimeOut,
+		Payload: domain.TimeOutPayload{GameResult: gameResult},
+	})
+	if err != nil {
+		return errors.WithMessage(err, "send message to player")
 	}
+	return nil
+}
 
-	moveStatus, err := u.executeMove(move, state)
-	if err != nil {
-		return false, errors.WithMessage(err, "execute player's move")
+/* finish marks the game as finished, false means that it has already been finished by the enemy */
+func (u useCase) finish(gameUuid string, state *domain.GameState, outcome domain.Outcome) bool {
+	u.mu.Lock()
+	if state.Status == domain.Finished {
+		u.mu.Unlock()
+		return false
 	}
-	//printBoard(state.Board)
+	u.markFinished(state, outcome)
+	u.mu.Unlock()
+	u.commit(gameUuid, state)
+	return true
+}
 
-	defer func() {
-		if err != nil {
-			player.MakeMove(domain.Move{Status: domain.Disconnect})
-			return
-		}
-		player.MakeMove(domain.Move{
-			CellType: player.Cell(),
-			Position: move.Position,
-			Status:   moveStatus,
-		})
-	}()
+/* commit hands a snapshot of the state over after every change, so the game survives a restart of the server */
+func (u useCase) commit(gameUuid string, state *domain.GameState) error {
+	snapshot := u.Snapshot(state)
+	if snapshot.Status == domain.Finished && len(snapshot.Ratings) == 0 {
+		u.rate(state, snapshot)
+	}
+	err := u.committer.Commit(context.Background(), gameUuid, snapshot)
+	if err != nil {
+		u.logger.Error("commit game state", zap.String("game uuid", gameUuid), zap.Error(err))
+	}
+	return err
+}
 
-	//player.MakeMove(domain.Move{
-	//	CellType: player.Cell(),
-	//	Position: move.Position,
-	//	Status:   moveStatus,
-	//})
+/* markFinished is called under the lock, it finalizes the result of the game, the commit rates it */
+func (u useCase) markFinished(state *domain.GameState, outcome domain.Outcome) {
+	state.Status = domain.Finished
+	state.Outcome = &outcome
+	state.FinishedAt = time.Now()
+}
 
-	gameResult, err := toGameResult(moveStatus, player)
-	switch {
-	case errors.Is(err, errUnexpectedMoveStatus):
-		/* the game isn't over, it's still in progress */
-		if err := sendMoveMessage(player, move.Position); err != nil {
-			return false, errors.WithMessage(err, "send move message")
-		}
-		return false, nil
-	case err != nil:
-		return false, errors.WithMessage(err, "to game result") /* impossible case but.... */
-	default:
-		err := sendMoveMessage(player, move.Position, domain.WithGameResult(gameResult))
-		if err != nil {
-			return false, errors.WithMessage(err, "send move message")
-		}
-		return true, nil
+/* rate computes the rated result from the snapshot outside of the lock shared by every game of the server */
+func (u useCase) rate(state *domain.GameState, snapshot *domain.GameState) {
+	u.rater.Rate(snapshot)
+	if len(snapshot.Ratings) == 0 {
+		return
 	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(state.Ratings) > 0 {
+		snapshot.Ratings = slices.Clone(state.Ratings) /* the game has been rated by a concurrent commit */
+		return
+	}
+	state.Ratings = slices.Clone(snapshot.Ratings)
 }
 
-func (u useCase) handleEnemyDisconnect(player domain.Player, state *domain.GameState) error {
+func (u useCase) turnLimit(state *domain.GameState, cellType domain.Cell) (time.Duration, bool) {
 	u.mu.Lock()
-	state.Status = domain.Finished
-	u.mu.Unlock()
+	defer u.mu.Unlock()
+	return state.Clock.TurnLimit(state.TimeControl, cellType)
+}
 
-	err := player.SendMessage(domain.Message{
-		Type:    domain.Walkover,
-		Payload: domain.WalkoverPayload{GameResult: WalkoverGameResult},
-	})
-	if err != nil {
-		return errors.WithMessage(err, "send message to player")
-	}
-	return nil
+func (u useCase) clock(state *domain.GameState) *domain.Clock {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return state.Clock.Clone()
+}
+
+func (u useCase) activePlayerCount(state *domain.GameState) uint8 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return state.ActivePlayerCount
 }
 
-func startGame(player domain.Player, board domain.Board) error {
+func startGame(player domain.Player, state *domain.GameState) error {
 	err := player.SendMessage(domain.Message{
 		Type: domain.StartGame,
 		Payload: domain.StartGamePayload{
-			CellType: player.Cell(),
-			Board:    board,
+			GameUuid:    player.GameUuid(),
+			CellType:    player.Cell(),
+			Variant:     state.Variant,
+			Board:       state.Board,
+			Ultimate:    state.Ultimate,
+			Round:       state.Round,
+			TimeControl: state.TimeControl,
+			Clock:       state.Clock,
+			SeriesId:    state.SeriesId,
 		},
 	})
 	if err != nil {
@@ -183,7 +179,7 @@ func startGame(player domain.Player, board domain.Board) error {
 	return nil
 }
 
-func sendMoveMessage(player domain.Player, position byte, opts ...domain.PlayerMovePayloadOption) error {
+func sendMoveMessage(player domain.Player, position int, opts ...domain.PlayerMovePayloadOption) error {
 	payload := &domain.PlayerMovePayload{
 		CellType: player.Cell(),
 		Position: position,
@@ -201,71 +197,67 @@ func sendMoveMessage(player domain.Player, position byte, opts ...domain.PlayerM
 	return nil
 }
 
-func receiveMoveMessage(player domain.Player, board domain.Board) (domain.PlayerMovePayload, error) {
-	for {
-		msg, err := player.ReceiveMessage()
-		if err != nil {
-			return domain.PlayerMovePayload{}, errors.WithMessage(err, "read message from player")
-		}
-		if msg.Type != domain.PlayerMove {
-			return domain.PlayerMovePayload{}, errors.New("unexpected message type")
-		}
-
-		move, err := utils.UnmarshalJson[domain.PlayerMovePayload](msg.Payload)
-		if err != nil {
-			return domain.PlayerMovePayload{}, errors.WithMessage(err, "unmarshal player's move")
-		}
-		if player.Cell() != move.CellType {
-			return domain.PlayerMovePayload{}, errors.Errorf(
-				"expected cell type '%c', got '%c'", player.Cell(), move.CellType,
-			)
-		}
-
-		err = validateMovePosition(board, move.Position)
-		switch {
-		case errors.Is(err, errInvalidSelectedPosition):
-			if err := player.SendMessage(domain.Message{Type: domain.RequestMove}); err != nil {
-				return domain.PlayerMovePayload{}, errors.WithMessage(err, "send message to player")
-			}
-		case err != nil:
-			return domain.PlayerMovePayload{}, errors.WithMessage(err, "validate player's move")
-		default:
-			return move, nil
-		}
-	}
-}
-
-func validateMovePosition(board domain.Board, pos byte) error {
-	if pos > 8 {
-		return errInvalidSelectedPosition
-	}
-	if board[pos] != domain.None {
-		return errors.WithMessagef(errInvalidSelectedPosition,
-			"cell in position '%d' is already selected", pos)
+func sendGameOver(player domain.Player, gameResult string) error {
+	err := player.SendMessage(domain.Message{
+		Type:    domain.GameOver,
+		Payload: domain.GameOverPayload{GameResult: gameResult},
+	})
+	if err != nil {
+		return errors.WithMessage(err, "send message to player")
 	}
 	return nil
 }
 
-const maxRounds = 9
+func (u useCase) validateMove(move domain.PlayerMovePayload, state *domain.GameState) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return state.Rules.ValidateMove(state, move.Position)
+}
 
-var winConditions = [8][3]uint8{
-	{0, 1, 2},
-	{3, 4, 5},
-	{6, 7, 8},
-	{0, 3, 6},
-	{1, 4, 7},
-	{2, 5, 8},
-	{0, 4, 8},
-	{2, 4, 6},
+func (u useCase) executeMove(player domain.Player, move domain.PlayerMovePayload, state *domain.GameState,
+	elapsed time.Duration) (domain.MoveStatus, error) {
+	status, err := u.applyMove(player, move, state, elapsed)
+	if err != nil {
+		return status, err
+	}
+	/*
+	 * in the quorum durability mode the commit returns once the majority of servers has the move,
+	 * the move isn't confirmed without it. A server that is no longer the master (or the owner of the game)
+	 * switches its players to another server. If the majority doesn't answer in time the sessions of both players
+	 * are suspended instead of confirming the move, the players reconnect and the game is recovered
+	 */
+	err = u.commit(player.GameUuid(), state)
+	if errors.Is(err, domain.ErrNotLeader) || errors.Is(err, domain.ErrNotOwner) ||
+		errors.Is(err, domain.ErrReplicationTimeout) {
+		return status, err
+	}
+	return status, nil
 }
 
-func (u useCase) executeMove(move domain.PlayerMovePayload, state *domain.GameState) (domain.MoveStatus, error) {
+func (u useCase) applyMove(player domain.Player, move domain.PlayerMovePayload, state *domain.GameState,
+	elapsed time.Duration) (domain.MoveStatus, error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
-	state.Board[move.Position] = move.CellType
+	if state.Status == domain.Finished {
+		return domain.NoneMove, errGameFinished
+	}
+	if state.Clock.IsLate(state.TimeControl, move.CellType, elapsed) {
+		return domain.NoneMove, errMoveIsLate
+	}
+	clockBefore := state.Clock.Clone()
+	state.Clock.Spend(state.TimeControl, move.CellType, elapsed)
+	state.Rules.ApplyMove(state, move.Position, move.CellType)
+	state.Moves = append(state.Moves, domain.MoveRecord{
+		PlayerUuid:  player.Uuid(),
+		CellType:    move.CellType,
+		Position:    move.Position,
+		MadeAt:      time.Now(),
+		ClockBefore: clockBefore,
+	})
 	state.Round++
 	state.CurrentMove = invertCellType(move.CellType)
-	if isWinnable(state.Board, move.CellType) {
+	if state.Rules.IsWin(state, move.CellType) {
+		u.markFinished(state, domain.Outcome{Winner: move.CellType, Reason: domain.ReasonWin})
 		switch move.CellType {
 		case domain.X:
 			return domain.WinX, nil
@@ -275,7 +267,8 @@ func (u useCase) executeMove(move domain.PlayerMovePayload, state *domain.GameSt
 			return domain.NoneMove, errors.New("unexpected cell type")
 		}
 	}
-	if state.Round == maxRounds {
+	if state.Rules.IsDraw(state) {
+		u.markFinished(state, domain.Outcome{Winner: domain.None, Reason: domain.ReasonDraw})
 		return domain.Draw, nil
 	}
 	switch move.CellType {
@@ -288,6 +281,38 @@ func (u useCase) executeMove(move domain.PlayerMovePayload, state *domain.GameSt
 	}
 }
 
+/*
+ * takeback undoes the moves up to and including the last move of the requester,
+ * so after it's accepted the requester moves again with the clock as it was before that move. The board is rebuilt from the move list
+ * because not every variant can undo a single move (e.g. a won sub-board of the ultimate variant)
+ */
+func (u useCase) takeback(gameUuid string, state *domain.GameState, requester domain.Cell) bool {
+	u.mu.Lock()
+	last := -1
+	for i, v := range state.Moves {
+		if v.CellType == requester {
+			last = i
+		}
+	}
+	if last < 0 || state.Status == domain.Finished {
+		u.mu.Unlock()
+		return false
+	}
+	if clock := state.Moves[last].ClockBefore; clock != nil {
+		state.Clock = clock.Clone() /* the time spent on the undone moves and their increments are given back */
+	}
+	state.Moves = state.Moves[:last]
+	state.Rules.Init(state)
+	for _, v := range state.Moves {
+		state.Rules.ApplyMove(state, v.Position, v.CellType)
+	}
+	state.Round = len(state.Moves)
+	state.CurrentMove = requester
+	u.mu.Unlock()
+	u.commit(gameUuid, state)
+	return true
+}
+
 func invertCellType(cellType domain.Cell) domain.Cell {
 	switch cellType {
 	case domain.X:
@@ -299,27 +324,16 @@ func invertCellType(cellType domain.Cell) domain.Cell {
 	}
 }
 
-func isWinnable(board domain.Board, cellType domain.Cell) bool {
-	for _, condition := range winConditions {
-		isWinnable := true
-		for _, v := range condition {
-			if board[v] != cellType {
-				isWinnable = false
-				break
-			}
-		}
-		if isWinnable {
-			return true
-		}
-	}
-	return false
-}
-
 const (
-	WinGameResult      = "Победа"
-	LoseGameResult     = "Поражение"
-	DrawGameResult     = "Ничья"
-	WalkoverGameResult = "Техническая победа (оппонент отключился)"
+	WinGameResult        = "Победа"
+	LoseGameResult       = "Поражение"
+	DrawGameResult       = "Ничья"
+	WalkoverGameResult   = "Техническая победа (оппонент отключился)"
+	TimeWinGameResult    = "Победа по времени"
+	TimeLoseGameResult   = "Поражение по времени"
+	ResignWinGameResult  = "Победа (оппонент сдался)"
+	ResignLoseGameResult = "Поражение (ты сдался)"
+	AgreedDrawGameResult = "Ничья по соглашению"
 )
 
 func toGameResult(status domain.MoveStatus, player domain.Player) (string, error) {
@@ -341,23 +355,3 @@ func toGameResult(status domain.MoveStatus, player domain.Player) (string, error
 		return "", errUnexpectedMoveStatus
 	}
 }
-
-func (u useCase) handleEnemyReconnect(player domain.Player, state *domain.GameState) {
-	select {
-	case <-time.After(maxReconnectionTime):
-		if state.ActivePlayerCount != 2 {
-			if err := u.handleEnemyDisconnect(player, state); err != nil {
-				u.logger.Warn(err.Error())
-			}
-		}
-	}
-}
-
-func printBoard(board domain.Board) {
-	for i, v := range board {
-		fmt.Printf("%c ", v)
-		if (i+1)%3 == 0 {
-			fmt.Println()
-		}
-	}
-}
@@ -0,0 +1,168 @@
+package hub
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+)
+
+/*
+ * The players of a tournament are seeded by rating, the seed of a player is its index in Tournament.Players.
+ * A round robin is paired by the circle method: the first seed stays, the rest rotate every round,
+ * an odd number of players gets an empty seat, the one paired with it has a bye.
+ * A knockout bracket is the next power of 2 of the players, the top seeds get the byes
+ * and the seeds meet in the standard order, so the top two can meet in the final only
+ */
+
+func roundRobinRounds(players []string) []domain.TournamentRound {
+	seats := slices.Clone(players)
+	if len(seats)%2 == 1 {
+		seats = append(seats, "")
+	}
+	n := len(seats)
+	rounds := make([]domain.TournamentRound, 0, n-1)
+	for r := 0; r < n-1; r++ {
+		pairings := make([]domain.Pairing, 0, n/2)
+		for i := 0; i < n/2; i++ {
+			playerX, playerO := seats[i], seats[n-1-i]
+			if r%2 == 1 {
+				playerX, playerO = playerO, playerX /* the colors alternate from round to round */
+			}
+			pairings = append(pairings, newPairing(playerX, playerO))
+		}
+		rounds = append(rounds, domain.TournamentRound{Pairings: pairings})
+		seats = append(seats[:1], append([]string{seats[n-1]}, seats[1:n-1]...)...)
+	}
+	return rounds
+}
+
+func firstKnockoutRound(players []string) domain.TournamentRound {
+	size := 1
+	for size < len(players) {
+		size *= 2
+	}
+	order := seedOrder(size)
+	pairings := make([]domain.Pairing, 0, size/2)
+	for i := 0; i < size; i += 2 {
+		playerO := ""
+		if order[i+1] < len(players) {
+			playerO = players[order[i+1]]
+		}
+		pairings = append(pairings, newPairing(players[order[i]], playerO))
+	}
+	return domain.TournamentRound{Pairings: pairings}
+}
+
+/* seedOrder returns the seeds of a bracket of the size from top to bottom: 0 7 3 4 1 6 2 5 for 8 */
+func seedOrder(size int) []int {
+	order := []int{0}
+	for len(order) < size {
+		next := make([]int, 0, len(order)*2)
+		for _, seed := range order {
+			next = append(next, seed, len(order)*2-1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+/* nextKnockoutRound pairs the winners of the neighbouring matches, the higher seed plays X */
+func nextKnockoutRound(t *domain.Tournament, prev domain.TournamentRound) domain.TournamentRound {
+	pairings := make([]domain.Pairing, 0, len(prev.Pairings)/2)
+	for i := 0; i+1 < len(prev.Pairings); i += 2 {
+		playerX, playerO := prev.Pairings[i].Winner, prev.Pairings[i+1].Winner
+		if seed(t, playerO) < seed(t, playerX) {
+			playerX, playerO = playerO, playerX
+		}
+		pairings = append(pairings, newPairing(playerX, playerO))
+	}
+	return domain.TournamentRound{Pairings: pairings}
+}
+
+/* newPairing gives the bye to the player paired with the empty seat, it's over before the round starts */
+func newPairing(playerX string, playerO string) domain.Pairing {
+	if playerX == "" {
+		playerX, playerO = playerO, playerX
+	}
+	p := domain.Pairing{PlayerX: playerX, PlayerO: playerO}
+	if p.IsBye() {
+		p.Finished, p.Winner = true, playerX
+	}
+	return p
+}
+
+func seed(t *domain.Tournament, player string) int {
+	return slices.Index(t.Players, player)
+}
+
+/* higherSeed is the winner of a knockout match that hasn't been decided on the board */
+func higherSeed(t *domain.Tournament, p domain.Pairing) string {
+	if seed(t, p.PlayerO) < seed(t, p.PlayerX) {
+		return p.PlayerO
+	}
+	return p.PlayerX
+}
+
+/*
+ * standings ranks the winner of the tournament first, then the players who have got further in the bracket,
+ * then by points, wins and seeds. Every player of a round robin plays every round, so only the points count there
+ */
+func standings(t *domain.Tournament, name func(accountId string) string) []domain.StandingEntry {
+	entries := make(map[string]*domain.StandingEntry, len(t.Players))
+	reached := make(map[string]int, len(t.Players))
+	for _, player := range t.Players {
+		entries[player] = &domain.StandingEntry{AccountId: player, Name: name(player)}
+	}
+	for r, round := range t.Rounds {
+		for _, p := range round.Pairings {
+			reached[p.PlayerX], reached[p.PlayerO] = r, r
+			if !p.Finished || p.IsBye() {
+				continue
+			}
+			x, o := entries[p.PlayerX], entries[p.PlayerO]
+			x.Played++
+			o.Played++
+			switch p.Winner {
+			case p.PlayerX:
+				x.Wins, x.Points, o.Losses = x.Wins+1, x.Points+1, o.Losses+1
+				o.Eliminated = t.Format == domain.SingleElimination
+			case p.PlayerO:
+				o.Wins, o.Points, x.Losses = o.Wins+1, o.Points+1, x.Losses+1
+				x.Eliminated = t.Format == domain.SingleElimination
+			default:
+				if p.Forfeit {
+					x.Losses++ /* nobody has come to the game, both lose it */
+					o.Losses++
+					continue
+				}
+				x.Draws, x.Points = x.Draws+1, x.Points+0.5
+				o.Draws, o.Points = o.Draws+1, o.Points+0.5
+			}
+		}
+	}
+	result := make([]domain.StandingEntry, 0, len(t.Players))
+	for _, player := range t.Players {
+		result = append(result, *entries[player])
+	}
+	slices.SortStableFunc(result, func(lhs domain.StandingEntry, rhs domain.StandingEntry) int {
+		isWinner := func(v domain.StandingEntry) bool {
+			return v.AccountId == t.Winner
+		}
+		if isWinner(lhs) != isWinner(rhs) {
+			if isWinner(lhs) {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(
+			cmp.Compare(reached[rhs.AccountId], reached[lhs.AccountId]),
+			cmp.Compare(rhs.Points, lhs.Points),
+			cmp.Compare(rhs.Wins, lhs.Wins),
+		)
+	})
+	for i := range result {
+		result[i].Rank = i + 1
+	}
+	return result
+}
@@ -0,0 +1,240 @@
+package hub
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+)
+
+func seeds(n int) []string {
+	players := make([]string, 0, n)
+	for i := range n {
+		players = append(players, fmt.Sprintf("p%d", i))
+	}
+	return players
+}
+
+/* TestRoundRobinRounds checks that everyone meets everyone once, plays once a round and an odd player out has a bye */
+func TestRoundRobinRounds(t *testing.T) {
+	tests := []struct {
+		players    int
+		wantRounds int
+	}{
+		{players: 2, wantRounds: 1},
+		{players: 3, wantRounds: 3},
+		{players: 4, wantRounds: 3},
+		{players: 5, wantRounds: 5},
+		{players: 8, wantRounds: 7},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d players", tt.players), func(t *testing.T) {
+			players := seeds(tt.players)
+			rounds := roundRobinRounds(players)
+			if len(rounds) != tt.wantRounds {
+				t.Fatalf("got %d rounds, want %d", len(rounds), tt.wantRounds)
+			}
+			met := make(map[[2]string]int)
+			byes := make(map[string]int)
+			for r, round := range rounds {
+				played := make(map[string]bool)
+				for _, p := range round.Pairings {
+					if played[p.PlayerX] || played[p.PlayerO] {
+						t.Fatalf("round %d: %s-%s, a player plays twice", r, p.PlayerX, p.PlayerO)
+					}
+					played[p.PlayerX], played[p.PlayerO] = true, true
+					if p.IsBye() {
+						if !p.Finished || p.Winner != p.PlayerX {
+							t.Fatalf("round %d: the bye of %s isn't won", r, p.PlayerX)
+						}
+						byes[p.PlayerX]++
+						continue
+					}
+					pair := [2]string{p.PlayerX, p.PlayerO}
+					slices.Sort(pair[:])
+					met[pair]++
+				}
+			}
+			for i, lhs := range players {
+				for _, rhs := range players[i+1:] {
+					if n := met[[2]string{lhs, rhs}]; n != 1 {
+						t.Fatalf("%s and %s meet %d times", lhs, rhs, n)
+					}
+				}
+				if want := tt.players % 2; byes[lhs] != want {
+					t.Fatalf("%s has %d byes, want %d", lhs, byes[lhs], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSeedOrder(t *testing.T) {
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{size: 1, want: []int{0}},
+		{size: 2, want: []int{0, 1}},
+		{size: 4, want: []int{0, 3, 1, 2}},
+		{size: 8, want: []int{0, 7, 3, 4, 1, 6, 2, 5}},
+		{size: 16, want: []int{0, 15, 7, 8, 3, 12, 4, 11, 1, 14, 6, 9, 2, 13, 5, 10}},
+	}
+	for _, tt := range tests {
+		if got := seedOrder(tt.size); !slices.Equal(got, tt.want) {
+			t.Fatalf("seed order of %d: got %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
+
+/* pairings writes the pairings of the round as "X-O" with "X-" for a bye */
+func pairings(round domain.TournamentRound) []string {
+	result := make([]string, 0, len(round.Pairings))
+	for _, p := range round.Pairings {
+		result = append(result, p.PlayerX+"-"+p.PlayerO)
+	}
+	return result
+}
+
+/* TestFirstKnockoutRound checks that the top seeds get the byes and the top two are in the opposite halves */
+func TestFirstKnockoutRound(t *testing.T) {
+	tests := []struct {
+		players int
+		want    []string
+	}{
+		{players: 2, want: []string{"p0-p1"}},
+		{players: 3, want: []string{"p0-", "p1-p2"}},
+		{players: 5, want: []string{"p0-", "p3-p4", "p1-", "p2-"}},
+		{players: 8, want: []string{"p0-p7", "p3-p4", "p1-p6", "p2-p5"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d players", tt.players), func(t *testing.T) {
+			round := firstKnockoutRound(seeds(tt.players))
+			if got := pairings(round); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for _, p := range round.Pairings {
+				if p.IsBye() != p.Finished {
+					t.Fatalf("%s-%s: got finished %t", p.PlayerX, p.PlayerO, p.Finished)
+				}
+			}
+		})
+	}
+}
+
+/* TestNextKnockoutRound checks that the winners of the neighbouring matches meet and the higher seed plays X */
+func TestNextKnockoutRound(t *testing.T) {
+	tests := []struct {
+		name    string
+		winners []string
+		want    []string
+	}{
+		{name: "favourites", winners: []string{"p0", "p3", "p1", "p2"}, want: []string{"p0-p3", "p1-p2"}},
+		{name: "upsets", winners: []string{"p7", "p3", "p6", "p2"}, want: []string{"p3-p7", "p2-p6"}},
+		{name: "final", winners: []string{"p5", "p1"}, want: []string{"p1-p5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tournament := &domain.Tournament{Format: domain.SingleElimination, Players: seeds(8)}
+			prev := domain.TournamentRound{}
+			for _, winner := range tt.winners {
+				prev.Pairings = append(prev.Pairings, domain.Pairing{Finished: true, Winner: winner})
+			}
+			if got := pairings(nextKnockoutRound(tournament, prev)); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/* played returns the finished pairing, the winner is "x", "o" or empty for a draw */
+func played(playerX string, playerO string, winner string) domain.Pairing {
+	p := domain.Pairing{PlayerX: playerX, PlayerO: playerO, Finished: true}
+	switch winner {
+	case "x":
+		p.Winner = playerX
+	case "o":
+		p.Winner = playerO
+	}
+	return p
+}
+
+func TestStandings(t *testing.T) {
+	forfeit := played("p1", "p2", "")
+	forfeit.Forfeit = true
+	tests := []struct {
+		name           string
+		tournament     domain.Tournament
+		wantOrder      []string
+		wantPoints     []float64
+		wantEliminated []string
+	}{
+		{
+			name: "round robin by points",
+			tournament: domain.Tournament{
+				Format:  domain.RoundRobin,
+				Players: seeds(3),
+				Rounds: []domain.TournamentRound{
+					{Pairings: []domain.Pairing{played("p0", "p1", "x"), newPairing("p2", "")}},
+					{Pairings: []domain.Pairing{played("p2", "p0", "x"), newPairing("p1", "")}},
+					{Pairings: []domain.Pairing{played("p1", "p2", ""), newPairing("p0", "")}},
+				},
+			},
+			wantOrder:  []string{"p2", "p0", "p1"},
+			wantPoints: []float64{1.5, 1, 0.5},
+		},
+		{
+			name: "round robin with a forfeit keeps the seeds on equal points",
+			tournament: domain.Tournament{
+				Format:  domain.RoundRobin,
+				Players: seeds(3),
+				Rounds: []domain.TournamentRound{
+					{Pairings: []domain.Pairing{played("p0", "p1", "x"), newPairing("p2", "")}},
+					{Pairings: []domain.Pairing{played("p2", "p0", "x"), newPairing("p1", "")}},
+					{Pairings: []domain.Pairing{forfeit, newPairing("p0", "")}},
+				},
+			},
+			wantOrder:  []string{"p0", "p2", "p1"},
+			wantPoints: []float64{1, 1, 0},
+		},
+		{
+			name: "knockout by the round reached",
+			tournament: domain.Tournament{
+				Format:  domain.SingleElimination,
+				Players: seeds(4),
+				Rounds: []domain.TournamentRound{
+					{Pairings: []domain.Pairing{played("p0", "p3", "o"), played("p1", "p2", "x")}},
+					{Pairings: []domain.Pairing{played("p1", "p3", "x")}},
+				},
+				Winner: "p1",
+			},
+			wantOrder:      []string{"p1", "p3", "p0", "p2"},
+			wantPoints:     []float64{2, 1, 0, 0},
+			wantEliminated: []string{"p3", "p0", "p2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := standings(&tt.tournament, strings.ToUpper)
+			var order, eliminated []string
+			var points []float64
+			for i, v := range entries {
+				if v.Rank != i+1 || v.Name != strings.ToUpper(v.AccountId) {
+					t.Fatalf("got %d. %s (%s) at %d", v.Rank, v.Name, v.AccountId, i)
+				}
+				order, points = append(order, v.AccountId), append(points, v.Points)
+				if v.Eliminated {
+					eliminated = append(eliminated, v.AccountId)
+				}
+			}
+			if !slices.Equal(order, tt.wantOrder) || !slices.Equal(points, tt.wantPoints) {
+				t.Fatalf("got %v with points %v, want %v with %v", order, points, tt.wantOrder, tt.wantPoints)
+			}
+			if !slices.Equal(eliminated, tt.wantEliminated) {
+				t.Fatalf("got eliminated %v, want %v", eliminated, tt.wantEliminated)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package hub
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"go.uber.org/zap"
+)
+
+/* queueKey groups the players waiting for the same variant and the same length of the series */
+type queueKey struct {
+	variant string
+	bestOf  int
+}
+
+/*
+ * The players waiting for a game of the same variant are paired if their ratings are within the window
+ * of either of them. The window widens while a player waits, so nobody waits forever,
+ * and the closest rating is chosen among the fitting ones. The games found by matchmaking are rated
+ */
+func (u *useCase) createGames() {
+	waiting := make(map[queueKey][]enqueuedClient)
+	ticker := time.NewTicker(matchmakingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case rhs := <-u.clientQueue:
+			if difficulty := rhs.client.Preferences().BotDifficulty; difficulty != "" {
+				u.startBotGame(rhs, difficulty)
+				continue
+			}
+			key := queueKey{variant: rhs.rules.Variant(), bestOf: rhs.client.Preferences().BestOf}
+			queue := waiting[key]
+			i := u.opponent(queue, rhs, time.Now())
+			if i < 0 {
+				waiting[key] = append(queue, rhs)
+				continue
+			}
+			lhs := queue[i]
+			waiting[key] = slices.Delete(queue, i, i+1)
+			u.startRatedGame(lhs, rhs)
+		case now := <-ticker.C:
+			for key, queue := range waiting {
+				queue = u.pairWaiting(queue, now)
+				queue = u.startBotGames(queue, now)
+				if len(queue) == 0 {
+					delete(waiting, key)
+					continue
+				}
+				waiting[key] = queue
+			}
+		}
+	}
+}
+
+/* opponent returns the index of the waiting client to pair the client with, -1 if nobody fits */
+func (u *useCase) opponent(queue []enqueuedClient, rhs enqueuedClient, now time.Time) int {
+	best := -1
+	for i, lhs := range queue {
+		if lhs.client.Uuid() == rhs.client.Uuid() {
+			continue /* the same account from another connection */
+		}
+		diff := math.Abs(lhs.rating - rhs.rating)
+		if diff > max(u.window(lhs, now), u.window(rhs, now)) {
+			continue
+		}
+		if best < 0 || diff < math.Abs(queue[best].rating-rhs.rating) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (u *useCase) window(v enqueuedClient, now time.Time) float64 {
+	if u.ratingWindow <= 0 {
+		return math.Inf(1)
+	}
+	return u.ratingWindow + u.windowGrowth*now.Sub(v.enqueuedAt).Seconds()
+}
+
+/* pairWaiting pairs the clients whose windows have widened enough, the longest waiting ones go first */
+func (u *useCase) pairWaiting(queue []enqueuedClient, now time.Time) []enqueuedClient {
+	for i := 0; i < len(queue); {
+		lhs := queue[i]
+		j := u.opponent(queue[i+1:], lhs, now)
+		if j < 0 {
+			i++
+			continue
+		}
+		rhs := queue[i+1+j]
+		queue = slices.Delete(queue, i+1+j, i+2+j)
+		queue = slices.Delete(queue, i, i+1)
+		u.startRatedGame(lhs, rhs)
+	}
+	return queue
+}
+
+/* startBotGames gives a bot to the clients nobody has been paired with for botWait */
+func (u *useCase) startBotGames(queue []enqueuedClient, now time.Time) []enqueuedClient {
+	if u.botWait <= 0 {
+		return queue
+	}
+	return slices.DeleteFunc(queue, func(v enqueuedClient) bool {
+		if now.Sub(v.enqueuedAt) < u.botWait {
+			return false
+		}
+		u.logger.Info("nobody to pair with, starting game against bot",
+			zap.String("client uuid", v.client.Uuid()))
+		u.startBotGame(v, u.botDifficulty)
+		return true
+	})
+}
+
+/* the one who has waited longer plays X, the series is started if the players have asked for it */
+func (u *useCase) startRatedGame(lhs enqueuedClient, rhs enqueuedClient) {
+	var series *domain.Series
+	if bestOf := rhs.client.Preferences().BestOf; bestOf > 0 {
+		series = newSeries(lhs.client.Uuid(), rhs.client.Uuid(), rhs.rules.Variant(), bestOf, true)
+	}
+	gameUuid, moveChan := u.createGame(lhs.client.Uuid(), rhs.client.Uuid(), rhs.rules, "", true, series)
+	lhs.resultChan <- domain.NewPlayer(gameUuid, lhs.client, domain.X, moveChan)
+	rhs.resultChan <- domain.NewPlayer(gameUuid, rhs.client, domain.O, moveChan)
+}
@@ -0,0 +1,177 @@
+package hub
+
+import (
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	inviteCodeLength   = 6
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" /* без похожих друг на друга 0/O и 1/I */
+)
+
+/*
+ * enterRoom opens the owner's room (or reopens it after failover) or joins a room by the invite code.
+ * The owner and a guest wait for each other, whoever comes second starts the game
+ * (or the series the owner has asked for), the owner always plays X. A second guest isn't let in
+ */
+func (u *useCase) enterRoom(client domain.Client) (domain.Player, error) {
+	prefs := client.Preferences()
+	u.mu.Lock()
+	room, err := u.openRoom(client.Uuid(), prefs)
+	if err != nil {
+		u.mu.Unlock()
+		u.sendMessage(client, domain.Message{Type: domain.RoomNotFound, Payload: domain.RoomPayload{Code: prefs.RoomCode}})
+		return domain.Player{}, errors.WithMessagef(err, "open room '%s'", prefs.RoomCode)
+	}
+	rules, err := u.rules.Rules(room.Variant)
+	if err != nil {
+		u.mu.Unlock()
+		return domain.Player{}, errors.WithMessage(err, "resolve room rules")
+	}
+	mate, ok := u.roomWaiters[room.Code]
+	if ok && mate.client.Uuid() == client.Uuid() {
+		/* the same client has reconnected, its previous connection stops waiting */
+		close(mate.resultChan)
+		ok = false
+	}
+	if ok && client.Uuid() != room.Owner && mate.client.Uuid() != room.Owner {
+		u.mu.Unlock()
+		u.sendMessage(client, domain.Message{Type: domain.RoomNotFound, Payload: domain.RoomPayload{Code: room.Code}})
+		return domain.Player{}, errors.WithMessagef(domain.ErrRoomTaken, "room '%s'", room.Code)
+	}
+	if !ok {
+		waiter := enqueuedClient{
+			client:     client,
+			rules:      rules,
+			enqueuedAt: time.Now(),
+			resultChan: make(chan domain.Player),
+		}
+		u.roomWaiters[room.Code] = waiter
+		u.mu.Unlock()
+		u.sendMessage(client, domain.Message{Type: domain.RoomWaiting, Payload: domain.RoomPayload{Code: room.Code}})
+		return u.waitInRoom(room.Code, waiter)
+	}
+	delete(u.roomWaiters, room.Code)
+	delete(u.rooms, room.Code)
+	u.changes.Append(domain.Change{Kind: domain.RoomRemoved, RoomCode: room.Code})
+	u.mu.Unlock()
+
+	selfCell, mateCell := domain.X, domain.O
+	playerX, playerO := client.Uuid(), mate.client.Uuid()
+	if client.Uuid() != room.Owner {
+		selfCell, mateCell = domain.O, domain.X
+		playerX, playerO = playerO, playerX
+	}
+	var series *domain.Series
+	if room.BestOf > 0 {
+		series = newSeries(playerX, playerO, room.Variant, room.BestOf, false)
+	}
+	gameUuid, moveChan := u.createGame(playerX, playerO, rules, "", false, series)
+	u.logger.Info("room game started", zap.String("room code", room.Code), zap.String("game uuid", gameUuid))
+	mate.resultChan <- domain.NewPlayer(gameUuid, mate.client, mateCell, moveChan)
+	return domain.NewPlayer(gameUuid, client, selfCell, moveChan), nil
+}
+
+/* waitInRoom waits for the mate, the waiter whose connection has died leaves the room */
+func (u *useCase) waitInRoom(code string, waiter enqueuedClient) (domain.Player, error) {
+	ticker := time.NewTicker(roomPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case player, ok := <-waiter.resultChan:
+			if !ok {
+				u.sendMessage(waiter.client,
+					domain.Message{Type: domain.RoomNotFound, Payload: domain.RoomPayload{Code: code}})
+				return domain.Player{}, errors.WithMessagef(domain.ErrRoomNotFound, "room '%s' is closed", code)
+			}
+			return player, nil
+		case <-ticker.C:
+			err := waiter.client.Ping()
+			if err == nil {
+				continue
+			}
+			u.mu.Lock()
+			if v, ok := u.roomWaiters[code]; ok && v.resultChan == waiter.resultChan {
+				delete(u.roomWaiters, code)
+				u.mu.Unlock()
+				return domain.Player{}, errors.WithMessagef(err, "wait in room '%s'", code)
+			}
+			u.mu.Unlock() /* the mate has already come, the game is on its way */
+		}
+	}
+}
+
+/* openRoom is called under the lock */
+func (u *useCase) openRoom(clientUuid string, prefs domain.Preferences) (*domain.Room, error) {
+	if prefs.RoomCode != "" {
+		room, ok := u.rooms[prefs.RoomCode]
+		if !ok {
+			return nil, domain.ErrRoomNotFound
+		}
+		return room, nil
+	}
+	for _, room := range u.rooms {
+		if room.Owner == clientUuid {
+			return room, nil
+		}
+	}
+	rules, err := u.rules.Choose(prefs.Variant)
+	if err != nil {
+		return nil, errors.WithMessage(err, "choose game rules")
+	}
+	room := &domain.Room{
+		Code:      u.newInviteCode(),
+		Owner:     clientUuid,
+		Variant:   rules.Variant(),
+		BestOf:    prefs.BestOf,
+		CreatedAt: time.Now(),
+	}
+	u.rooms[room.Code] = room
+	roomCopy := *room
+	u.changes.Append(domain.Change{Kind: domain.RoomChanged, RoomCode: room.Code, Room: &roomCopy})
+	u.logger.Info("room created", zap.String("room code", room.Code), zap.String("owner", clientUuid))
+	return room, nil
+}
+
+func (u *useCase) newInviteCode() string {
+	for {
+		var sb strings.Builder
+		for i := 0; i < inviteCodeLength; i++ {
+			sb.WriteByte(inviteCodeAlphabet[rand.IntN(len(inviteCodeAlphabet))])
+		}
+		if _, ok := u.rooms[sb.String()]; !ok {
+			return sb.String()
+		}
+	}
+}
+
+func (u *useCase) removeExpiredRooms() {
+	if u.roomTTL <= 0 {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for code, room := range u.rooms {
+		if time.Since(room.CreatedAt) < u.roomTTL {
+			continue
+		}
+		delete(u.rooms, code)
+		u.changes.Append(domain.Change{Kind: domain.RoomRemoved, RoomCode: code})
+		if v, ok := u.roomWaiters[code]; ok {
+			delete(u.roomWaiters, code)
+			close(v.resultChan)
+		}
+	}
+}
+
+func (u *useCase) sendMessage(client domain.Client, msg domain.Message) {
+	if err := client.WriteMessage(msg); err != nil {
+		u.logger.Warn("send room message", zap.String("client uuid", client.Uuid()), zap.Error(err))
+	}
+}
@@ -0,0 +1,240 @@
+package hub
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	seriesWonResult      = "Серия выиграна"
+	seriesLostResult     = "Серия проиграна"
+	seriesDrawResult     = "Серия закончилась вничью"
+	seriesWalkoverResult = "Серия выиграна (соперник не вернулся)"
+)
+
+func newSeries(playerX string, playerO string, variant string, bestOf int, rated bool) *domain.Series {
+	return &domain.Series{
+		Id:        uuid.NewString(),
+		Players:   [2]string{playerX, playerO},
+		Variant:   variant,
+		BestOf:    bestOf,
+		Rated:     rated,
+		Status:    domain.SeriesInProgress,
+		UpdatedAt: time.Now(),
+	}
+}
+
+/* addSeriesGame is called under the lock */
+func (u *useCase) addSeriesGame(series *domain.Series, gameUuid string, state *domain.GameState) {
+	series.Games = append(series.Games, domain.SeriesGame{GameUuid: gameUuid})
+	series.UpdatedAt = state.CreatedAt
+	u.series[series.Id] = series
+	state.SeriesId = series.Id
+	u.publishSeries(series)
+}
+
+/* publishSeries is called under the lock */
+func (u *useCase) publishSeries(series *domain.Series) {
+	u.changes.Append(domain.Change{Kind: domain.SeriesChanged, SeriesId: series.Id, Series: series.Clone()})
+}
+
+/*
+ * recordSeriesGame scores the finished game of a series, it's called under the lock.
+ * The owner of the game and the master score it independently, so recording the same game twice changes nothing
+ */
+func (u *useCase) recordSeriesGame(gameUuid string, state *domain.GameState) {
+	series, ok := u.series[state.SeriesId]
+	if !ok || state.Status != domain.Finished || state.Outcome == nil {
+		return
+	}
+	if series.Record(gameUuid, winnerOf(state), state.FinishedAt) {
+		u.publishSeries(series)
+		u.logger.Info("series game recorded", zap.String("series id", series.Id), zap.String("game uuid", gameUuid),
+			zap.Any("score", series.Score), zap.Any("status", series.Status))
+	}
+}
+
+/* sendSeriesScore tells the player the score of the series after its game is over */
+func (u *useCase) sendSeriesScore(client domain.Client, gameUuid string) {
+	u.mu.Lock()
+	state, ok := u.gamesStates[gameUuid]
+	if !ok {
+		u.mu.Unlock()
+		return
+	}
+	snapshot := u.game.Snapshot(state)
+	u.recordSeriesGame(gameUuid, snapshot)
+	series, ok := u.series[snapshot.SeriesId]
+	if !ok {
+		u.mu.Unlock()
+		return
+	}
+	payload := domain.NewSeriesPayload(series, client.Uuid(), seriesResult(series, client.Uuid()))
+	u.mu.Unlock()
+	u.sendMessage(client, domain.Message{Type: domain.SeriesScore, Payload: payload})
+}
+
+func seriesResult(series *domain.Series, player string) *string {
+	var result string
+	switch {
+	case series.Status != domain.SeriesFinished:
+		return nil
+	case series.Winner == "":
+		result = seriesDrawResult
+	case series.Winner != player:
+		result = seriesLostResult
+	case series.Walkover:
+		result = seriesWalkoverResult
+	default:
+		result = seriesWonResult
+	}
+	return &result
+}
+
+/*
+ * enterRematch starts the next game of the series or a rematch after the finished game, the colors are swapped.
+ * Like in a room, the first of the players waits for the second one, but only for rematchTimeout
+ */
+func (u *useCase) enterRematch(client domain.Client) (domain.Player, error) {
+	prevUuid := client.Preferences().Rematch
+	payload := domain.RematchPayload{GameUuid: prevUuid}
+	u.mu.Lock()
+	series, err := u.rematchSeries(client.Uuid(), prevUuid)
+	if err != nil {
+		u.mu.Unlock()
+		u.sendMessage(client, domain.Message{Type: domain.RematchNotFound, Payload: payload})
+		return domain.Player{}, errors.WithMessagef(err, "rematch game '%s'", prevUuid)
+	}
+	prev := u.gamesStates[prevUuid]
+	rules, err := u.rules.Rules(prev.Variant)
+	if err != nil {
+		u.mu.Unlock()
+		return domain.Player{}, errors.WithMessage(err, "resolve rematch rules")
+	}
+	mate, ok := u.rematchWaiters[prevUuid]
+	if ok && mate.client.Uuid() == client.Uuid() {
+		/* the same client has reconnected, its previous connection stops waiting */
+		close(mate.resultChan)
+		ok = false
+	}
+	if !ok {
+		ch := make(chan domain.Player)
+		u.rematchWaiters[prevUuid] = enqueuedClient{
+			client:     client,
+			rules:      rules,
+			enqueuedAt: time.Now(),
+			resultChan: ch,
+		}
+		u.mu.Unlock()
+		u.sendMessage(client, domain.Message{Type: domain.RematchWaiting, Payload: payload})
+		player, ok := <-ch
+		if !ok {
+			u.sendSeriesScore(client, prevUuid)
+			u.sendMessage(client, domain.Message{Type: domain.RematchDeclined, Payload: payload})
+			return domain.Player{}, errors.WithMessagef(domain.ErrRematchDeclined, "rematch game '%s'", prevUuid)
+		}
+		return player, nil
+	}
+	delete(u.rematchWaiters, prevUuid)
+	playerX, playerO := prev.PlayerO, prev.PlayerX
+	if series == nil {
+		series = newSeries(prev.PlayerX, prev.PlayerO, prev.Variant, 0, prev.Rated)
+		series.Games = []domain.SeriesGame{{GameUuid: prevUuid}}
+		series.Record(prevUuid, winnerOf(prev), prev.FinishedAt)
+	}
+	u.mu.Unlock()
+
+	selfCell, mateCell := domain.X, domain.O
+	if client.Uuid() != playerX {
+		selfCell, mateCell = domain.O, domain.X
+	}
+	gameUuid, moveChan := u.createGame(playerX, playerO, rules, "", series.Rated, series)
+	u.logger.Info("rematch started", zap.String("previous game uuid", prevUuid), zap.String("game uuid", gameUuid),
+		zap.String("series id", series.Id))
+	mate.resultChan <- domain.NewPlayer(gameUuid, mate.client, mateCell, moveChan)
+	return domain.NewPlayer(gameUuid, client, selfCell, moveChan), nil
+}
+
+/*
+ * rematchSeries checks that the client may play the finished game again and returns its series,
+ * nil if the rematch starts a new one. It's called under the lock
+ */
+func (u *useCase) rematchSeries(clientUuid string, prevUuid string) (*domain.Series, error) {
+	prev, ok := u.gamesStates[prevUuid]
+	switch {
+	case !ok, prev.Status != domain.Finished, prev.Outcome == nil:
+		return nil, domain.ErrRematchNotFound
+	case clientUuid != prev.PlayerX && clientUuid != prev.PlayerO:
+		return nil, errors.WithMessage(domain.ErrRematchNotFound, "the client hasn't played the game")
+	case domain.IsBot(prev.PlayerX) || domain.IsBot(prev.PlayerO):
+		return nil, errors.WithMessage(domain.ErrRematchNotFound, "bots don't play rematches")
+	case prev.TournamentId != "":
+		return nil, errors.WithMessage(domain.ErrRematchNotFound, "the tournament plays its games itself")
+	}
+	for _, series := range u.series {
+		i := slices.IndexFunc(series.Games, func(v domain.SeriesGame) bool {
+			return v.GameUuid == prevUuid
+		})
+		if i >= 0 && i < len(series.Games)-1 {
+			return nil, errors.WithMessage(domain.ErrRematchNotFound, "the rematch has already been played")
+		}
+	}
+	if series, ok := u.series[prev.SeriesId]; ok && series.Status == domain.SeriesInProgress {
+		return series, nil
+	}
+	return nil, nil
+}
+
+func winnerOf(state *domain.GameState) string {
+	switch state.Outcome.Winner {
+	case domain.X:
+		return state.PlayerX
+	case domain.O:
+		return state.PlayerO
+	default:
+		return ""
+	}
+}
+
+/* removeExpiredRematches stops waiting for the players who haven't come back, the one who has wins the series */
+func (u *useCase) removeExpiredRematches() {
+	if u.rematchTimeout <= 0 {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for prevUuid, v := range u.rematchWaiters {
+		if time.Since(v.enqueuedAt) < u.rematchTimeout {
+			continue
+		}
+		delete(u.rematchWaiters, prevUuid)
+		if prev, ok := u.gamesStates[prevUuid]; ok {
+			if series, ok := u.series[prev.SeriesId]; ok && series.BestOf > 0 &&
+				series.Status == domain.SeriesInProgress && series.LastGame() == prevUuid {
+				series.Forfeit(v.client.Uuid(), time.Now())
+				u.publishSeries(series)
+			}
+		}
+		close(v.resultChan)
+	}
+}
+
+/* a series is kept for recordTTL after its last game like the games themselves */
+func (u *useCase) removeFinishedSeries() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id, series := range u.series {
+		finished := !slices.ContainsFunc(series.Games, func(v domain.SeriesGame) bool {
+			return !v.Finished
+		})
+		if finished && time.Since(series.UpdatedAt) >= u.recordTTL {
+			delete(u.series, id)
+			u.changes.Append(domain.Change{Kind: domain.SeriesRemoved, SeriesId: id})
+		}
+	}
+}
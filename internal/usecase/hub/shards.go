@@ -0,0 +1,153 @@
+package hub
+
+import (
+	"context"
+	"hash/fnv"
+	"slices"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"go.uber.org/zap"
+)
+
+/*
+ * When games are sharded the master still pairs the players, but places every new game
+ * on the live server with the fewest running games and sends the players there.
+ * The owner hands the changes of its games to the master, so every server keeps a copy of every game
+ * and the master reassigns the games of a failed server together with their states
+ */
+
+/* servedElsewhere is called under the lock, it returns the server the players of the game are sent to */
+func (u *useCase) servedElsewhere(state *domain.GameState) (string, bool) {
+	if !u.router.Sharded() {
+		return "", false
+	}
+	owner := state.Owner
+	if owner == "" {
+		owner = u.router.MasterName()
+	}
+	return owner, owner != u.router.ServerName()
+}
+
+func (u *useCase) redirect(client domain.Client, server string) {
+	u.logger.Info("sending client to the owner of its game",
+		zap.String("client uuid", client.Uuid()), zap.String("owner", server))
+	err := client.WriteMessage(domain.Message{
+		Type:    domain.SwitchServer,
+		Payload: domain.SwitchServerPayload{MasterServer: server},
+	})
+	if err != nil {
+		u.logger.Warn("send switch server message", zap.String("client uuid", client.Uuid()), zap.Error(err))
+	}
+}
+
+/*
+ * placeGame is called under the lock, ties between the least loaded servers are broken by rendezvous hashing.
+ * The game is served by the master itself if every server drains
+ */
+func (u *useCase) placeGame(gameUuid string) string {
+	if !u.router.Sharded() {
+		return ""
+	}
+	servers := u.router.AcceptingServers()
+	load := make(map[string]int, len(servers))
+	for _, state := range u.gamesStates {
+		if state.Status != domain.Finished && slices.Contains(servers, state.Owner) {
+			load[state.Owner]++
+		}
+	}
+	best := ""
+	for _, server := range servers {
+		switch {
+		case best == "", load[server] < load[best]:
+			best = server
+		case load[server] == load[best] && shardScore(gameUuid, server) > shardScore(gameUuid, best):
+			best = server
+		}
+	}
+	return best
+}
+
+func shardScore(gameUuid string, server string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(gameUuid))
+	_, _ = h.Write([]byte(server))
+	return h.Sum64()
+}
+
+/* publishGame is called under the lock for the games the master places or reassigns without playing them */
+func (u *useCase) publishGame(gameUuid string, state *domain.GameState) {
+	snapshot := state.Clone()
+	if err := u.storage.Save(context.Background(), gameUuid, snapshot); err != nil {
+		u.logger.Error("save game state", zap.String("game uuid", gameUuid), zap.Error(err))
+	}
+	u.changes.Append(domain.Change{Kind: domain.GameChanged, GameUuid: gameUuid, State: snapshot})
+}
+
+/*
+ * keepsOwnGame is called under the lock. The owner plays its games itself,
+ * the copies the master ships back are never newer than the owner's state
+ */
+func (u *useCase) keepsOwnGame(gameUuid string, incoming *domain.GameState) bool {
+	if !u.router.Sharded() {
+		return false
+	}
+	state, ok := u.gamesStates[gameUuid]
+	return ok && state.MoveChan != nil && state.Owner == u.router.ServerName() && incoming.Owner == state.Owner
+}
+
+/* reassignGames moves the running games of the servers the master has lost contact with to the live ones */
+func (u *useCase) reassignGames() {
+	if !u.router.Sharded() || u.router.MasterName() != u.router.ServerName() {
+		return
+	}
+	live := u.router.LiveServers()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for gameUuid, state := range u.gamesStates {
+		if state.Status == domain.Finished || state.Owner == "" || slices.Contains(live, state.Owner) {
+			continue
+		}
+		owner := u.placeGame(gameUuid)
+		u.logger.Warn("reassigning game of the failed server", zap.String("game uuid", gameUuid),
+			zap.String("failed server", state.Owner), zap.String("owner", owner))
+		state.Owner = owner
+		state.MoveChan = nil
+		u.publishGame(gameUuid, state)
+	}
+}
+
+/* Owner returns the server serving the game, it's empty unless games are sharded */
+func (u *useCase) Owner(gameUuid string) (string, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	state, ok := u.gamesStates[gameUuid]
+	if !ok {
+		return "", false
+	}
+	return state.Owner, true
+}
+
+/* ActiveGame returns the game the client is playing */
+func (u *useCase) ActiveGame(clientUuid string) (string, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for gameUuid, state := range u.gamesStates {
+		if state.Status != domain.Finished && (state.PlayerX == clientUuid || state.PlayerO == clientUuid) {
+			return gameUuid, true
+		}
+	}
+	return "", false
+}
+
+/* LiveGames returns the number of the games being played on this server */
+func (u *useCase) LiveGames() int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	count := 0
+	for _, state := range u.gamesStates {
+		if state.Status != domain.Finished && state.MoveChan != nil {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,51 @@
+package hub
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+)
+
+/*
+ * PlayerStats and StatsLeaderboard count the finished games the hub still keeps on top of the recorded stats.
+ * The stats are asked under the lock, so a game being removed is never counted twice or missed
+ */
+func (u *useCase) PlayerStats(accountId string) (domain.StatsEntry, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	_, recent := u.finishedGames(func(state *domain.GameState) bool {
+		return state.PlayerX == accountId || state.PlayerO == accountId
+	})
+	return u.stats.Stats(accountId, recent)
+}
+
+func (u *useCase) StatsLeaderboard(stat domain.Stat, offset int, limit int) ([]domain.StatsEntry, int) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	_, recent := u.finishedGames(func(*domain.GameState) bool {
+		return true
+	})
+	return u.stats.Leaderboard(stat, offset, limit, recent)
+}
+
+/* finishedGames returns the matching finished games in the order they have finished, it's called under the lock */
+func (u *useCase) finishedGames(filter func(state *domain.GameState) bool) ([]string, []*domain.GameState) {
+	var gameUuids []string
+	for gameUuid, state := range u.gamesStates {
+		if state.Status == domain.Finished && filter(state) {
+			gameUuids = append(gameUuids, gameUuid)
+		}
+	}
+	slices.SortFunc(gameUuids, func(lhs string, rhs string) int {
+		return cmp.Or(
+			u.gamesStates[lhs].FinishedAt.Compare(u.gamesStates[rhs].FinishedAt),
+			cmp.Compare(lhs, rhs),
+		)
+	})
+	states := make([]*domain.GameState, 0, len(gameUuids))
+	for _, gameUuid := range gameUuids {
+		states = append(states, u.gamesStates[gameUuid])
+	}
+	return gameUuids, states
+}
@@ -0,0 +1,471 @@
+package hub
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	maxTournamentName    = 64
+	maxTournamentPlayers = 256
+	maxReplays           = 2 /* a knockout match drawn after the replays goes to the higher seed */
+)
+
+/*
+ * Tournaments are run by the master: it pairs the rounds and creates their games like matchmaking does,
+ * every change of a tournament is replicated as a whole. The players of a pairing are sent to its game
+ * when they connect (see continueActiveGame), the ones who have come for the next round wait for it in enterTournament
+ */
+
+func (u *useCase) CreateTournament(_ context.Context, organizer string,
+	req domain.CreateTournamentRequest) (domain.Tournament, error) {
+	if !u.isMaster() {
+		return domain.Tournament{}, domain.ErrNotLeader
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxTournamentName {
+		return domain.Tournament{}, errors.WithMessagef(domain.ErrBadTournament, "name '%s'", req.Name)
+	}
+	if req.MaxPlayers != 0 && (req.MaxPlayers < 2 || req.MaxPlayers > maxTournamentPlayers) {
+		return domain.Tournament{}, errors.WithMessagef(domain.ErrBadTournament, "max players %d", req.MaxPlayers)
+	}
+	format, err := domain.ParseTournamentFormat(string(req.Format))
+	if err != nil {
+		return domain.Tournament{}, err
+	}
+	rules, err := u.rules.Choose(req.Variant)
+	if err != nil {
+		return domain.Tournament{}, errors.WithMessage(err, "choose game rules")
+	}
+	now := time.Now()
+	tournament := &domain.Tournament{
+		Id:         uuid.NewString(),
+		Name:       name,
+		Format:     format,
+		Variant:    rules.Variant(),
+		Organizer:  organizer,
+		MaxPlayers: req.MaxPlayers,
+		Players:    []string{},
+		Status:     domain.TournamentRegistration,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.tournaments[tournament.Id] = tournament
+	u.publishTournament(tournament)
+	u.logger.Info("tournament created", zap.String("tournament id", tournament.Id),
+		zap.String("organizer", organizer), zap.Any("format", format))
+	return *tournament.Clone(), nil
+}
+
+func (u *useCase) JoinTournament(_ context.Context, tournamentId string, accountId string) error {
+	if !u.isMaster() {
+		return domain.ErrNotLeader
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	tournament, ok := u.tournaments[tournamentId]
+	switch {
+	case !ok:
+		return errors.WithMessagef(domain.ErrTournamentNotFound, "tournament '%s'", tournamentId)
+	case slices.Contains(tournament.Players, accountId):
+		return nil
+	case tournament.Status != domain.TournamentRegistration:
+		return domain.ErrRegistrationClosed
+	case tournament.MaxPlayers > 0 && len(tournament.Players) >= tournament.MaxPlayers:
+		return domain.ErrTournamentFull
+	}
+	tournament.Players = append(tournament.Players, accountId)
+	tournament.UpdatedAt = time.Now()
+	u.publishTournament(tournament)
+	return nil
+}
+
+func (u *useCase) StartTournament(_ context.Context, tournamentId string, accountId string) error {
+	if !u.isMaster() {
+		return domain.ErrNotLeader
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	tournament, ok := u.tournaments[tournamentId]
+	switch {
+	case !ok:
+		return errors.WithMessagef(domain.ErrTournamentNotFound, "tournament '%s'", tournamentId)
+	case tournament.Organizer != accountId:
+		return domain.ErrNotOrganizer
+	case tournament.Status != domain.TournamentRegistration:
+		return domain.ErrRegistrationClosed
+	case len(tournament.Players) < 2:
+		return domain.ErrNotEnoughPlayers
+	}
+	slices.SortStableFunc(tournament.Players, func(lhs string, rhs string) int {
+		return cmp.Compare(u.ratings.Rating(rhs).Rating, u.ratings.Rating(lhs).Rating)
+	})
+	if tournament.Format == domain.RoundRobin {
+		tournament.Rounds = roundRobinRounds(tournament.Players)
+	} else {
+		tournament.Rounds = []domain.TournamentRound{firstKnockoutRound(tournament.Players)}
+	}
+	tournament.Status = domain.TournamentInProgress
+	tournament.Round = 0
+	tournament.UpdatedAt = time.Now()
+	u.startRound(tournament)
+	u.publishTournament(tournament)
+	u.logger.Info("tournament started", zap.String("tournament id", tournament.Id),
+		zap.Int("players", len(tournament.Players)), zap.Int("rounds", len(tournament.Rounds)))
+	return nil
+}
+
+func (u *useCase) Tournament(tournamentId string) (domain.TournamentResponse, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	tournament, ok := u.tournaments[tournamentId]
+	if !ok {
+		return domain.TournamentResponse{}, false
+	}
+	return domain.TournamentResponse{
+		Tournament: *tournament.Clone(),
+		Standings:  standings(tournament, u.playerName),
+	}, true
+}
+
+/* Tournaments returns the tournaments from the newest one, without their rounds */
+func (u *useCase) Tournaments() []domain.Tournament {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	tournaments := make([]domain.Tournament, 0, len(u.tournaments))
+	for _, v := range u.tournaments {
+		tournament := *v.Clone()
+		tournament.Rounds = nil
+		tournaments = append(tournaments, tournament)
+	}
+	slices.SortFunc(tournaments, func(lhs domain.Tournament, rhs domain.Tournament) int {
+		return cmp.Or(rhs.CreatedAt.Compare(lhs.CreatedAt), cmp.Compare(lhs.Id, rhs.Id))
+	})
+	return tournaments
+}
+
+func (u *useCase) playerName(accountId string) string {
+	if name, ok := u.accounts.Name(accountId); ok {
+		return name
+	}
+	return accountId
+}
+
+/*
+ * isMaster tells whether the server is the master, sharded or not. Only the master changes the tournaments,
+ * the others return domain.ErrNotLeader and get the tournaments through the log
+ */
+func (u *useCase) isMaster() bool {
+	return u.router.MasterName() == u.router.ServerName()
+}
+
+/* publishTournament is called under the lock */
+func (u *useCase) publishTournament(tournament *domain.Tournament) {
+	u.changes.Append(domain.Change{
+		Kind:         domain.TournamentChanged,
+		TournamentId: tournament.Id,
+		Tournament:   tournament.Clone(),
+	})
+}
+
+/* startRound creates the games of the current round, it's called under the lock */
+func (u *useCase) startRound(tournament *domain.Tournament) {
+	pairings := tournament.Rounds[tournament.Round].Pairings
+	for i := range pairings {
+		if !pairings[i].Finished && pairings[i].GameUuid == "" {
+			u.startPairing(tournament, &pairings[i])
+		}
+	}
+}
+
+/* startPairing creates the game of the pairing and sends the waiting players to it, it's called under the lock */
+func (u *useCase) startPairing(tournament *domain.Tournament, p *domain.Pairing) {
+	rules, err := u.rules.Rules(tournament.Variant)
+	if err != nil {
+		u.logger.Error("resolve tournament rules", zap.String("tournament id", tournament.Id), zap.Error(err))
+		u.forfeit(tournament, p)
+		return
+	}
+	gameUuid, state := u.newGame(p.PlayerX, p.PlayerO, rules, "", true)
+	state.TournamentId = tournament.Id
+	moveChan := u.addGame(gameUuid, state)
+	p.GameUuid = gameUuid
+	for cell, player := range map[domain.Cell]string{domain.X: p.PlayerX, domain.O: p.PlayerO} {
+		v, ok := u.tournamentWaiters[player]
+		if !ok || v.client.Preferences().Tournament != tournament.Id {
+			continue
+		}
+		delete(u.tournamentWaiters, player)
+		v.resultChan <- domain.NewPlayer(gameUuid, v.client, cell, moveChan)
+	}
+	u.logger.Info("tournament game created", zap.String("tournament id", tournament.Id),
+		zap.Int("round", tournament.Round), zap.String("game uuid", gameUuid))
+}
+
+/*
+ * advanceTournaments scores the finished games of the current rounds and starts the next ones.
+ * The games nobody has come to within startTimeout are cancelled and forfeited
+ */
+func (u *useCase) advanceTournaments() {
+	if !u.isMaster() {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, tournament := range u.tournaments {
+		if tournament.Status != domain.TournamentInProgress || !u.advanceTournament(tournament) {
+			continue
+		}
+		tournament.UpdatedAt = time.Now()
+		u.publishTournament(tournament)
+		u.releaseTournamentWaiters(tournament)
+	}
+}
+
+/* advanceTournament is called under the lock, false means that nothing has changed */
+func (u *useCase) advanceTournament(tournament *domain.Tournament) bool {
+	changed := false
+	pairings := tournament.Rounds[tournament.Round].Pairings
+	for i := range pairings {
+		p := &pairings[i]
+		if p.Finished {
+			continue
+		}
+		state, ok := u.gamesStates[p.GameUuid]
+		if !ok {
+			u.forfeit(tournament, p) /* the game has been lost */
+			changed = true
+			continue
+		}
+		snapshot := u.game.Snapshot(state)
+		switch {
+		case snapshot.Status == domain.Finished && snapshot.Outcome != nil:
+			u.recordPairing(tournament, p, snapshot)
+			changed = true
+		case snapshot.Status == domain.ReadyToStart && u.startTimeout > 0 &&
+			time.Since(snapshot.CreatedAt) >= u.startTimeout:
+			u.logger.Info("nobody has come to the tournament game", zap.String("game uuid", p.GameUuid))
+			u.cancelGame(p.GameUuid)
+			u.forfeit(tournament, p)
+			changed = true
+		}
+	}
+	for !slices.ContainsFunc(tournament.Rounds[tournament.Round].Pairings, func(v domain.Pairing) bool {
+		return !v.Finished
+	}) {
+		round := tournament.Rounds[tournament.Round]
+		switch {
+		case tournament.Format == domain.RoundRobin && tournament.Round+1 < len(tournament.Rounds):
+		case tournament.Format == domain.SingleElimination && len(round.Pairings) > 1:
+			tournament.Rounds = append(tournament.Rounds, nextKnockoutRound(tournament, round))
+		default:
+			u.finishTournament(tournament)
+			return true
+		}
+		tournament.Round++
+		u.startRound(tournament)
+		changed = true
+	}
+	return changed
+}
+
+/* recordPairing scores the finished game, a drawn knockout match is replayed with the colors swapped */
+func (u *useCase) recordPairing(tournament *domain.Tournament, p *domain.Pairing, state *domain.GameState) {
+	winner := winnerOf(state)
+	if winner == "" && tournament.Format == domain.SingleElimination {
+		if p.Draws < maxReplays {
+			p.Draws++
+			p.PlayerX, p.PlayerO = p.PlayerO, p.PlayerX
+			u.startPairing(tournament, p)
+			return
+		}
+		winner = higherSeed(tournament, *p)
+	}
+	p.Finished, p.Winner = true, winner
+}
+
+/* forfeit finishes the pairing nobody has played: both lose in a round robin, the higher seed goes through a knockout */
+func (u *useCase) forfeit(tournament *domain.Tournament, p *domain.Pairing) {
+	p.Finished, p.Forfeit = true, true
+	if tournament.Format == domain.SingleElimination {
+		p.Winner = higherSeed(tournament, *p)
+	}
+}
+
+/* cancelGame removes the game that hasn't started, it's called under the lock */
+func (u *useCase) cancelGame(gameUuid string) {
+	delete(u.gamesStates, gameUuid)
+	u.deleteStored(gameUuid)
+	u.spectators.Drop(gameUuid)
+	u.changes.Append(domain.Change{Kind: domain.GameRemoved, GameUuid: gameUuid})
+}
+
+func (u *useCase) finishTournament(tournament *domain.Tournament) {
+	tournament.Status = domain.TournamentFinished
+	if tournament.Format == domain.SingleElimination {
+		final := tournament.Rounds[len(tournament.Rounds)-1]
+		tournament.Winner = final.Pairings[0].Winner
+	} else {
+		tournament.Winner = standings(tournament, u.playerName)[0].AccountId
+	}
+	u.logger.Info("tournament finished", zap.String("tournament id", tournament.Id),
+		zap.String("winner", tournament.Winner))
+}
+
+/* isOut tells whether the tournament has no more games for the player */
+func isOut(tournament *domain.Tournament, player string) bool {
+	if tournament.Status == domain.TournamentFinished {
+		return true
+	}
+	if tournament.Format != domain.SingleElimination {
+		return false
+	}
+	for _, round := range tournament.Rounds {
+		for _, p := range round.Pairings {
+			if p.Finished && p.Winner != player && (p.PlayerX == player || p.PlayerO == player) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/* releaseTournamentWaiters stops waiting for the players the tournament is over for, it's called under the lock */
+func (u *useCase) releaseTournamentWaiters(tournament *domain.Tournament) {
+	for player, v := range u.tournamentWaiters {
+		if v.client.Preferences().Tournament == tournament.Id && isOut(tournament, player) {
+			delete(u.tournamentWaiters, player)
+			close(v.resultChan)
+		}
+	}
+}
+
+/* tournamentPayload is called under the lock, it's the place of the player once the tournament is over for it */
+func (u *useCase) tournamentPayload(tournament *domain.Tournament, player string) domain.TournamentPayload {
+	payload := domain.TournamentPayload{TournamentId: tournament.Id, Round: tournament.Round + 1}
+	if !isOut(tournament, player) {
+		return payload
+	}
+	i := slices.IndexFunc(standings(tournament, u.playerName), func(v domain.StandingEntry) bool {
+		return v.AccountId == player
+	})
+	payload.Place = i + 1
+	if tournament.Winner != "" {
+		payload.Winner = u.playerName(tournament.Winner)
+	}
+	return payload
+}
+
+/*
+ * enterTournament waits for the next game of the player in the tournament, the game of the current round
+ * may have been created right after the client has been looked for in the active games
+ */
+func (u *useCase) enterTournament(client domain.Client) (domain.Player, error) {
+	tournamentId := client.Preferences().Tournament
+	u.mu.Lock()
+	tournament, ok := u.tournaments[tournamentId]
+	if !ok || !slices.Contains(tournament.Players, client.Uuid()) {
+		u.mu.Unlock()
+		u.sendMessage(client, domain.Message{
+			Type:    domain.TournamentNotFound,
+			Payload: domain.TournamentPayload{TournamentId: tournamentId},
+		})
+		return domain.Player{}, errors.WithMessagef(domain.ErrNotRegistered, "tournament '%s'", tournamentId)
+	}
+	payload := u.tournamentPayload(tournament, client.Uuid())
+	if payload.Place > 0 {
+		u.mu.Unlock()
+		u.sendMessage(client, domain.Message{Type: domain.TournamentOver, Payload: payload})
+		return domain.Player{}, errors.WithMessagef(domain.ErrTournamentFinished, "tournament '%s'", tournamentId)
+	}
+	if u.hasPendingGame(tournament, client.Uuid()) {
+		u.mu.Unlock()
+		if player, ok := u.continueActiveGame(client); ok {
+			return player, nil
+		}
+		u.mu.Lock()
+	}
+	if v, ok := u.tournamentWaiters[client.Uuid()]; ok {
+		/* the same client has reconnected, its previous connection stops waiting */
+		close(v.resultChan)
+	}
+	ch := make(chan domain.Player, 1)
+	u.tournamentWaiters[client.Uuid()] = enqueuedClient{
+		client:     client,
+		enqueuedAt: time.Now(),
+		resultChan: ch,
+	}
+	u.mu.Unlock()
+	u.sendMessage(client, domain.Message{Type: domain.TournamentWaiting, Payload: payload})
+	player, ok := <-ch
+	if ok {
+		return player, nil
+	}
+	u.mu.RLock()
+	tournament, ok = u.tournaments[tournamentId]
+	if ok {
+		payload = u.tournamentPayload(tournament, client.Uuid())
+	}
+	u.mu.RUnlock()
+	switch {
+	case !ok:
+		u.sendMessage(client, domain.Message{Type: domain.TournamentNotFound, Payload: payload})
+		return domain.Player{}, errors.WithMessagef(domain.ErrTournamentNotFound, "tournament '%s'", tournamentId)
+	case payload.Place > 0:
+		u.sendMessage(client, domain.Message{Type: domain.TournamentOver, Payload: payload})
+		return domain.Player{}, errors.WithMessagef(domain.ErrTournamentFinished, "tournament '%s'", tournamentId)
+	default:
+		return domain.Player{}, errors.New("the client has reconnected to the tournament")
+	}
+}
+
+/* hasPendingGame is called under the lock */
+func (u *useCase) hasPendingGame(tournament *domain.Tournament, player string) bool {
+	if tournament.Status != domain.TournamentInProgress {
+		return false
+	}
+	for _, p := range tournament.Rounds[tournament.Round].Pairings {
+		if p.Finished || (p.PlayerX != player && p.PlayerO != player) {
+			continue
+		}
+		state, ok := u.gamesStates[p.GameUuid]
+		return ok && u.game.Snapshot(state).Status != domain.Finished
+	}
+	return false
+}
+
+/*
+ * a finished tournament is kept for tournamentTTL, so are the ones that have never been started.
+ * The master removes them, the reserves do it with its change
+ */
+func (u *useCase) removeFinishedTournaments() {
+	if u.tournamentTTL <= 0 || !u.isMaster() {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id, tournament := range u.tournaments {
+		if tournament.Status == domain.TournamentInProgress || time.Since(tournament.UpdatedAt) < u.tournamentTTL {
+			continue
+		}
+		delete(u.tournaments, id)
+		u.changes.Append(domain.Change{Kind: domain.TournamentRemoved, TournamentId: id})
+		for player, v := range u.tournamentWaiters {
+			if v.client.Preferences().Tournament == id {
+				delete(u.tournamentWaiters, player)
+				close(v.resultChan)
+			}
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/kiryu-dev/tic-tac-toe/internal/config"
 	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -13,124 +14,516 @@ import (
 
 const (
 	clientQueueBufSize = 2
-	syncPeriod         = 5 * time.Second
+	cleanupPeriod      = 5 * time.Second
+	matchmakingPeriod  = time.Second
+	roomPingPeriod     = 5 * time.Second
 )
 
 type enqueuedClient struct {
 	client     domain.Client
+	rules      domain.GameRules
+	rating     float64
+	enqueuedAt time.Time
 	resultChan chan domain.Player
 }
 
 type useCase struct {
-	game        domain.GameUseCase
-	clientQueue chan enqueuedClient
-	gamesStates map[string]*domain.GameState
-	statesChan  chan map[string]*domain.GameState
-	ticker      *time.Ticker
-	mu          *sync.RWMutex
-	logger      *zap.Logger
+	game              domain.GameUseCase
+	rules             domain.RulesRegistry
+	bots              domain.BotProvider
+	storage           domain.GameStorage
+	accounts          domain.AccountUseCase
+	ratings           domain.RatingUseCase
+	stats             domain.StatsUseCase
+	spectators        domain.SpectatorUseCase
+	changes           domain.ReplicationLog
+	router            domain.ShardRouter
+	ratingWindow      float64
+	windowGrowth      float64
+	botWait           time.Duration
+	botDifficulty     domain.BotDifficulty
+	timeControl       *domain.TimeControl
+	recordTTL         time.Duration
+	roomTTL           time.Duration
+	rematchTimeout    time.Duration
+	startTimeout      time.Duration
+	tournamentTTL     time.Duration
+	clientQueue       chan enqueuedClient
+	gamesStates       map[string]*domain.GameState
+	rooms             map[string]*domain.Room
+	roomWaiters       map[string]enqueuedClient
+	series            map[string]*domain.Series
+	rematchWaiters    map[string]enqueuedClient
+	tournaments       map[string]*domain.Tournament
+	tournamentWaiters map[string]enqueuedClient
+	mu                *sync.RWMutex
+	logger            *zap.Logger
 }
 
-func New(game domain.GameUseCase, logger *zap.Logger) *useCase {
+func New(game domain.GameUseCase, rules domain.RulesRegistry, bots domain.BotProvider, storage domain.GameStorage,
+	accounts domain.AccountUseCase, ratings domain.RatingUseCase, stats domain.StatsUseCase,
+	spectators domain.SpectatorUseCase, changes domain.ReplicationLog, router domain.ShardRouter,
+	gameCfg config.GameConfig, matchmakingCfg config.MatchmakingConfig, botCfg config.BotConfig,
+	tournamentCfg config.TournamentConfig, logger *zap.Logger) *useCase {
+	botDifficulty, err := domain.ParseBotDifficulty(botCfg.Difficulty)
+	if err != nil {
+		logger.Warn("fallback to medium bot difficulty", zap.Error(err))
+		botDifficulty = domain.MediumBot
+	}
 	u := &useCase{
-		game:        game,
-		clientQueue: make(chan enqueuedClient, clientQueueBufSize),
-		gamesStates: make(map[string]*domain.GameState),
-		statesChan:  make(chan map[string]*domain.GameState),
-		ticker:      time.NewTicker(syncPeriod),
-		mu:          &sync.RWMutex{},
-		logger:      logger,
+		game:              game,
+		rules:             rules,
+		bots:              bots,
+		storage:           storage,
+		accounts:          accounts,
+		ratings:           ratings,
+		stats:             stats,
+		spectators:        spectators,
+		changes:           changes,
+		router:            router,
+		ratingWindow:      matchmakingCfg.RatingWindow,
+		windowGrowth:      matchmakingCfg.WindowGrowth,
+		botWait:           botCfg.WaitTimeout,
+		botDifficulty:     botDifficulty,
+		timeControl:       toTimeControl(gameCfg.TimeControl),
+		recordTTL:         gameCfg.RecordTTL,
+		roomTTL:           gameCfg.RoomTTL,
+		rematchTimeout:    gameCfg.RematchTimeout,
+		startTimeout:      tournamentCfg.StartTimeout,
+		tournamentTTL:     tournamentCfg.FinishedTTL,
+		clientQueue:       make(chan enqueuedClient, clientQueueBufSize),
+		gamesStates:       make(map[string]*domain.GameState),
+		rooms:             make(map[string]*domain.Room),
+		roomWaiters:       make(map[string]enqueuedClient),
+		series:            make(map[string]*domain.Series),
+		rematchWaiters:    make(map[string]enqueuedClient),
+		tournaments:       make(map[string]*domain.Tournament),
+		tournamentWaiters: make(map[string]enqueuedClient),
+		mu:                &sync.RWMutex{},
+		logger:            logger,
 	}
 	go u.createGames()
-	go u.syncStates()
+	go u.cleanup()
 	return u
 }
 
 func (u *useCase) Handle(ctx context.Context, client domain.Client) error {
 	player, ok := u.continueActiveGame(client)
 	if !ok {
-		player = u.enqueueForGame(client)
+		var err error
+		if player, err = u.findGame(client); err != nil {
+			return errors.WithMessage(err, "find game")
+		}
 	}
 	u.mu.RLock()
-	gameState := u.gamesStates[player.GameUuid()]
+	gameState, ok := u.gamesStates[player.GameUuid()]
+	if !ok {
+		/* a tournament game may be cancelled right before the player has come */
+		u.mu.RUnlock()
+		return errors.WithMessagef(domain.ErrGameNotFound, "game '%s'", player.GameUuid())
+	}
+	owner, elsewhere := u.servedElsewhere(gameState)
 	u.mu.RUnlock()
-	if err := u.game.Play(ctx, player, gameState); err != nil {
+	if elsewhere {
+		u.redirect(client, owner)
+		return nil
+	}
+	err := u.game.Play(ctx, player, gameState)
+	switch {
+	case errors.Is(err, domain.ErrServerSwitched):
+		u.suspend(player.GameUuid())
+	case err != nil:
 		return errors.WithMessage(err, "play game")
+	default:
+		u.sendSeriesScore(client, player.GameUuid())
+		u.advanceTournaments()
 	}
 	return nil
 }
 
-func (u *useCase) enqueueForGame(client domain.Client) domain.Player {
+func (u *useCase) findGame(client domain.Client) (domain.Player, error) {
+	prefs := client.Preferences()
+	if prefs.Rematch != "" {
+		player, err := u.enterRematch(client)
+		if err != nil {
+			return domain.Player{}, errors.WithMessage(err, "enter rematch")
+		}
+		return player, nil
+	}
+	if prefs.Tournament != "" {
+		player, err := u.enterTournament(client)
+		if err != nil {
+			return domain.Player{}, errors.WithMessage(err, "enter tournament")
+		}
+		return player, nil
+	}
+	if prefs.CreateRoom || prefs.RoomCode != "" {
+		player, err := u.enterRoom(client)
+		if err != nil {
+			return domain.Player{}, errors.WithMessage(err, "enter room")
+		}
+		return player, nil
+	}
+	rules, err := u.rules.Choose(prefs.Variant)
+	if err != nil {
+		return domain.Player{}, errors.WithMessage(err, "choose game rules")
+	}
+	return u.enqueueForGame(client, rules), nil
+}
+
+func (u *useCase) enqueueForGame(client domain.Client, rules domain.GameRules) domain.Player {
 	ch := make(chan domain.Player)
 	defer close(ch)
 	u.clientQueue <- enqueuedClient{
 		client:     client,
+		rules:      rules,
+		rating:     u.ratings.Rating(client.Uuid()).Rating,
+		enqueuedAt: time.Now(),
 		resultChan: ch,
 	}
 	return <-ch
 }
 
-func (u *useCase) createGames() {
-	for {
-		for len(u.clientQueue) > 1 {
-			lhs := <-u.clientQueue
-			rhs := <-u.clientQueue
-			gameUuid := u.createGame(lhs.client.Uuid(), rhs.client.Uuid())
-			moveChan := make(chan domain.Move)
-			lhs.resultChan <- domain.NewPlayer(gameUuid, lhs.client, domain.X, moveChan)
-			rhs.resultChan <- domain.NewPlayer(gameUuid, rhs.client, domain.O, moveChan)
-		}
+func (u *useCase) startBotGame(human enqueuedClient, difficulty domain.BotDifficulty) {
+	botUuid := domain.BotUuidPrefix + uuid.NewString()
+	bot := u.bots.NewBot(botUuid, human.rules.Variant(), difficulty)
+	gameUuid, moveChan := u.createGame(human.client.Uuid(), botUuid, human.rules, difficulty, false, nil)
+	human.resultChan <- domain.NewPlayer(gameUuid, human.client, domain.X, moveChan)
+	if moveChan == nil {
+		return /* the game is served by another server, the bot is started there with the human's reconnection */
+	}
+	go u.playBot(domain.NewPlayer(gameUuid, bot, domain.O, moveChan))
+}
+
+func (u *useCase) playBot(player domain.Player) {
+	u.mu.RLock()
+	gameState := u.gamesStates[player.GameUuid()]
+	u.mu.RUnlock()
+	err := u.game.Play(context.Background(), player, gameState)
+	switch {
+	case errors.Is(err, domain.ErrServerSwitched):
+		u.suspend(player.GameUuid())
+	case err != nil:
+		u.logger.Warn("bot game", zap.String("game uuid", player.GameUuid()), zap.Error(err))
+	}
+}
+
+/*
+ * suspend detaches the game from the sessions that have stopped since the server has sent the players away,
+ * so the game is recovered as after failover if the players come back
+ */
+func (u *useCase) suspend(gameUuid string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if state, ok := u.gamesStates[gameUuid]; ok {
+		u.gamesStates[gameUuid] = u.game.Snapshot(state)
 	}
 }
 
-func (u *useCase) createGame(playerX string, playerO string) string {
+/*
+ * createGame returns nil move channels if the game is placed on another server.
+ * The game is added to the series if it's not nil, a new series is registered with its first game
+ */
+func (u *useCase) createGame(playerX string, playerO string, rules domain.GameRules,
+	botDifficulty domain.BotDifficulty, rated bool, series *domain.Series) (string, *domain.MoveChannels) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
+	gameUuid, state := u.newGame(playerX, playerO, rules, botDifficulty, rated)
+	if series != nil {
+		u.addSeriesGame(series, gameUuid, state)
+	}
+	return gameUuid, u.addGame(gameUuid, state)
+}
+
+/* newGame is called under the lock, the game is placed but not added yet */
+func (u *useCase) newGame(playerX string, playerO string, rules domain.GameRules,
+	botDifficulty domain.BotDifficulty, rated bool) (string, *domain.GameState) {
 	gameUuid := uuid.NewString()
-	var board domain.Board
-	for i := range board {
-		board[i] = domain.None
-	}
-	u.gamesStates[gameUuid] = &domain.GameState{
-		Board:       board,
-		PlayerX:     playerX,
-		PlayerO:     playerO,
-		CurrentMove: domain.X,
-		Status:      domain.ReadyToStart,
-	}
-	return gameUuid
-}
-
-func (u *useCase) syncStates() {
-	defer u.ticker.Stop()
-	for range u.ticker.C {
-		currentGameCount := u.removeFinishedGames()
-		if currentGameCount > 0 {
-			u.statesChan <- u.gamesStates
-		}
+	state := &domain.GameState{
+		Variant:       rules.Variant(),
+		Rules:         rules,
+		PlayerX:       playerX,
+		PlayerO:       playerO,
+		BotDifficulty: botDifficulty,
+		Rated:         rated,
+		Owner:         u.placeGame(gameUuid),
+		CurrentMove:   domain.X,
+		Status:        domain.ReadyToStart,
+		TimeControl:   u.timeControl,
+		Clock:         domain.NewClock(u.timeControl),
+		CreatedAt:     time.Now(),
+	}
+	rules.Init(state)
+	return gameUuid, state
+}
+
+/* addGame is called under the lock, it returns nil move channels if the game is served by another server */
+func (u *useCase) addGame(gameUuid string, state *domain.GameState) *domain.MoveChannels {
+	u.gamesStates[gameUuid] = state
+	if _, elsewhere := u.servedElsewhere(state); elsewhere {
+		u.publishGame(gameUuid, state)
+		return nil
+	}
+	state.MoveChan = domain.NewMoveChannels()
+	return state.MoveChan
+}
+
+func toTimeControl(cfg config.TimeControlConfig) *domain.TimeControl {
+	if cfg.Total <= 0 && cfg.PerMove <= 0 {
+		return nil
+	}
+	return &domain.TimeControl{
+		Total:     cfg.Total,
+		Increment: cfg.Increment,
+		PerMove:   cfg.PerMove,
+	}
+}
+
+func (u *useCase) cleanup() {
+	ticker := time.NewTicker(cleanupPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		u.removeFinishedGames()
+		u.removeExpiredRooms()
+		u.removeExpiredRematches()
+		u.removeFinishedSeries()
+		u.advanceTournaments()
+		u.removeFinishedTournaments()
+		u.reassignGames()
 	}
 }
 
-func (u *useCase) GamesStates() <-chan map[string]*domain.GameState {
-	return u.statesChan
+func (u *useCase) State() domain.HubState {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	state := domain.HubState{
+		Games:       make(map[string]*domain.GameState, len(u.gamesStates)),
+		Rooms:       make(map[string]*domain.Room, len(u.rooms)),
+		Accounts:    u.accounts.State(),
+		Ratings:     u.ratings.State(),
+		Stats:       u.stats.State(),
+		Series:      make(map[string]*domain.Series, len(u.series)),
+		Tournaments: make(map[string]*domain.Tournament, len(u.tournaments)),
+	}
+	for gameUuid, v := range u.gamesStates {
+		state.Games[gameUuid] = u.game.Snapshot(v)
+	}
+	for code, v := range u.rooms {
+		room := *v
+		state.Rooms[code] = &room
+	}
+	for id, series := range u.series {
+		state.Series[id] = series.Clone()
+	}
+	for id, tournament := range u.tournaments {
+		state.Tournaments[id] = tournament.Clone()
+	}
+	return state
 }
 
-func (u *useCase) removeFinishedGames() int {
+/*
+ * finished games are kept (and replicated) for recordTTL so that their records can be reviewed,
+ * they are added to the players' stats right before the removal
+ */
+func (u *useCase) removeFinishedGames() {
+	u.mu.Lock()
+	gameUuids, states := u.finishedGames(func(state *domain.GameState) bool {
+		return time.Since(state.FinishedAt) >= u.recordTTL
+	})
+	u.stats.Record(states)
+	for _, gameUuid := range gameUuids {
+		delete(u.gamesStates, gameUuid)
+	}
+	u.mu.Unlock()
+	/* the store is written after unlocking, so it doesn't hold matchmaking, rooms and tournaments */
+	u.stats.Persist(context.Background())
+	for _, gameUuid := range gameUuids {
+		u.deleteStored(gameUuid)
+		u.spectators.Drop(gameUuid)
+		u.changes.Append(domain.Change{Kind: domain.GameRemoved, GameUuid: gameUuid})
+	}
+}
+
+func (u *useCase) deleteStored(gameUuid string) {
+	if err := u.storage.Delete(context.Background(), gameUuid); err != nil {
+		u.logger.Error("delete stored game state", zap.String("game uuid", gameUuid), zap.Error(err))
+	}
+}
+
+/* Restore loads the games saved before the restart, it's called before the server takes part in master election */
+func (u *useCase) Restore(ctx context.Context) error {
+	states, err := u.storage.Load(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "load game states")
+	}
+	u.bindRules(states)
 	u.mu.Lock()
 	defer u.mu.Unlock()
-	for gameUuid, state := range u.gamesStates {
-		if state.Status == domain.Finished {
-			delete(u.gamesStates, gameUuid)
+	for gameUuid, state := range states {
+		u.gamesStates[gameUuid] = state
+	}
+	u.logger.Info("restored game states", zap.Int("count", len(states)))
+	return nil
+}
+
+func (u *useCase) bindRules(states map[string]*domain.GameState) {
+	for gameUuid, state := range states {
+		rules, err := u.rules.Rules(state.Variant)
+		if err != nil {
+			u.logger.Warn("skip game state", zap.String("game uuid", gameUuid), zap.Error(err))
+			delete(states, gameUuid)
+			continue
 		}
+		state.Rules = rules
+	}
+}
+
+func (u *useCase) GameRecord(_ context.Context, gameUuid string) (domain.GameRecord, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	state, ok := u.gamesStates[gameUuid]
+	if !ok {
+		return domain.GameRecord{}, errors.WithMessagef(domain.ErrGameNotFound, "game '%s'", gameUuid)
 	}
-	return len(u.gamesStates)
+	return domain.NewGameRecord(gameUuid, u.game.Snapshot(state)), nil
+}
+
+func (u *useCase) Spectate(ctx context.Context, gameUuid string, client domain.Client) error {
+	u.mu.RLock()
+	state, ok := u.gamesStates[gameUuid]
+	if !ok {
+		u.mu.RUnlock()
+		return errors.WithMessagef(domain.ErrGameNotFound, "game '%s'", gameUuid)
+	}
+	if owner, elsewhere := u.servedElsewhere(state); elsewhere {
+		u.mu.RUnlock()
+		u.redirect(client, owner)
+		return nil
+	}
+	snapshot := u.game.Snapshot(state)
+	u.mu.RUnlock()
+	if err := u.spectators.Watch(ctx, gameUuid, client, snapshot); err != nil {
+		return errors.WithMessage(err, "watch game")
+	}
+	return nil
 }
 
-func (u *useCase) ApplyStates(_ context.Context, states map[string]*domain.GameState) {
+func (u *useCase) ApplyStates(ctx context.Context, state domain.HubState) {
+	states := state.Games
+	if states == nil {
+		states = make(map[string]*domain.GameState)
+	}
+	u.bindRules(states)
+	u.accounts.ApplyStates(ctx, state.Accounts)
+	u.ratings.ApplyStates(ctx, state.Ratings)
 	u.mu.Lock()
+	u.stats.ApplyStates(state.Stats)
+	/* a reserve keeps replicated states on disk too, any node may become the master after a full restart */
+	var removed []string
+	for gameUuid := range u.gamesStates {
+		if _, ok := states[gameUuid]; !ok {
+			removed = append(removed, gameUuid)
+		}
+	}
+	replicated := make(map[string]*domain.GameState, len(states))
+	for gameUuid, state := range states {
+		if u.keepsOwnGame(gameUuid, state) {
+			states[gameUuid] = u.gamesStates[gameUuid]
+			continue
+		}
+		replicated[gameUuid] = state.Clone()
+	}
 	u.gamesStates = states
-	u.logger.Info("applied states", zap.Any("states", u.gamesStates))
+	u.rooms = state.Rooms
+	if u.rooms == nil {
+		u.rooms = make(map[string]*domain.Room)
+	}
+	u.series = state.Series
+	if u.series == nil {
+		u.series = make(map[string]*domain.Series)
+	}
+	u.tournaments = state.Tournaments
+	if u.tournaments == nil {
+		u.tournaments = make(map[string]*domain.Tournament)
+	}
+	u.logger.Info("applied states", zap.Any("states", u.gamesStates), zap.Any("rooms", u.rooms))
 	u.mu.Unlock()
+	/* the store is written after unlocking, so it doesn't hold matchmaking, rooms and tournaments */
+	u.stats.Persist(ctx)
+	for _, gameUuid := range removed {
+		u.deleteStored(gameUuid)
+	}
+	for gameUuid, state := range replicated {
+		if err := u.storage.Save(ctx, gameUuid, state); err != nil {
+			u.logger.Error("save replicated game state", zap.String("game uuid", gameUuid), zap.Error(err))
+		}
+	}
+}
+
+/*
+ * ApplyChanges applies the changes shipped from the master's log on a reserve. The games, rooms, series
+ * and tournaments are changed under the lock, the store is written in the same order after unlocking
+ */
+func (u *useCase) ApplyChanges(ctx context.Context, changes []domain.Change) {
+	u.mu.Lock()
+	persist := make([]func(), 0, len(changes))
+	for _, v := range changes {
+		switch v.Kind {
+		case domain.GameChanged:
+			persist = append(persist, func() {
+				if err := u.ratings.Commit(ctx, v.GameUuid, v.State); err != nil {
+					u.logger.Warn("apply ratings", zap.String("game uuid", v.GameUuid), zap.Error(err))
+				}
+			})
+			rules, err := u.rules.Rules(v.State.Variant)
+			if err != nil {
+				u.logger.Warn("skip game state", zap.String("game uuid", v.GameUuid), zap.Error(err))
+				continue
+			}
+			v.State.Rules = rules
+			if u.keepsOwnGame(v.GameUuid, v.State) {
+				continue
+			}
+			u.gamesStates[v.GameUuid] = v.State
+			snapshot := v.State.Clone()
+			persist = append(persist, func() {
+				if err := u.storage.Save(ctx, v.GameUuid, snapshot); err != nil {
+					u.logger.Error("save replicated game state", zap.String("game uuid", v.GameUuid), zap.Error(err))
+				}
+			})
+			u.recordSeriesGame(v.GameUuid, v.State)
+		case domain.GameRemoved:
+			if state, ok := u.gamesStates[v.GameUuid]; ok {
+				u.stats.Record([]*domain.GameState{state})
+			}
+			delete(u.gamesStates, v.GameUuid)
+			persist = append(persist, func() {
+				u.deleteStored(v.GameUuid)
+			})
+		case domain.RoomChanged:
+			u.rooms[v.RoomCode] = v.Room
+		case domain.RoomRemoved:
+			delete(u.rooms, v.RoomCode)
+		case domain.AccountChanged:
+			persist = append(persist, func() {
+				u.accounts.ApplyAccount(ctx, v.Account)
+			})
+		case domain.SeriesChanged:
+			u.series[v.SeriesId] = v.Series
+		case domain.SeriesRemoved:
+			delete(u.series, v.SeriesId)
+		case domain.TournamentChanged:
+			u.tournaments[v.TournamentId] = v.Tournament
+		case domain.TournamentRemoved:
+			delete(u.tournaments, v.TournamentId)
+		}
+	}
+	u.mu.Unlock()
+	u.stats.Persist(ctx)
+	for _, f := range persist {
+		f()
+	}
+	u.logger.Info("applied changes", zap.Int("count", len(changes)))
 }
 
 func (u *useCase) continueActiveGame(client domain.Client) (domain.Player, bool) {
@@ -154,11 +547,16 @@ func (u *useCase) continueActiveGame(client domain.Client) (domain.Player, bool)
 		//if cellType == domain.None {
 		//	continue
 		//}
+		if _, elsewhere := u.servedElsewhere(state); elsewhere {
+			return domain.NewPlayer(gameUuid, client, cellType, nil), true
+		}
 		if state.MoveChan == nil {
-			state.MoveChan = make(chan domain.Move)
+			state.MoveChan = domain.NewMoveChannels()
+			u.recoverBot(gameUuid, state, cellType)
 		}
 
-		if state.RecoveredPlayer == "" && cellType == state.CurrentMove {
+		/* a game placed on this server by the master hasn't started yet, it starts as usual */
+		if state.RecoveredPlayer == "" && cellType == state.CurrentMove && state.Status != domain.ReadyToStart {
 			state.RecoveredPlayer = clientUuid
 		}
 
@@ -167,3 +565,19 @@ func (u *useCase) continueActiveGame(client domain.Client) (domain.Player, bool)
 	}
 	return domain.Player{}, false
 }
+
+/* a bot doesn't reconnect by itself after failover, so it's restarted together with its opponent */
+func (u *useCase) recoverBot(gameUuid string, state *domain.GameState, humanCell domain.Cell) {
+	if state.BotDifficulty == "" {
+		return
+	}
+	botUuid, botCell := state.PlayerO, domain.O
+	if humanCell == domain.O {
+		botUuid, botCell = state.PlayerX, domain.X
+	}
+	if state.RecoveredPlayer == "" && botCell == state.CurrentMove && state.Status != domain.ReadyToStart {
+		state.RecoveredPlayer = botUuid
+	}
+	bot := u.bots.NewBot(botUuid, state.Variant, state.BotDifficulty)
+	go u.playBot(domain.NewPlayer(gameUuid, bot, botCell, state.MoveChan))
+}
@@ -0,0 +1,38 @@
+package journal
+
+import (
+	"context"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+/*
+ * useCase is the single place every change of a game state goes through: it's saved to durable storage
+ * and then handed to the listeners (e.g. spectators)
+ */
+type useCase struct {
+	storage   domain.GameStorage
+	listeners []domain.StateCommitter
+}
+
+func New(storage domain.GameStorage, listeners ...domain.StateCommitter) useCase {
+	return useCase{
+		storage:   storage,
+		listeners: listeners,
+	}
+}
+
+func (u useCase) Commit(ctx context.Context, gameUuid string, state *domain.GameState) error {
+	if err := u.storage.Save(ctx, gameUuid, state); err != nil {
+		return errors.WithMessage(err, "save game state")
+	}
+	/* every listener gets the change even if one of them fails, e.g. the replication times out */
+	var commitErr error
+	for _, listener := range u.listeners {
+		if err := listener.Commit(ctx, gameUuid, state); err != nil && commitErr == nil {
+			commitErr = errors.WithMessage(err, "notify listener")
+		}
+	}
+	return commitErr
+}
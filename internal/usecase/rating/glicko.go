@@ -0,0 +1,91 @@
+package rating
+
+import (
+	"math"
+)
+
+/*
+ * Glicko-2 (http://www.glicko.net/glicko/glicko2.pdf) with a single game as the rating period.
+ * The ratings are converted to the Glicko-2 scale (mu, phi) and back
+ */
+const (
+	initialRating     = 1500
+	initialDeviation  = 350
+	initialVolatility = 0.06
+	minDeviation      = 30
+	tau               = 0.5 /* how much the volatility may change */
+	glickoScale       = 173.7178
+	convergence       = 0.000001
+)
+
+type glicko struct {
+	mu    float64
+	phi   float64
+	sigma float64
+}
+
+func toGlicko(rating float64, deviation float64, volatility float64) glicko {
+	return glicko{
+		mu:    (rating - initialRating) / glickoScale,
+		phi:   deviation / glickoScale,
+		sigma: volatility,
+	}
+}
+
+func (g glicko) rating() float64 {
+	return g.mu*glickoScale + initialRating
+}
+
+func (g glicko) deviation() float64 {
+	return max(g.phi*glickoScale, minDeviation)
+}
+
+/* update returns the player's rating after the game against the opponent, score is 1, 0.5 or 0 */
+func (g glicko) update(opponent glicko, score float64) glicko {
+	gPhi := 1 / math.Sqrt(1+3*opponent.phi*opponent.phi/(math.Pi*math.Pi))
+	expected := 1 / (1 + math.Exp(-gPhi*(g.mu-opponent.mu)))
+	v := 1 / (gPhi * gPhi * expected * (1 - expected))
+	delta := v * gPhi * (score - expected)
+
+	sigma := g.volatility(delta, v)
+	phiStar := math.Sqrt(g.phi*g.phi + sigma*sigma)
+	phi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	return glicko{
+		mu:    g.mu + phi*phi*gPhi*(score-expected),
+		phi:   phi,
+		sigma: sigma,
+	}
+}
+
+/* volatility finds the new volatility by the Illinois algorithm (step 5 of the paper) */
+func (g glicko) volatility(delta float64, v float64) float64 {
+	a := math.Log(g.sigma * g.sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := g.phi*g.phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(tau*tau)
+	}
+	lo := a
+	var hi float64
+	if delta*delta > g.phi*g.phi+v {
+		hi = math.Log(delta*delta - g.phi*g.phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		hi = a - k*tau
+	}
+	fLo, fHi := f(lo), f(hi)
+	for math.Abs(hi-lo) > convergence {
+		c := lo + (lo-hi)*fLo/(fHi-fLo)
+		fC := f(c)
+		if fC*fHi <= 0 {
+			lo, fLo = hi, fHi
+		} else {
+			fLo /= 2
+		}
+		hi, fHi = c, fC
+	}
+	return math.Exp(lo / 2)
+}
@@ -0,0 +1,82 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+/* TestGlickoScale checks the conversion of the opponents of the paper's example (step 2) */
+func TestGlickoScale(t *testing.T) {
+	tests := []struct {
+		rating    float64
+		deviation float64
+		mu        float64
+		phi       float64
+	}{
+		{rating: 1500, deviation: 200, mu: 0, phi: 1.1513},
+		{rating: 1400, deviation: 30, mu: -0.5756, phi: 0.1727},
+		{rating: 1550, deviation: 100, mu: 0.2878, phi: 0.5756},
+		{rating: 1700, deviation: 300, mu: 1.1513, phi: 1.7269},
+	}
+	for _, tt := range tests {
+		g := toGlicko(tt.rating, tt.deviation, initialVolatility)
+		if math.Abs(g.mu-tt.mu) > 0.0001 || math.Abs(g.phi-tt.phi) > 0.0001 {
+			t.Fatalf("%.0f/%.0f: got mu %.4f, phi %.4f, want %.4f, %.4f", tt.rating, tt.deviation, g.mu, g.phi, tt.mu, tt.phi)
+		}
+		if math.Abs(g.rating()-tt.rating) > 0.000001 || math.Abs(g.deviation()-tt.deviation) > 0.000001 {
+			t.Fatalf("%.0f/%.0f: got back %f/%f", tt.rating, tt.deviation, g.rating(), g.deviation())
+		}
+	}
+}
+
+/* TestGlickoVolatility checks step 5 against the paper's example: v = 1.7785, delta = -0.4834 give sigma' = 0.05999 */
+func TestGlickoVolatility(t *testing.T) {
+	sigma := toGlicko(1500, 200, 0.06).volatility(-0.4834, 1.7785)
+	if math.Abs(sigma-0.05999) > 0.00001 {
+		t.Fatalf("got volatility %.6f, want 0.05999", sigma)
+	}
+}
+
+/*
+ * TestGlickoUpdate plays the player of the paper's example (1500/200/0.06) against each of its opponents
+ * as a rating period of a single game
+ */
+func TestGlickoUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		opponent  glicko
+		score     float64
+		rating    float64
+		deviation float64
+	}{
+		{name: "win against 1400/30", opponent: toGlicko(1400, 30, 0.06), score: 1, rating: 1563.56, deviation: 175.40},
+		{name: "draw with 1400/30", opponent: toGlicko(1400, 30, 0.06), score: 0.5, rating: 1475.41, deviation: 175.40},
+		{name: "loss to 1400/30", opponent: toGlicko(1400, 30, 0.06), score: 0, rating: 1387.26, deviation: 175.40},
+		{name: "loss to 1550/100", opponent: toGlicko(1550, 100, 0.06), score: 0, rating: 1426.69, deviation: 175.90},
+		{name: "win against 1700/300", opponent: toGlicko(1700, 300, 0.06), score: 1, rating: 1601.62, deviation: 186.98},
+		{name: "draw with 1700/300", opponent: toGlicko(1700, 300, 0.06), score: 0.5, rating: 1528.74, deviation: 186.98},
+	}
+	player := toGlicko(1500, 200, 0.06)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := player.update(tt.opponent, tt.score)
+			if math.Abs(got.rating()-tt.rating) > 0.01 || math.Abs(got.deviation()-tt.deviation) > 0.01 {
+				t.Fatalf("got %.2f/%.2f, want %.2f/%.2f", got.rating(), got.deviation(), tt.rating, tt.deviation)
+			}
+			if math.Abs(got.sigma-0.06) > 0.00001 {
+				t.Fatalf("got volatility %.6f, want about 0.06", got.sigma)
+			}
+		})
+	}
+}
+
+/* TestGlickoMinDeviation checks that the deviation of a steady player never drops below the floor */
+func TestGlickoMinDeviation(t *testing.T) {
+	player, opponent := toGlicko(1500, 50, 0.001), toGlicko(1500, 50, 0.001)
+	for range 100 {
+		player = player.update(opponent, 0.5)
+	}
+	if player.deviation() != minDeviation {
+		t.Fatalf("got deviation %.2f, want %d", player.deviation(), minDeviation)
+	}
+}
@@ -0,0 +1,210 @@
+package rating
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type useCase struct {
+	storage  domain.RatingStorage
+	accounts domain.AccountUseCase
+	ratings  map[string]*domain.Rating
+	mu       *sync.RWMutex
+	logger   *zap.Logger
+}
+
+func New(storage domain.RatingStorage, accounts domain.AccountUseCase, logger *zap.Logger) *useCase {
+	return &useCase{
+		storage:  storage,
+		accounts: accounts,
+		ratings:  make(map[string]*domain.Rating),
+		mu:       &sync.RWMutex{},
+		logger:   logger,
+	}
+}
+
+/* Rate is called with a snapshot of the finished game, it fills the ratings of the players after a rated game */
+func (u *useCase) Rate(state *domain.GameState) {
+	if !state.Rated || state.Outcome == nil {
+		return
+	}
+	scoreX := 0.5
+	switch state.Outcome.Winner {
+	case domain.X:
+		scoreX = 1
+	case domain.O:
+		scoreX = 0
+	}
+	u.mu.RLock()
+	x, o := u.rating(state.PlayerX), u.rating(state.PlayerO)
+	u.mu.RUnlock()
+	glickoX, glickoO := toGlicko(x.Rating, x.Deviation, x.Volatility), toGlicko(o.Rating, o.Deviation, o.Volatility)
+	state.Ratings = []domain.Rating{
+		rated(x, glickoX.update(glickoO, scoreX), state),
+		rated(o, glickoO.update(glickoX, 1-scoreX), state),
+	}
+}
+
+func rated(prev domain.Rating, g glicko, state *domain.GameState) domain.Rating {
+	return domain.Rating{
+		AccountId:  prev.AccountId,
+		Rating:     g.rating(),
+		Deviation:  g.deviation(),
+		Volatility: g.sigma,
+		Games:      prev.Games + 1,
+		UpdatedAt:  state.FinishedAt,
+	}
+}
+
+/* Commit applies the ratings after a finished game, it listens to the journal and to the replicated changes */
+func (u *useCase) Commit(ctx context.Context, _ string, state *domain.GameState) error {
+	if state.Status != domain.Finished || len(state.Ratings) == 0 {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, rating := range state.Ratings {
+		u.apply(ctx, rating)
+	}
+	return nil
+}
+
+/* apply is called under the lock */
+func (u *useCase) apply(ctx context.Context, rating domain.Rating) {
+	if prev, ok := u.ratings[rating.AccountId]; ok && !rating.UpdatedAt.After(prev.UpdatedAt) {
+		return
+	}
+	u.ratings[rating.AccountId] = &rating
+	if err := u.storage.Save(ctx, &rating); err != nil {
+		u.logger.Error("save rating", zap.String("account id", rating.AccountId), zap.Error(err))
+	}
+}
+
+/* Rating returns the rating of the account, a player without rated games has the initial one */
+func (u *useCase) Rating(accountId string) domain.Rating {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.rating(accountId)
+}
+
+/* rating is called under the lock */
+func (u *useCase) rating(accountId string) domain.Rating {
+	if rating, ok := u.ratings[accountId]; ok {
+		return *rating
+	}
+	return domain.Rating{
+		AccountId:  accountId,
+		Rating:     initialRating,
+		Deviation:  initialDeviation,
+		Volatility: initialVolatility,
+	}
+}
+
+/* Entry returns the rating of a registered account with its place on the leaderboard, 0 if it's unrated */
+func (u *useCase) Entry(accountId string) (domain.RatingEntry, bool) {
+	name, ok := u.accounts.Name(accountId)
+	if !ok {
+		return domain.RatingEntry{}, false
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	entry := domain.RatingEntry{Name: name, Rating: u.rating(accountId)}
+	if _, ok := u.ratings[accountId]; ok {
+		entry.Rank = 1
+		for _, v := range u.ratings {
+			if _, ok := u.accounts.Name(v.AccountId); ok && compareRatings(v, &entry.Rating) < 0 {
+				entry.Rank++
+			}
+		}
+	}
+	return entry, true
+}
+
+/*
+ * Leaderboard returns a page of the rated players and the number of them,
+ * the ones with a lower deviation go first on equal ratings
+ */
+func (u *useCase) Leaderboard(offset int, limit int) ([]domain.RatingEntry, int) {
+	u.mu.RLock()
+	ratings := make([]*domain.Rating, 0, len(u.ratings))
+	for _, v := range u.ratings {
+		rating := *v
+		ratings = append(ratings, &rating)
+	}
+	u.mu.RUnlock()
+	slices.SortFunc(ratings, compareRatings)
+	entries := make([]domain.RatingEntry, 0, min(limit, len(ratings)))
+	total := 0
+	for _, rating := range ratings {
+		name, ok := u.accounts.Name(rating.AccountId)
+		if !ok {
+			continue
+		}
+		total++
+		if total > offset && len(entries) < limit {
+			entries = append(entries, domain.RatingEntry{Rank: total, Name: name, Rating: *rating})
+		}
+	}
+	return entries, total
+}
+
+func compareRatings(lhs *domain.Rating, rhs *domain.Rating) int {
+	return cmp.Or(
+		cmp.Compare(rhs.Rating, lhs.Rating),
+		cmp.Compare(lhs.Deviation, rhs.Deviation),
+		cmp.Compare(lhs.AccountId, rhs.AccountId),
+	)
+}
+
+/* Restore loads the ratings saved before the restart */
+func (u *useCase) Restore(ctx context.Context) error {
+	ratings, err := u.storage.Load(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "load ratings")
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.ratings = ratings
+	u.logger.Info("restored ratings", zap.Int("count", len(ratings)))
+	return nil
+}
+
+func (u *useCase) State() map[string]*domain.Rating {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	ratings := make(map[string]*domain.Rating, len(u.ratings))
+	for id, v := range u.ratings {
+		rating := *v
+		ratings[id] = &rating
+	}
+	return ratings
+}
+
+/* ApplyStates replaces the ratings with the master's ones */
+func (u *useCase) ApplyStates(ctx context.Context, ratings map[string]*domain.Rating) {
+	if ratings == nil {
+		ratings = make(map[string]*domain.Rating)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id := range u.ratings {
+		if _, ok := ratings[id]; ok {
+			continue
+		}
+		if err := u.storage.Delete(ctx, id); err != nil {
+			u.logger.Error("delete stored rating", zap.String("account id", id), zap.Error(err))
+		}
+	}
+	for _, rating := range ratings {
+		if err := u.storage.Save(ctx, rating); err != nil {
+			u.logger.Error("save replicated rating", zap.String("account id", rating.AccountId), zap.Error(err))
+		}
+	}
+	u.ratings = ratings
+}
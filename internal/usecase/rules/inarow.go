@@ -0,0 +1,120 @@
+package rules
+
+import (
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+const (
+	ClassicVariant = "classic"
+	classicSize    = 3
+)
+
+var directions = [4][2]int{
+	{0, 1},
+	{1, 0},
+	{1, 1},
+	{1, -1},
+}
+
+type inARow struct {
+	variant   string
+	rows      int
+	cols      int
+	winLength int
+}
+
+func NewInARow(variant string, rows int, cols int, winLength int) (inARow, error) {
+	if rows <= 0 || cols <= 0 {
+		return inARow{}, errors.Errorf("invalid board dimensions %dx%d", rows, cols)
+	}
+	if winLength <= 0 || (winLength > rows && winLength > cols) {
+		return inARow{}, errors.Errorf("invalid win length %d for board %dx%d", winLength, rows, cols)
+	}
+	return inARow{
+		variant:   variant,
+		rows:      rows,
+		cols:      cols,
+		winLength: winLength,
+	}, nil
+}
+
+func NewClassic() inARow {
+	return inARow{
+		variant:   ClassicVariant,
+		rows:      classicSize,
+		cols:      classicSize,
+		winLength: classicSize,
+	}
+}
+
+func (r inARow) Variant() string {
+	return r.variant
+}
+
+func (r inARow) Init(state *domain.GameState) {
+	state.Board = domain.NewBoard(r.rows, r.cols)
+}
+
+func (r inARow) ValidateMove(state *domain.GameState, pos int) error {
+	return validateCell(state.Board, pos)
+}
+
+func (r inARow) LegalMoves(state *domain.GameState) []int {
+	moves := make([]int, 0, state.Board.Size())
+	for i, v := range state.Board.Cells {
+		if v == domain.None {
+			moves = append(moves, i)
+		}
+	}
+	return moves
+}
+
+func validateCell(board domain.Board, pos int) error {
+	if pos < 0 || pos >= board.Size() {
+		return domain.ErrInvalidPosition
+	}
+	if board.Cells[pos] != domain.None {
+		return errors.WithMessagef(domain.ErrInvalidPosition,
+			"cell in position '%d' is already selected", pos)
+	}
+	return nil
+}
+
+func (r inARow) ApplyMove(state *domain.GameState, pos int, cellType domain.Cell) {
+	state.Board.Cells[pos] = cellType
+}
+
+func (r inARow) IsWin(state *domain.GameState, cellType domain.Cell) bool {
+	return r.isWin(state.Board, cellType)
+}
+
+func (r inARow) isWin(board domain.Board, cellType domain.Cell) bool {
+	for row := 0; row < board.Rows; row++ {
+		for col := 0; col < board.Cols; col++ {
+			if board.At(row, col) != cellType {
+				continue
+			}
+			for _, d := range directions {
+				if r.hasLine(board, cellType, row, col, d) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (r inARow) hasLine(board domain.Board, cellType domain.Cell, row int, col int, d [2]int) bool {
+	for i := 1; i < r.winLength; i++ {
+		nextRow, nextCol := row+d[0]*i, col+d[1]*i
+		if !board.Contains(nextRow, nextCol) || board.At(nextRow, nextCol) != cellType {
+			return false
+		}
+	}
+	return true
+}
+
+func (r inARow) IsDraw(state *domain.GameState) bool {
+	return state.Round >= state.Board.Size()
+}
@@ -0,0 +1,162 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+/* board builds the board of the rows, '.' is an empty cell */
+func board(rows ...string) domain.Board {
+	b := domain.NewBoard(len(rows), len(rows[0]))
+	for row, line := range rows {
+		for col, v := range line {
+			if v != '.' {
+				b.Cells[row*b.Cols+col] = domain.Cell(v)
+			}
+		}
+	}
+	return b
+}
+
+func TestInARowIsWin(t *testing.T) {
+	tests := []struct {
+		name      string
+		winLength int
+		rows      []string
+		cellType  domain.Cell
+		want      bool
+	}{
+		{
+			name:      "row",
+			winLength: 4,
+			rows:      []string{".....", ".XXXX", ".....", ".....", "....."},
+			cellType:  domain.X,
+			want:      true,
+		},
+		{
+			name:      "column",
+			winLength: 4,
+			rows:      []string{"....O", "....O", "....O", "....O", "....."},
+			cellType:  domain.O,
+			want:      true,
+		},
+		{
+			name:      "diagonal",
+			winLength: 4,
+			rows:      []string{".....", ".X...", "..X..", "...X.", "....X"},
+			cellType:  domain.X,
+			want:      true,
+		},
+		{
+			name:      "anti-diagonal",
+			winLength: 4,
+			rows:      []string{"...X.", "..X..", ".X...", "X....", "....."},
+			cellType:  domain.X,
+			want:      true,
+		},
+		{
+			name:      "line longer than the win length",
+			winLength: 3,
+			rows:      []string{".....", ".....", "XXXXX", ".....", "....."},
+			cellType:  domain.X,
+			want:      true,
+		},
+		{
+			name:      "line shorter than the win length",
+			winLength: 4,
+			rows:      []string{"XXX.X", ".....", ".....", ".....", "....."},
+			cellType:  domain.X,
+			want:      false,
+		},
+		{
+			name:      "line doesn't wrap around the edge of the row",
+			winLength: 4,
+			rows:      []string{"...XX", "XX...", ".....", ".....", "....."},
+			cellType:  domain.X,
+			want:      false,
+		},
+		{
+			name:      "diagonal doesn't wrap around the edge of the board",
+			winLength: 3,
+			rows:      []string{"....X", "X....", ".X...", ".....", "....."},
+			cellType:  domain.X,
+			want:      false,
+		},
+		{
+			name:      "line of the other player",
+			winLength: 4,
+			rows:      []string{"OOOO.", ".....", ".....", ".....", "....."},
+			cellType:  domain.X,
+			want:      false,
+		},
+		{
+			name:      "rectangular board",
+			winLength: 3,
+			rows:      []string{"......", "..O...", "...O..", "....O."},
+			cellType:  domain.O,
+			want:      true,
+		},
+		{
+			name:      "classic without a line",
+			winLength: 3,
+			rows:      []string{"XOX", "XOO", "OXX"},
+			cellType:  domain.X,
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := board(tt.rows...)
+			r, err := NewInARow("test", b.Rows, b.Cols, tt.winLength)
+			if err != nil {
+				t.Fatalf("new rules: %v", err)
+			}
+			if got := r.IsWin(&domain.GameState{Board: b}, tt.cellType); got != tt.want {
+				t.Fatalf("is win of '%c': got %t, want %t", tt.cellType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInARowValidateMove(t *testing.T) {
+	state := &domain.GameState{Board: board("X..", "...", "...")}
+	tests := []struct {
+		name     string
+		position int
+		wantErr  error
+	}{
+		{name: "empty cell", position: 4},
+		{name: "taken cell", position: 0, wantErr: domain.ErrInvalidPosition},
+		{name: "before the board", position: -1, wantErr: domain.ErrInvalidPosition},
+		{name: "after the board", position: 9, wantErr: domain.ErrInvalidPosition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewClassic().ValidateMove(state, tt.position); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("validate move %d: got %v, want %v", tt.position, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInARowIsDraw(t *testing.T) {
+	r, err := NewInARow("test", 3, 4, 3)
+	if err != nil {
+		t.Fatalf("new rules: %v", err)
+	}
+	state := &domain.GameState{}
+	r.Init(state)
+	if state.Board.Size() != 12 {
+		t.Fatalf("got board of %d cells, want 12", state.Board.Size())
+	}
+	for state.Round = 0; state.Round < state.Board.Size(); state.Round++ {
+		if r.IsDraw(state) {
+			t.Fatalf("a draw after %d moves of %d", state.Round, state.Board.Size())
+		}
+	}
+	if !r.IsDraw(state) {
+		t.Fatalf("no draw when the board is full")
+	}
+}
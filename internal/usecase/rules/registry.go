@@ -0,0 +1,57 @@
+package rules
+
+import (
+	"github.com/kiryu-dev/tic-tac-toe/internal/config"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+type registry struct {
+	rules          map[string]domain.GameRules
+	defaultVariant string
+}
+
+func NewRegistry(defaultVariant string, rules ...domain.GameRules) (registry, error) {
+	r := registry{
+		rules:          make(map[string]domain.GameRules, len(rules)),
+		defaultVariant: defaultVariant,
+	}
+	for _, v := range rules {
+		r.rules[v.Variant()] = v
+	}
+	if _, ok := r.rules[defaultVariant]; !ok {
+		return registry{}, errors.WithMessagef(domain.ErrUnknownVariant, "default variant '%s'", defaultVariant)
+	}
+	return r, nil
+}
+
+func (r registry) Rules(variant string) (domain.GameRules, error) {
+	v, ok := r.rules[variant]
+	if !ok {
+		return nil, errors.WithMessagef(domain.ErrUnknownVariant, "variant '%s'", variant)
+	}
+	return v, nil
+}
+
+func (r registry) Choose(variant string) (domain.GameRules, error) {
+	if variant == "" {
+		return r.rules[r.defaultVariant], nil
+	}
+	return r.Rules(variant)
+}
+
+func FromConfig(cfg config.GameConfig) (registry, error) {
+	variants := []domain.GameRules{NewClassic(), NewUltimate()}
+	for _, v := range cfg.Variants {
+		rules, err := NewInARow(v.Name, v.Rows, v.Cols, v.WinLength)
+		if err != nil {
+			return registry{}, errors.WithMessagef(err, "variant '%s'", v.Name)
+		}
+		variants = append(variants, rules)
+	}
+	defaultVariant := cfg.DefaultVariant
+	if defaultVariant == "" {
+		defaultVariant = ClassicVariant
+	}
+	return NewRegistry(defaultVariant, variants...)
+}
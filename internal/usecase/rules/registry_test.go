@@ -0,0 +1,85 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/config"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+/* TestFromConfig checks that the built-in and the configured variants are registered and the default one is chosen */
+func TestFromConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.GameConfig
+		variant     string
+		wantVariant string
+		wantErr     error
+	}{
+		{
+			name:        "classic by default",
+			wantVariant: ClassicVariant,
+		},
+		{
+			name:        "configured default",
+			cfg:         config.GameConfig{DefaultVariant: UltimateVariant},
+			wantVariant: UltimateVariant,
+		},
+		{
+			name: "configured variant",
+			cfg: config.GameConfig{
+				Variants: []config.VariantConfig{{Name: "gomoku", Rows: 15, Cols: 15, WinLength: 5}},
+			},
+			variant:     "gomoku",
+			wantVariant: "gomoku",
+		},
+		{
+			name:    "unknown variant",
+			variant: "gomoku",
+			wantErr: domain.ErrUnknownVariant,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, err := FromConfig(tt.cfg)
+			if err != nil {
+				t.Fatalf("from config: %v", err)
+			}
+			rules, err := registry.Choose(tt.variant)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("choose '%s': got error %v, want %v", tt.variant, err, tt.wantErr)
+			}
+			if err == nil && rules.Variant() != tt.wantVariant {
+				t.Fatalf("choose '%s': got variant '%s', want '%s'", tt.variant, rules.Variant(), tt.wantVariant)
+			}
+		})
+	}
+}
+
+func TestFromConfigRejectsInvalidVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.GameConfig
+	}{
+		{
+			name: "unknown default",
+			cfg:  config.GameConfig{DefaultVariant: "gomoku"},
+		},
+		{
+			name: "empty board",
+			cfg:  config.GameConfig{Variants: []config.VariantConfig{{Name: "empty", Rows: 0, Cols: 3, WinLength: 3}}},
+		},
+		{
+			name: "win length longer than the board",
+			cfg:  config.GameConfig{Variants: []config.VariantConfig{{Name: "long", Rows: 3, Cols: 4, WinLength: 5}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FromConfig(tt.cfg); err == nil {
+				t.Fatalf("the config is accepted")
+			}
+		})
+	}
+}
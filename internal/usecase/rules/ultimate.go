@@ -0,0 +1,87 @@
+package rules
+
+import (
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+const UltimateVariant = "ultimate"
+
+/*
+ * state.Board holds the meta board: the result of every sub-board (X, O, Tie or None while it's open),
+ * state.Ultimate holds the sub-boards themselves and the sub-board the next move is constrained to.
+ */
+type ultimate struct {
+	subRules inARow
+}
+
+func NewUltimate() ultimate {
+	return ultimate{subRules: NewClassic()}
+}
+
+func (r ultimate) Variant() string {
+	return UltimateVariant
+}
+
+func (r ultimate) Init(state *domain.GameState) {
+	state.Board = domain.NewBoard(domain.SubBoardSide, domain.SubBoardSide)
+	state.Ultimate = domain.NewUltimateBoard()
+}
+
+func (r ultimate) ValidateMove(state *domain.GameState, pos int) error {
+	if state.Ultimate == nil {
+		return errors.New("ultimate board is not initialized")
+	}
+	if pos < 0 || pos >= domain.SubBoardCount*domain.SubBoardCount {
+		return domain.ErrInvalidPosition
+	}
+	subBoard, cell := domain.LocateUltimate(pos)
+	if state.Board.Cells[subBoard] != domain.None {
+		return errors.WithMessagef(domain.ErrIllegalMove, "sub-board '%d' is already finished", subBoard)
+	}
+	next := state.Ultimate.NextBoard
+	if next != domain.AnySubBoard && next != subBoard {
+		return errors.WithMessagef(domain.ErrIllegalMove, "move must be made in sub-board '%d'", next)
+	}
+	return validateCell(state.Ultimate.SubBoards[subBoard], cell)
+}
+
+func (r ultimate) LegalMoves(state *domain.GameState) []int {
+	moves := make([]int, 0, domain.SubBoardCount)
+	for subBoard, result := range state.Board.Cells {
+		next := state.Ultimate.NextBoard
+		if result != domain.None || (next != domain.AnySubBoard && next != subBoard) {
+			continue
+		}
+		for cell, v := range state.Ultimate.SubBoards[subBoard].Cells {
+			if v == domain.None {
+				moves = append(moves, domain.NestedPosition(subBoard, cell))
+			}
+		}
+	}
+	return moves
+}
+
+func (r ultimate) ApplyMove(state *domain.GameState, pos int, cellType domain.Cell) {
+	subBoard, cell := domain.LocateUltimate(pos)
+	board := state.Ultimate.SubBoards[subBoard]
+	board.Cells[cell] = cellType
+	switch {
+	case r.subRules.isWin(board, cellType):
+		state.Board.Cells[subBoard] = cellType
+	case board.IsFull():
+		state.Board.Cells[subBoard] = domain.Tie
+	}
+	state.Ultimate.NextBoard = cell
+	if state.Board.Cells[cell] != domain.None {
+		state.Ultimate.NextBoard = domain.AnySubBoard
+	}
+}
+
+func (r ultimate) IsWin(state *domain.GameState, cellType domain.Cell) bool {
+	return r.subRules.isWin(state.Board, cellType)
+}
+
+func (r ultimate) IsDraw(state *domain.GameState) bool {
+	return state.Board.IsFull()
+}
@@ -0,0 +1,110 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+)
+
+func newUltimateState() *domain.GameState {
+	state := &domain.GameState{}
+	NewUltimate().Init(state)
+	return state
+}
+
+/* TestUltimateSendsToSubBoard checks that the cell of a move picks the sub-board of the next one */
+func TestUltimateSendsToSubBoard(t *testing.T) {
+	r := NewUltimate()
+	state := newUltimateState()
+	r.ApplyMove(state, domain.NestedPosition(4, 2), domain.X)
+	if state.Ultimate.NextBoard != 2 {
+		t.Fatalf("got next sub-board %d, want 2", state.Ultimate.NextBoard)
+	}
+	tests := []struct {
+		name     string
+		position int
+		wantErr  error
+	}{
+		{name: "the sub-board sent to", position: domain.NestedPosition(2, 0)},
+		{name: "another sub-board", position: domain.NestedPosition(5, 0), wantErr: domain.ErrIllegalMove},
+		{name: "out of the board", position: domain.NestedPosition(domain.SubBoardCount, 0),
+			wantErr: domain.ErrInvalidPosition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.ValidateMove(state, tt.position); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("validate move %d: got %v, want %v", tt.position, err, tt.wantErr)
+			}
+		})
+	}
+	for _, position := range r.LegalMoves(state) {
+		if subBoard, _ := domain.LocateUltimate(position); subBoard != 2 {
+			t.Fatalf("legal move %d is in sub-board %d, want 2", position, subBoard)
+		}
+	}
+}
+
+/* TestUltimateFinishedSubBoard checks that a won sub-board is closed and sending to it frees the next move */
+func TestUltimateFinishedSubBoard(t *testing.T) {
+	r := NewUltimate()
+	state := newUltimateState()
+	state.Ultimate.SubBoards[0] = board("XX.", "OO.", "...")
+	r.ApplyMove(state, domain.NestedPosition(0, 2), domain.X)
+	if state.Board.Cells[0] != domain.X {
+		t.Fatalf("got sub-board 0 result '%c', want 'X'", state.Board.Cells[0])
+	}
+	if err := r.ValidateMove(state, domain.NestedPosition(2, 0)); err != nil {
+		t.Fatalf("the move in the sub-board sent to is rejected: %v", err)
+	}
+
+	r.ApplyMove(state, domain.NestedPosition(2, 0), domain.O)
+	if state.Ultimate.NextBoard != domain.AnySubBoard {
+		t.Fatalf("got next sub-board %d after sending to a finished one, want any", state.Ultimate.NextBoard)
+	}
+	if err := r.ValidateMove(state, domain.NestedPosition(0, 8)); !errors.Is(err, domain.ErrIllegalMove) {
+		t.Fatalf("the move in the finished sub-board: got %v, want %v", err, domain.ErrIllegalMove)
+	}
+	if err := r.ValidateMove(state, domain.NestedPosition(7, 4)); err != nil {
+		t.Fatalf("the move in an open sub-board is rejected: %v", err)
+	}
+}
+
+func TestUltimateTiedSubBoard(t *testing.T) {
+	state := newUltimateState()
+	state.Ultimate.SubBoards[3] = board("XOX", "XOO", "OX.")
+	NewUltimate().ApplyMove(state, domain.NestedPosition(3, 8), domain.O)
+	if state.Board.Cells[3] != domain.Tie {
+		t.Fatalf("got sub-board 3 result '%c', want a tie", state.Board.Cells[3])
+	}
+}
+
+/* TestUltimateResult checks the meta board: three won sub-boards in a line win, the tied ones count for nobody */
+func TestUltimateResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		meta   []string
+		winner domain.Cell
+		isDraw bool
+	}{
+		{name: "row of sub-boards", meta: []string{"XXX", "OO.", "..."}, winner: domain.X},
+		{name: "diagonal of sub-boards", meta: []string{"O.X", "XO.", "..O"}, winner: domain.O},
+		{name: "in progress", meta: []string{"XX.", "OO.", "..."}, winner: domain.None},
+		{name: "ties don't make a line", meta: []string{"X--", "OXO", "XO-"}, winner: domain.None, isDraw: true},
+	}
+	r := NewUltimate()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newUltimateState()
+			state.Board = board(tt.meta...)
+			for _, cellType := range []domain.Cell{domain.X, domain.O} {
+				if got := r.IsWin(state, cellType); got != (cellType == tt.winner) {
+					t.Fatalf("is win of '%c': got %t", cellType, got)
+				}
+			}
+			if got := r.IsDraw(state); got != tt.isDraw {
+				t.Fatalf("is draw: got %t, want %t", got, tt.isDraw)
+			}
+		})
+	}
+}
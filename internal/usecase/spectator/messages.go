@@ -0,0 +1,83 @@
+package spectator
+
+import (
+	"fmt"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+)
+
+func startGameMessage(gameUuid string, state *domain.GameState) domain.Message {
+	return domain.Message{
+		Type: domain.StartGame,
+		Payload: domain.StartGamePayload{
+			GameUuid:    gameUuid,
+			CellType:    domain.None,
+			Variant:     state.Variant,
+			Board:       state.Board,
+			Ultimate:    state.Ultimate,
+			Round:       state.Round,
+			TimeControl: state.TimeControl,
+			Clock:       state.Clock,
+		},
+	}
+}
+
+func gameOverMessage(state *domain.GameState) domain.Message {
+	return domain.Message{
+		Type:    domain.GameOver,
+		Payload: domain.GameOverPayload{GameResult: gameResult(state.Outcome)},
+	}
+}
+
+/*
+ * diff turns two consecutive snapshots into messages: new moves are sent one by one,
+ * fewer moves than before mean an accepted takeback
+ */
+func diff(prev *domain.GameState, next *domain.GameState) []domain.Message {
+	if len(next.Moves) < len(prev.Moves) {
+		return []domain.Message{{
+			Type: domain.AcceptTakeback,
+			Payload: domain.TakebackPayload{
+				Board:    next.Board,
+				Ultimate: next.Ultimate,
+				Round:    next.Round,
+				Clock:    next.Clock,
+			},
+		}}
+	}
+	var messages []domain.Message
+	for _, v := range next.Moves[len(prev.Moves):] {
+		messages = append(messages, domain.Message{
+			Type: domain.PlayerMove,
+			Payload: domain.PlayerMovePayload{
+				CellType: v.CellType,
+				Position: v.Position,
+				Clock:    next.Clock,
+			},
+		})
+	}
+	if next.Status == domain.Finished && prev.Status != domain.Finished {
+		messages = append(messages, gameOverMessage(next))
+	}
+	return messages
+}
+
+func gameResult(outcome *domain.Outcome) string {
+	if outcome == nil {
+		return "Игра окончена"
+	}
+	switch outcome.Reason {
+	case domain.ReasonDraw:
+		return "Ничья"
+	case domain.ReasonAgreement:
+		return "Ничья по соглашению"
+	case domain.ReasonWalkover:
+		return fmt.Sprintf("Техническая победа %c (оппонент отключился)", outcome.Winner)
+	case domain.ReasonTimeout:
+		return fmt.Sprintf("Победа %c по времени", outcome.Winner)
+	case domain.ReasonResign:
+		return fmt.Sprintf("Победа %c (оппонент сдался)", outcome.Winner)
+	default:
+		return fmt.Sprintf("Победа %c", outcome.Winner)
+	}
+}
@@ -0,0 +1,162 @@
+package spectator
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const watcherBufSize = 64
+
+type watcher struct {
+	client   domain.Client
+	messages chan domain.Message
+}
+
+/* audience of a game; last is the latest committed snapshot, the next one is compared with it */
+type audience struct {
+	watchers map[*watcher]struct{}
+	last     *domain.GameState
+}
+
+/*
+ * useCase fans out game changes to spectators. It gets every committed snapshot of a game state
+ * (see journal) and turns the difference with the previous one into the same messages the players get,
+ * so the players' move channels aren't touched at all
+ */
+type useCase struct {
+	audiences map[string]*audience
+	mu        *sync.Mutex
+	logger    *zap.Logger
+}
+
+func New(logger *zap.Logger) *useCase {
+	return &useCase{
+		audiences: make(map[string]*audience),
+		mu:        &sync.Mutex{},
+		logger:    logger,
+	}
+}
+
+func (u *useCase) Watch(ctx context.Context, gameUuid string, client domain.Client, state *domain.GameState) error {
+	w := &watcher{
+		client:   client,
+		messages: make(chan domain.Message, watcherBufSize),
+	}
+	u.mu.Lock()
+	a := u.audience(gameUuid)
+	if a.last == nil {
+		a.last = state
+	}
+	a.watchers[w] = struct{}{}
+	u.send(a, w, startGameMessage(gameUuid, a.last))
+	if a.last.Status == domain.Finished {
+		u.send(a, w, gameOverMessage(a.last))
+		u.remove(a, w)
+	}
+	u.mu.Unlock()
+	u.logger.Info("new spectator", zap.String("game uuid", gameUuid))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		/* spectators are read-only, anything they send is ignored until the connection is closed */
+		for {
+			if _, err := client.ReadMessage(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case msg, ok := <-w.messages:
+			if !ok {
+				return nil
+			}
+			if err := client.WriteMessage(msg); err != nil {
+				u.leave(gameUuid, w)
+				return errors.WithMessage(err, "send message to spectator")
+			}
+		case <-ctx.Done():
+			u.leave(gameUuid, w)
+			return nil
+		}
+	}
+}
+
+func (u *useCase) Commit(_ context.Context, gameUuid string, state *domain.GameState) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	a := u.audience(gameUuid)
+	prev := a.last
+	a.last = state
+	if prev == nil || len(a.watchers) == 0 {
+		return nil
+	}
+	messages := diff(prev, state)
+	for w := range a.watchers {
+		for _, msg := range messages {
+			u.send(a, w, msg)
+		}
+		if state.Status == domain.Finished {
+			u.remove(a, w)
+		}
+	}
+	return nil
+}
+
+/* Drop disconnects the spectators of a removed game */
+func (u *useCase) Drop(gameUuid string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	a, ok := u.audiences[gameUuid]
+	if !ok {
+		return
+	}
+	for w := range a.watchers {
+		u.remove(a, w)
+	}
+	delete(u.audiences, gameUuid)
+}
+
+func (u *useCase) leave(gameUuid string, w *watcher) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if a, ok := u.audiences[gameUuid]; ok {
+		u.remove(a, w)
+	}
+}
+
+func (u *useCase) audience(gameUuid string) *audience {
+	a, ok := u.audiences[gameUuid]
+	if !ok {
+		a = &audience{watchers: make(map[*watcher]struct{})}
+		u.audiences[gameUuid] = a
+	}
+	return a
+}
+
+/* send never blocks the game: a spectator that doesn't keep up is disconnected */
+func (u *useCase) send(a *audience, w *watcher, msg domain.Message) {
+	if _, ok := a.watchers[w]; !ok {
+		return
+	}
+	select {
+	case w.messages <- msg:
+	default:
+		u.logger.Warn("spectator is too slow, dropping it", zap.String("client uuid", w.client.Uuid()))
+		u.remove(a, w)
+	}
+}
+
+func (u *useCase) remove(a *audience, w *watcher) {
+	if _, ok := a.watchers[w]; !ok {
+		return
+	}
+	delete(a.watchers, w)
+	close(w.messages)
+}
@@ -0,0 +1,256 @@
+package stats
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+/*
+ * The stats are changed in memory under the lock of the hub, so they always match its games,
+ * and the changes (dirty and removed) are stored by Persist after the hub is unlocked.
+ * persistMu keeps the stored stats in the order they have been changed
+ */
+type useCase struct {
+	storage   domain.StatsStorage
+	accounts  domain.AccountUseCase
+	stats     map[string]*domain.PlayerStats
+	dirty     map[string]struct{}
+	removed   map[string]struct{}
+	mu        *sync.RWMutex
+	persistMu *sync.Mutex
+	logger    *zap.Logger
+}
+
+func New(storage domain.StatsStorage, accounts domain.AccountUseCase, logger *zap.Logger) *useCase {
+	return &useCase{
+		storage:   storage,
+		accounts:  accounts,
+		stats:     make(map[string]*domain.PlayerStats),
+		dirty:     make(map[string]struct{}),
+		removed:   make(map[string]struct{}),
+		mu:        &sync.RWMutex{},
+		persistMu: &sync.Mutex{},
+		logger:    logger,
+	}
+}
+
+/* Record adds the finished games the hub is removing to the stats of their players */
+func (u *useCase) Record(states []*domain.GameState) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, state := range states {
+		for _, player := range players(state) {
+			stats, ok := u.stats[player]
+			if !ok {
+				stats = &domain.PlayerStats{AccountId: player}
+				u.stats[player] = stats
+			}
+			add(stats, state)
+			u.dirty[player] = struct{}{}
+		}
+	}
+}
+
+/* Persist stores the stats changed since the previous call */
+func (u *useCase) Persist(ctx context.Context) {
+	u.persistMu.Lock()
+	defer u.persistMu.Unlock()
+	u.mu.Lock()
+	changed := make([]domain.PlayerStats, 0, len(u.dirty))
+	for id := range u.dirty {
+		if stats, ok := u.stats[id]; ok {
+			changed = append(changed, *stats)
+		}
+	}
+	removed := make([]string, 0, len(u.removed))
+	for id := range u.removed {
+		removed = append(removed, id)
+	}
+	u.dirty, u.removed = make(map[string]struct{}), make(map[string]struct{})
+	u.mu.Unlock()
+	for _, id := range removed {
+		if err := u.storage.Delete(ctx, id); err != nil {
+			u.logger.Error("delete stored player stats", zap.String("account id", id), zap.Error(err))
+		}
+	}
+	for _, stats := range changed {
+		if err := u.storage.Save(ctx, &stats); err != nil {
+			u.logger.Error("save player stats", zap.String("account id", stats.AccountId), zap.Error(err))
+		}
+	}
+}
+
+/* players returns the accounts that have played the finished game, bots have no stats */
+func players(state *domain.GameState) []string {
+	if state.Status != domain.Finished || state.Outcome == nil {
+		return nil
+	}
+	var accounts []string
+	for _, player := range []string{state.PlayerX, state.PlayerO} {
+		if !domain.IsBot(player) {
+			accounts = append(accounts, player)
+		}
+	}
+	return accounts
+}
+
+func add(stats *domain.PlayerStats, state *domain.GameState) {
+	cell := domain.X
+	if state.PlayerO == stats.AccountId {
+		cell = domain.O
+	}
+	outcome := state.Outcome
+	stats.Games++
+	stats.Moves += len(state.Moves)
+	stats.Duration += state.FinishedAt.Sub(state.CreatedAt)
+	stats.LastGameAt = state.FinishedAt
+	switch outcome.Winner {
+	case domain.None:
+		stats.Draws++
+		stats.CurrentStreak = 0
+	case cell:
+		if cell == domain.X {
+			stats.WinsAsX++
+		} else {
+			stats.WinsAsO++
+		}
+		if outcome.Reason == domain.ReasonWalkover {
+			stats.WalkoverWins++
+		}
+		stats.CurrentStreak = max(stats.CurrentStreak, 0) + 1
+		stats.LongestWinStreak = max(stats.LongestWinStreak, stats.CurrentStreak)
+	default:
+		stats.Losses++
+		if outcome.Reason == domain.ReasonWalkover {
+			stats.WalkoverLosses++
+		}
+		stats.CurrentStreak = min(stats.CurrentStreak, 0) - 1
+	}
+}
+
+func (u *useCase) Stats(accountId string, recent []*domain.GameState) (domain.StatsEntry, bool) {
+	name, ok := u.accounts.Name(accountId)
+	if !ok {
+		return domain.StatsEntry{}, false
+	}
+	u.mu.RLock()
+	stats := domain.PlayerStats{AccountId: accountId}
+	if v, ok := u.stats[accountId]; ok {
+		stats = *v
+	}
+	u.mu.RUnlock()
+	for _, state := range recent {
+		if slices.Contains(players(state), accountId) {
+			add(&stats, state)
+		}
+	}
+	return newEntry(name, stats), true
+}
+
+/* Leaderboard returns the page of the players sorted by the stat and the number of the players with stats */
+func (u *useCase) Leaderboard(stat domain.Stat, offset int, limit int,
+	recent []*domain.GameState) ([]domain.StatsEntry, int) {
+	u.mu.RLock()
+	all := make(map[string]*domain.PlayerStats, len(u.stats))
+	for id, v := range u.stats {
+		stats := *v
+		all[id] = &stats
+	}
+	u.mu.RUnlock()
+	for _, state := range recent {
+		for _, player := range players(state) {
+			stats, ok := all[player]
+			if !ok {
+				stats = &domain.PlayerStats{AccountId: player}
+				all[player] = stats
+			}
+			add(stats, state)
+		}
+	}
+	entries := make([]domain.StatsEntry, 0, len(all))
+	for id, stats := range all {
+		if name, ok := u.accounts.Name(id); ok {
+			entries = append(entries, newEntry(name, *stats))
+		}
+	}
+	slices.SortFunc(entries, func(lhs domain.StatsEntry, rhs domain.StatsEntry) int {
+		return cmp.Or(cmp.Compare(statValue(rhs, stat), statValue(lhs, stat)), cmp.Compare(lhs.Name, rhs.Name))
+	})
+	offset = min(offset, len(entries))
+	page := entries[offset : offset+min(limit, len(entries)-offset)]
+	for i := range page {
+		page[i].Rank = offset + i + 1
+	}
+	return page, len(entries)
+}
+
+func statValue(entry domain.StatsEntry, stat domain.Stat) int {
+	switch stat {
+	case domain.StatWins:
+		return entry.WinsAsX + entry.WinsAsO
+	case domain.StatStreak:
+		return entry.LongestWinStreak
+	default:
+		return entry.Games
+	}
+}
+
+func newEntry(name string, stats domain.PlayerStats) domain.StatsEntry {
+	entry := domain.StatsEntry{Name: name, PlayerStats: stats}
+	if stats.Games > 0 {
+		entry.AverageMoves = float64(stats.Moves) / float64(stats.Games)
+		entry.AverageDuration = stats.Duration / time.Duration(stats.Games)
+	}
+	return entry
+}
+
+/* Restore loads the stats saved before the restart */
+func (u *useCase) Restore(ctx context.Context) error {
+	stats, err := u.storage.Load(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "load player stats")
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.stats = stats
+	u.logger.Info("restored player stats", zap.Int("count", len(stats)))
+	return nil
+}
+
+func (u *useCase) State() map[string]*domain.PlayerStats {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	all := make(map[string]*domain.PlayerStats, len(u.stats))
+	for id, v := range u.stats {
+		stats := *v
+		all[id] = &stats
+	}
+	return all
+}
+
+/* ApplyStates replaces the stats with the master's ones, they match the games of the master's state */
+func (u *useCase) ApplyStates(all map[string]*domain.PlayerStats) {
+	if all == nil {
+		all = make(map[string]*domain.PlayerStats)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id := range u.stats {
+		if _, ok := all[id]; !ok {
+			u.removed[id] = struct{}{}
+			delete(u.dirty, id)
+		}
+	}
+	for id := range all {
+		u.dirty[id] = struct{}{}
+		delete(u.removed, id)
+	}
+	u.stats = all
+}
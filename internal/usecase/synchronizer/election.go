@@ -0,0 +1,339 @@
+package synchronizer
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"go.uber.org/zap"
+)
+
+const ticksPerHeartbeat = 5
+
+/*
+ * DefineMasterServer runs the master election in the manner of Raft: every server starts as a reserve
+ * (follower), a reserve that doesn't get heartbeats until its randomized deadline starts an election
+ * for the next term and becomes the master if the majority of the members votes for it.
+ * A server votes once per term, so there is at most one master per term.
+ * The master steps down if it loses contact with the majority, so a partitioned master doesn't keep serving.
+ * Before an election a server asks for pre-votes that don't change anybody's term, so a server coming back
+ * from a partition doesn't depose the master everybody else still hears
+ */
+func (u *useCase) DefineMasterServer(ctx context.Context) {
+	if !u.started.CompareAndSwap(false, true) {
+		return
+	}
+	u.mu.Lock()
+	u.resetDeadline()
+	info := u.info()
+	u.mu.Unlock()
+	u.infos.publish(info)
+
+	ticker := time.NewTicker(u.heartbeatPeriod / ticksPerHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		now := time.Now()
+		u.mu.Lock()
+		switch {
+		case u.role == leader && now.Sub(u.quorumAt) >= u.electionTimeout:
+			u.logger.Warn("lost contact with the majority, stepping down", zap.Uint64("term", u.term))
+			u.stepDown(u.term, "")
+			info := u.info()
+			u.mu.Unlock()
+			u.infos.publish(info)
+		case u.role == leader && now.Sub(u.heartbeatAt) >= u.heartbeatPeriod:
+			u.heartbeatAt = now
+			term := u.term
+			u.mu.Unlock()
+			u.sendHeartbeats(ctx, term)
+		case u.role != leader && u.leaderName != "" && now.Sub(u.heardAt) >= u.electionTimeout:
+			/* the reserve stops serving its games before the master reassigns them, see LiveServers */
+			u.logger.Warn("lost contact with the master", zap.String("master", u.leaderName))
+			u.leaderName = ""
+			info := u.info()
+			u.mu.Unlock()
+			u.infos.publish(info)
+		case u.role != leader && now.After(u.deadline) && u.isMember() && !u.draining:
+			u.mu.Unlock()
+			u.campaign(ctx)
+		default:
+			u.mu.Unlock()
+		}
+	}
+}
+
+func (u *useCase) campaign(ctx context.Context) {
+	if !u.preVote(ctx) {
+		return
+	}
+	u.elect(ctx)
+}
+
+/* elect runs the election without pre-votes, the successor the master hands its role over to starts with it */
+func (u *useCase) elect(ctx context.Context) {
+	u.mu.Lock()
+	u.term++
+	u.role = candidate
+	u.votedFor = u.serverName
+	u.leaderName = ""
+	u.resetDeadline()
+	term := u.term
+	req := domain.VoteRequest{Term: term, Candidate: u.serverName, LogTerm: u.log.term, LastSeq: u.log.lastSeq}
+	u.mu.Unlock()
+	u.logger.Info("starting election", zap.Uint64("term", term))
+
+	responses := broadcast(ctx, u, func(ctx context.Context, addr string) (*domain.VoteResponse, error) {
+		return u.repo.RequestVote(ctx, addr, req)
+	})
+	votes := 1
+	for _, v := range responses {
+		if v.Term > term {
+			u.observeTerm(v.Term)
+			return
+		}
+		if v.Granted {
+			votes++
+		}
+	}
+	u.mu.Lock()
+	if u.role != candidate || u.term != term || !u.isMajority(votes) {
+		u.mu.Unlock()
+		return
+	}
+	u.role = leader
+	u.leaderName = u.serverName
+	u.log.continueIn(term)
+	for _, p := range u.peers {
+		p.nextSeq = 0
+		p.matchSeq = 0
+		p.seenAt = time.Now() /* every reserve is alive until it's proven otherwise */
+	}
+	u.quorumAt = time.Now()
+	u.heartbeatAt = time.Now()
+	info := u.info()
+	u.mu.Unlock()
+	u.logger.Info("became master", zap.Uint64("term", term), zap.Int("votes", votes))
+	u.infos.publish(info)
+	u.sendHeartbeats(ctx, term)
+	u.mu.Lock()
+	for _, p := range u.peers {
+		p.notify()
+	}
+	u.mu.Unlock()
+}
+
+func (u *useCase) preVote(ctx context.Context) bool {
+	u.mu.Lock()
+	u.resetDeadline()
+	term := u.term
+	req := domain.VoteRequest{
+		Term:      term + 1,
+		Candidate: u.serverName,
+		LogTerm:   u.log.term,
+		LastSeq:   u.log.lastSeq,
+		PreVote:   true,
+	}
+	u.mu.Unlock()
+
+	responses := broadcast(ctx, u, func(ctx context.Context, addr string) (*domain.VoteResponse, error) {
+		return u.repo.RequestVote(ctx, addr, req)
+	})
+	votes := 1
+	for _, v := range responses {
+		if v.Term > term {
+			u.observeTerm(v.Term)
+			return false
+		}
+		if v.Granted {
+			votes++
+		}
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.isMajority(votes)
+}
+
+func (u *useCase) sendHeartbeats(ctx context.Context, term uint64) {
+	req := domain.HeartbeatRequest{Term: term, Leader: u.serverName}
+	responses := broadcast(ctx, u, func(ctx context.Context, addr string) (*domain.HeartbeatResponse, error) {
+		resp, err := u.repo.Heartbeat(ctx, addr, req)
+		if err == nil && resp.Success {
+			u.markSeen(addr, resp.Draining)
+		}
+		return resp, err
+	})
+	acks := 1
+	for _, v := range responses {
+		if v.Term > term {
+			u.observeTerm(v.Term)
+			return
+		}
+		if v.Success {
+			acks++
+		}
+	}
+	u.mu.Lock()
+	if u.role == leader && u.term == term && u.isMajority(acks) {
+		u.quorumAt = time.Now()
+	}
+	u.mu.Unlock()
+}
+
+func (u *useCase) HandleVote(_ context.Context, req domain.VoteRequest) domain.VoteResponse {
+	u.mu.Lock()
+	if req.PreVote {
+		granted := req.Term > u.term && u.isPeer(req.Candidate) && !u.log.isBehind(req.LogTerm, req.LastSeq) &&
+			!u.hearsLeader()
+		resp := domain.VoteResponse{Term: u.term, Granted: granted}
+		u.mu.Unlock()
+		return resp
+	}
+	changed := false
+	if req.Term > u.term {
+		changed = u.stepDown(req.Term, "")
+	}
+	granted := req.Term == u.term && (u.votedFor == "" || u.votedFor == req.Candidate) &&
+		u.isPeer(req.Candidate) && !u.log.isBehind(req.LogTerm, req.LastSeq)
+	if granted {
+		u.votedFor = req.Candidate
+		u.resetDeadline()
+	}
+	resp := domain.VoteResponse{Term: u.term, Granted: granted}
+	info := u.info()
+	u.mu.Unlock()
+	if changed {
+		u.infos.publish(info)
+	}
+	return resp
+}
+
+func (u *useCase) HandleHeartbeat(_ context.Context, req domain.HeartbeatRequest) domain.HeartbeatResponse {
+	u.mu.Lock()
+	if req.Term < u.term {
+		resp := domain.HeartbeatResponse{Term: u.term}
+		u.mu.Unlock()
+		u.logger.Warn("rejected heartbeat of a stale master",
+			zap.String("master", req.Leader), zap.Uint64("epoch", req.Term), zap.Uint64("current epoch", resp.Term))
+		return resp
+	}
+	changed := u.stepDown(req.Term, req.Leader)
+	u.heardAt = time.Now()
+	resp := domain.HeartbeatResponse{Term: u.term, Success: true, Draining: u.draining}
+	info := u.info()
+	u.mu.Unlock()
+	if changed {
+		u.logger.Info("new master", zap.String("master", req.Leader), zap.Uint64("term", req.Term))
+		u.infos.publish(info)
+	}
+	return resp
+}
+
+func (u *useCase) observeTerm(term uint64) {
+	u.mu.Lock()
+	changed := false
+	if term > u.term {
+		changed = u.stepDown(term, "")
+	}
+	info := u.info()
+	u.mu.Unlock()
+	if changed {
+		u.infos.publish(info)
+	}
+}
+
+/* stepDown is called under the lock, it returns true if the master known to the server has changed */
+func (u *useCase) stepDown(term uint64, leaderName string) bool {
+	if term > u.term {
+		u.term = term
+		u.votedFor = ""
+	}
+	changed := u.role == leader || u.leaderName != leaderName
+	if changed {
+		u.caughtUp = false /* a reserve catches up with every new master */
+	}
+	if u.role == leader {
+		u.signalAcks() /* the moves awaiting the quorum won't get it from this server anymore */
+	}
+	u.role = follower
+	u.leaderName = leaderName
+	u.resetDeadline()
+	return changed
+}
+
+func (u *useCase) hearsLeader() bool {
+	if u.role == leader {
+		return true
+	}
+	return u.leaderName != "" && time.Since(u.heardAt) < u.electionTimeout
+}
+
+func (u *useCase) resetDeadline() {
+	jitter := rand.N(u.electionTimeout)
+	u.deadline = time.Now().Add(u.electionTimeout + jitter)
+}
+
+/* isMajority is called under the lock, the majority is counted over the current members */
+func (u *useCase) isMajority(count int) bool {
+	return count*2 > len(u.peers)+1
+}
+
+/* a server that has left the cluster doesn't get votes even if it doesn't know it has left */
+func (u *useCase) isPeer(name string) bool {
+	_, ok := u.peers[name]
+	return ok
+}
+
+func (u *useCase) info() domain.ServerInfo {
+	role := domain.ReserveServer
+	if u.role == leader {
+		role = domain.MasterServer
+	}
+	return domain.ServerInfo{
+		ServerRole:       role,
+		MasterServerName: u.leaderName,
+		Term:             u.term,
+		Successor:        u.successor,
+	}
+}
+
+/* broadcast calls every peer at once and returns the responses that came before the heartbeat period ended */
+func broadcast[T any](ctx context.Context, u *useCase, call func(ctx context.Context, addr string) (*T, error)) []*T {
+	u.mu.Lock()
+	addrs := u.peerAddrs()
+	u.mu.Unlock()
+	return broadcastTo(ctx, u, addrs, call)
+}
+
+func broadcastTo[T any](ctx context.Context, u *useCase, addrs []string,
+	call func(ctx context.Context, addr string) (*T, error)) []*T {
+	ctx, cancel := context.WithTimeout(ctx, u.heartbeatPeriod)
+	defer cancel()
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		responses = make([]*T, 0, len(addrs))
+	)
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			resp, err := call(ctx, addr)
+			if err != nil {
+				u.logger.Debug("peer is unavailable", zap.String("addr", addr), zap.Error(err))
+				return
+			}
+			mu.Lock()
+			responses = append(responses, resp)
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+	return responses
+}
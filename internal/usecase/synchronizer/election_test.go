@@ -0,0 +1,425 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/config"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"go.uber.org/zap"
+)
+
+/* TestHandoverKeepsReservesInSync checks that the caught up reserves follow the log of the new master as is */
+func TestHandoverKeepsReservesInSync(t *testing.T) {
+	const (
+		handoverCount   = 3
+		heartbeatPeriod = 50 * time.Millisecond
+		electionTimeout = 250 * time.Millisecond
+	)
+	net := newNetwork(time.Millisecond)
+	names := []string{"node-1", "node-2", "node-3"}
+	electionCfg := config.ElectionConfig{HeartbeatPeriod: heartbeatPeriod, ElectionTimeout: electionTimeout}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	obs := startCluster(ctx, net, names, electionCfg)
+	if _, _, ok := obs.waitAgreement(names, 20*electionTimeout); !ok {
+		t.Fatalf("the cluster hasn't agreed on a single master")
+	}
+	time.Sleep(4 * heartbeatPeriod) /* the reserves apply the log of the first master */
+
+	bootstraps := metrics.bootstraps.Value()
+	for i := 0; i < handoverCount; i++ {
+		master := obs.anyMaster()
+		successor, err := net.node(master).Handover(ctx, "")
+		if err != nil {
+			t.Fatalf("master '%s' hasn't handed over: %v", master, err)
+		}
+		if _, _, ok := obs.waitAgreement(names, 20*electionTimeout); !ok {
+			t.Fatalf("the cluster hasn't agreed on '%s' after the handover", successor)
+		}
+		time.Sleep(4 * heartbeatPeriod)
+	}
+	if v := metrics.bootstraps.Value() - bootstraps; v > 0 {
+		t.Fatalf("the reserves have bootstrapped %d times after the handovers", v)
+	}
+}
+
+/*
+ * TestSingleMasterPerTerm runs several nodes in one process over an in-memory network,
+ * keeps partitioning and healing it and handing the master role over,
+ * checks that there is never more than one master per term
+ * and that the cluster agrees on a single master once the network is healed
+ */
+func TestSingleMasterPerTerm(t *testing.T) {
+	const (
+		nodeCount       = 5
+		chaosPeriod     = 300 * time.Millisecond
+		heartbeatPeriod = 50 * time.Millisecond
+		electionTimeout = 250 * time.Millisecond
+		latency         = 5 * time.Millisecond
+	)
+	duration := 5 * time.Second
+	if testing.Short() {
+		duration = time.Second
+	}
+
+	net := newNetwork(latency)
+	names := make([]string, 0, nodeCount)
+	for i := 1; i <= nodeCount; i++ {
+		names = append(names, fmt.Sprintf("node-%d", i))
+	}
+	electionCfg := config.ElectionConfig{HeartbeatPeriod: heartbeatPeriod, ElectionTimeout: electionTimeout}
+	ctx, cancel := context.WithCancel(context.Background())
+	handovers := &sync.WaitGroup{}
+	defer func() {
+		cancel()
+		handovers.Wait() /* they log to the test */
+	}()
+	obs := startCluster(ctx, net, names, electionCfg)
+
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) {
+		time.Sleep(chaosPeriod)
+		switch rand.IntN(4) {
+		case 0:
+			net.heal()
+			t.Log("network healed")
+		case 1:
+			minority := rand.IntN((len(names)-1)/2) + 1
+			shuffled := append([]string(nil), names...)
+			rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			net.partition(shuffled[:minority], shuffled[minority:])
+			t.Logf("partition %v | %v", shuffled[:minority], shuffled[minority:])
+		case 2:
+			if master := obs.anyMaster(); master != "" {
+				net.partition([]string{master}, without(names, master))
+				t.Logf("master '%s' isolated", master)
+			}
+		case 3:
+			if master := obs.anyMaster(); master != "" {
+				handovers.Add(1)
+				go func() {
+					defer handovers.Done()
+					successor, err := net.node(master).Handover(ctx, "")
+					t.Logf("master '%s' handed over to '%s': %v", master, successor, err)
+				}()
+			}
+		}
+	}
+	net.heal()
+	master, term, ok := obs.waitAgreement(names, 20*electionTimeout)
+	t.Logf("terms with a master: %d", obs.termCount())
+	if violations := obs.violations(); len(violations) > 0 {
+		t.Fatalf("more than one master per term: %v", violations)
+	}
+	if !ok {
+		t.Fatalf("the cluster hasn't agreed on a single master after the network was healed")
+	}
+	t.Logf("final master '%s' in term %d", master, term)
+}
+
+/* startCluster runs the nodes connected by the network, the observer watches what they publish */
+func startCluster(ctx context.Context, net *network, names []string, electionCfg config.ElectionConfig) *observer {
+	obs := newObserver()
+	for _, name := range names {
+		peers := make(map[string]string)
+		for _, peer := range names {
+			if peer != name {
+				peers[peer] = peer
+			}
+		}
+		node := NewNode(transport{from: name, net: net}, name, name, peers, electionCfg,
+			config.ReplicationConfig{}, config.MembershipConfig{}, zap.NewNop())
+		net.add(name, node)
+		go obs.watch(ctx, name, node.ServerInfoChan())
+		go node.DefineMasterServer(ctx)
+		go node.Sync(ctx, stateless{})
+	}
+	return obs
+}
+
+func without(names []string, name string) []string {
+	result := make([]string, 0, len(names))
+	for _, v := range names {
+		if v != name {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+/* observer collects every server info the nodes publish */
+type observer struct {
+	masters   map[uint64]string
+	conflicts []string
+	latest    map[string]domain.ServerInfo
+	mu        *sync.Mutex
+}
+
+func newObserver() *observer {
+	return &observer{
+		masters: make(map[uint64]string),
+		latest:  make(map[string]domain.ServerInfo),
+		mu:      &sync.Mutex{},
+	}
+}
+
+func (o *observer) watch(ctx context.Context, name string, infos <-chan domain.ServerInfo) {
+	for {
+		select {
+		case info := <-infos:
+			o.mu.Lock()
+			o.latest[name] = info
+			if info.ServerRole == domain.MasterServer {
+				if prev, ok := o.masters[info.Term]; ok && prev != name {
+					o.conflicts = append(o.conflicts,
+						fmt.Sprintf("term %d has two masters: '%s' and '%s'", info.Term, prev, name))
+				}
+				o.masters[info.Term] = name
+			}
+			o.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (o *observer) anyMaster() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for name, info := range o.latest {
+		if info.ServerRole == domain.MasterServer {
+			return name
+		}
+	}
+	return ""
+}
+
+func (o *observer) waitAgreement(names []string, timeout time.Duration) (string, uint64, bool) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if master, term, ok := o.agreement(names); ok {
+			return master, term, true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "", 0, false
+}
+
+func (o *observer) agreement(names []string) (string, uint64, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var (
+		master  string
+		term    uint64
+		masters int
+	)
+	for i, name := range names {
+		info, ok := o.latest[name]
+		if !ok || info.MasterServerName == "" {
+			return "", 0, false
+		}
+		if i == 0 {
+			master, term = info.MasterServerName, info.Term
+		}
+		if info.MasterServerName != master || info.Term != term {
+			return "", 0, false
+		}
+		if info.ServerRole == domain.MasterServer {
+			masters++
+		}
+	}
+	return master, term, masters == 1
+}
+
+func (o *observer) violations() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.conflicts...)
+}
+
+func (o *observer) termCount() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.masters)
+}
+
+/* network routes election requests between the nodes, a partitioned pair of nodes can't reach each other */
+type network struct {
+	nodes   map[string]domain.SyncUseCase
+	cut     map[string]map[string]bool
+	latency time.Duration
+	mu      *sync.RWMutex
+}
+
+func newNetwork(latency time.Duration) *network {
+	return &network{
+		nodes:   make(map[string]domain.SyncUseCase),
+		cut:     make(map[string]map[string]bool),
+		latency: latency,
+		mu:      &sync.RWMutex{},
+	}
+}
+
+func (n *network) add(name string, node domain.SyncUseCase) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nodes[name] = node
+}
+
+func (n *network) node(name string) domain.SyncUseCase {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.nodes[name]
+}
+
+func (n *network) heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.cut = make(map[string]map[string]bool)
+}
+
+func (n *network) partition(lhs []string, rhs []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.cut = make(map[string]map[string]bool)
+	for _, a := range lhs {
+		for _, b := range rhs {
+			n.cutLink(a, b)
+			n.cutLink(b, a)
+		}
+	}
+}
+
+func (n *network) cutLink(from string, to string) {
+	if n.cut[from] == nil {
+		n.cut[from] = make(map[string]bool)
+	}
+	n.cut[from][to] = true
+}
+
+func (n *network) route(ctx context.Context, from string, to string) (domain.SyncUseCase, error) {
+	if n.latency > 0 {
+		select {
+		case <-time.After(rand.N(n.latency)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	node, ok := n.nodes[to]
+	if !ok || n.cut[from][to] {
+		return nil, fmt.Errorf("'%s' is unreachable from '%s'", to, from)
+	}
+	return node, nil
+}
+
+/* stateless is a hub without games, the empty log is still shipped, so the successors of handovers are caught up */
+type stateless struct {
+	domain.HubUseCase
+}
+
+func (stateless) State() domain.HubState {
+	return domain.HubState{}
+}
+
+func (stateless) ApplyStates(context.Context, domain.HubState) {}
+
+func (stateless) ApplyChanges(context.Context, []domain.Change) {}
+
+/* transport is domain.SyncRepository of a single node on top of the in-memory network */
+type transport struct {
+	from string
+	net  *network
+}
+
+func (t transport) Replicate(ctx context.Context, addr string,
+	req domain.ReplicationRequest) (*domain.ReplicationResponse, error) {
+	node, err := t.net.route(ctx, t.from, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp := node.HandleReplication(ctx, req)
+	return &resp, nil
+}
+
+func (t transport) Forward(context.Context, string, domain.ForwardRequest) (*domain.ForwardResponse, error) {
+	return nil, fmt.Errorf("forwarding isn't simulated")
+}
+
+func (t transport) Snapshot(ctx context.Context, addr string, req domain.SnapshotRequest) (*domain.SnapshotInfo, error) {
+	node, err := t.net.route(ctx, t.from, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp := node.HandleSnapshot(ctx, req)
+	return &resp, nil
+}
+
+func (t transport) SnapshotChunk(ctx context.Context, addr string,
+	req domain.ChunkRequest) (*domain.ChunkResponse, error) {
+	node, err := t.net.route(ctx, t.from, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp := node.HandleSnapshotChunk(ctx, req)
+	return &resp, nil
+}
+
+func (t transport) Join(context.Context, string, domain.JoinRequest) (*domain.MembersResponse, error) {
+	return nil, fmt.Errorf("membership isn't simulated")
+}
+
+func (t transport) Gossip(context.Context, string, domain.GossipRequest) (*domain.MembersResponse, error) {
+	return nil, fmt.Errorf("membership isn't simulated")
+}
+
+func (t transport) NodeStatus(ctx context.Context, addr string) (*domain.NodeStatus, error) {
+	node, err := t.net.route(ctx, t.from, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp := node.NodeStatus()
+	return &resp, nil
+}
+
+func (t transport) Takeover(ctx context.Context, addr string,
+	req domain.TakeoverRequest) (*domain.TakeoverResponse, error) {
+	node, err := t.net.route(ctx, t.from, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp := node.HandleTakeover(ctx, req)
+	return &resp, nil
+}
+
+func (t transport) HealthCheck(ctx context.Context, addr string) (*domain.HealthCheckResponse, error) {
+	if _, err := t.net.route(ctx, t.from, addr); err != nil {
+		return nil, err
+	}
+	return &domain.HealthCheckResponse{}, nil
+}
+
+func (t transport) RequestVote(ctx context.Context, addr string, req domain.VoteRequest) (*domain.VoteResponse, error) {
+	node, err := t.net.route(ctx, t.from, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp := node.HandleVote(ctx, req)
+	return &resp, nil
+}
+
+func (t transport) Heartbeat(ctx context.Context, addr string,
+	req domain.HeartbeatRequest) (*domain.HeartbeatResponse, error) {
+	node, err := t.net.route(ctx, t.from, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp := node.HandleHeartbeat(ctx, req)
+	return &resp, nil
+}
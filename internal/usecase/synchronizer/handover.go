@@ -0,0 +1,222 @@
+package synchronizer
+
+import (
+	"cmp"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+/*
+ * The master hands its role over on request. It chooses the most caught up live reserve (or the given one),
+ * stops taking new games and holds the moves back, waits until the successor has the whole log
+ * and asks it to start the election right away. The successor's vote request of the next term
+ * makes the master step down, so there is still at most one master per term, and the master sends its players
+ * to the successor (see ServerInfo.Successor) instead of leaving them to reconnect on their own.
+ * The moves held back are rejected then, the players make them again on the successor.
+ * A draining server doesn't take new games and doesn't run for the master, a draining master hands its role over
+ */
+
+/* Handover hands the master role over to the successor and returns its name once the successor is the master */
+func (u *useCase) Handover(ctx context.Context, successor string) (string, error) {
+	u.mu.Lock()
+	if u.role != leader {
+		u.mu.Unlock()
+		return "", domain.ErrNotLeader
+	}
+	if u.successor != "" {
+		u.mu.Unlock()
+		return "", domain.ErrHandoverInProgress
+	}
+	if successor == "" {
+		successor = u.chooseSuccessor()
+	}
+	p, ok := u.peers[successor]
+	if !ok {
+		u.mu.Unlock()
+		if successor == "" {
+			return "", domain.ErrNoSuccessor
+		}
+		return "", errors.WithMessagef(domain.ErrUnknownMember, "successor '%s'", successor)
+	}
+	term := u.term
+	u.successor = successor
+	u.handedOver = make(chan struct{})
+	info := u.info()
+	u.mu.Unlock()
+	u.infos.publish(info)
+	defer u.endHandover()
+
+	startedAt := time.Now()
+	u.logger.Info("handing the master role over", zap.String("successor", successor), zap.Uint64("term", term))
+	if err := u.pushTo(ctx, p, term); err != nil {
+		return "", errors.WithMessagef(err, "push the log to '%s'", successor)
+	}
+	resp, err := u.repo.Takeover(ctx, p.addr, domain.TakeoverRequest{Term: term, Leader: u.serverName})
+	if err != nil {
+		return "", errors.WithMessagef(err, "ask '%s' to take the master role over", successor)
+	}
+	if !resp.Success {
+		u.observeTerm(resp.Term)
+		return "", errors.WithMessagef(domain.ErrTakeoverRefused, "successor '%s'", successor)
+	}
+	if err := u.awaitStepDown(ctx, term); err != nil {
+		return "", errors.WithMessagef(err, "wait for '%s' to become the master", successor)
+	}
+	u.logger.Info("handed the master role over", zap.String("successor", successor),
+		zap.Duration("took", time.Since(startedAt)))
+	return successor, nil
+}
+
+/* endHandover lets the held back moves go on, they are rejected if the server is no longer the master */
+func (u *useCase) endHandover() {
+	u.mu.Lock()
+	u.successor = ""
+	close(u.handedOver)
+	u.handedOver = nil
+	info := u.info()
+	u.mu.Unlock()
+	u.infos.publish(info)
+}
+
+/* pushTo waits until the peer acknowledges the whole log, nothing is appended to it but the hub's own changes */
+func (u *useCase) pushTo(ctx context.Context, p *peer, term uint64) error {
+	timer := time.NewTimer(u.ackTimeout)
+	defer timer.Stop()
+	for {
+		u.mu.Lock()
+		if u.role != leader || u.term != term {
+			u.mu.Unlock()
+			return domain.ErrNotLeader
+		}
+		if p.nextSeq > 0 && p.matchSeq >= u.log.lastSeq {
+			u.mu.Unlock()
+			return nil
+		}
+		p.notify()
+		wait := u.acks
+		u.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-timer.C:
+			return domain.ErrReplicationTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+/* awaitStepDown waits until the successor's vote request of the next term makes this server step down */
+func (u *useCase) awaitStepDown(ctx context.Context, term uint64) error {
+	timer := time.NewTimer(u.electionTimeout)
+	defer timer.Stop()
+	for {
+		u.mu.Lock()
+		if u.role != leader || u.term != term {
+			u.mu.Unlock()
+			return nil
+		}
+		wait := u.acks /* it's signaled when the master steps down */
+		u.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-timer.C:
+			return domain.ErrHandoverTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+/*
+ * appendMove appends the change of a game unless the master hands its role over, then the change is held back
+ * until the handover ends and it's rejected if the server is no longer the master
+ */
+func (u *useCase) appendMove(ctx context.Context, change domain.Change) (term uint64, seq uint64, ok bool, err error) {
+	heldBack := false
+	for {
+		u.mu.Lock()
+		handedOver := u.handedOver
+		if handedOver == nil {
+			term, seq, ok = u.appendLocked(change)
+			u.mu.Unlock()
+			if heldBack && !ok {
+				return 0, 0, false, domain.ErrNotLeader
+			}
+			return term, seq, ok, nil
+		}
+		u.mu.Unlock()
+		heldBack = true
+		select {
+		case <-handedOver:
+		case <-ctx.Done():
+			return 0, 0, false, ctx.Err()
+		}
+	}
+}
+
+/*
+ * chooseSuccessor is called under the lock, it returns the live reserve that has the most of the log,
+ * the reserves following another log (nextSeq = 0) don't get the votes of the ones following ours
+ */
+func (u *useCase) chooseSuccessor() string {
+	var best *peer
+	for _, p := range u.peers {
+		if !u.isLive(p) || p.draining {
+			continue
+		}
+		if best == nil || successorCmp(p, best) > 0 {
+			best = p
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.name
+}
+
+func successorCmp(lhs *peer, rhs *peer) int {
+	switch {
+	case (lhs.nextSeq > 0) != (rhs.nextSeq > 0):
+		return cmp.Compare(min(lhs.nextSeq, 1), min(rhs.nextSeq, 1))
+	case lhs.matchSeq != rhs.matchSeq:
+		return cmp.Compare(lhs.matchSeq, rhs.matchSeq)
+	default:
+		return strings.Compare(rhs.name, lhs.name)
+	}
+}
+
+/* HandleTakeover starts the election on the successor if the request comes from the master it follows */
+func (u *useCase) HandleTakeover(_ context.Context, req domain.TakeoverRequest) domain.TakeoverResponse {
+	u.mu.Lock()
+	accepted := req.Term == u.term && req.Leader == u.leaderName && u.role != leader && u.isMember() && !u.draining
+	resp := domain.TakeoverResponse{Term: u.term, Success: accepted}
+	u.mu.Unlock()
+	if !accepted {
+		u.logger.Warn("refused to take the master role over", zap.String("master", req.Leader),
+			zap.Uint64("epoch", req.Term), zap.Uint64("current epoch", resp.Term))
+		return resp
+	}
+	u.logger.Info("taking the master role over", zap.String("master", req.Leader))
+	go u.elect(context.Background())
+	return resp
+}
+
+/* Drain makes the server stop taking new games, the master hands its role over and returns the successor */
+func (u *useCase) Drain(ctx context.Context) (string, error) {
+	u.mu.Lock()
+	u.draining = true
+	isLeader := u.role == leader
+	u.mu.Unlock()
+	u.logger.Info("draining the server")
+	if !isLeader {
+		return "", nil
+	}
+	return u.Handover(ctx, "")
+}
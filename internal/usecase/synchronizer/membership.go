@@ -0,0 +1,223 @@
+package synchronizer
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"go.uber.org/zap"
+)
+
+/*
+ * The members of the cluster start as config.Servers and change with the join and leave requests any member handles.
+ * A change bumps the version of the member's entry and spreads by gossip: every gossip period a server exchanges
+ * its member list with a random peer and both keep the newer entries. A member that has left stays as a tombstone,
+ * so a lagging server doesn't bring it back. The majority is counted over the current members,
+ * so the members are meant to be added and removed one at a time
+ */
+
+const defaultGossipPeriod = time.Second
+
+func (u *useCase) HandleJoin(_ context.Context, req domain.JoinRequest) domain.MembersResponse {
+	u.mu.Lock()
+	member, ok := u.members[req.Name]
+	isChanged := !ok || member.Left || member.Addr != req.Addr
+	if isChanged {
+		u.updateMember(domain.Member{Name: req.Name, Addr: req.Addr, Version: member.Version + 1})
+	}
+	resp := domain.MembersResponse{Members: u.memberList()}
+	addrs := u.peerAddrs()
+	u.mu.Unlock()
+	if isChanged {
+		u.logger.Info("server joined the cluster", zap.String("server", req.Name), zap.String("addr", req.Addr))
+		go u.announce(addrs)
+	}
+	return resp
+}
+
+func (u *useCase) HandleLeave(_ context.Context, req domain.LeaveRequest) (domain.MembersResponse, error) {
+	u.mu.Lock()
+	member, ok := u.members[req.Name]
+	if !ok || member.Left {
+		u.mu.Unlock()
+		return domain.MembersResponse{}, domain.ErrUnknownMember
+	}
+	addrs := u.peerAddrs() /* the leaving server is told as well */
+	member.Version++
+	member.Left = true
+	steppedDown := u.updateMember(member)
+	resp := domain.MembersResponse{Members: u.memberList()}
+	info := u.info()
+	u.mu.Unlock()
+	u.logger.Info("server left the cluster", zap.String("server", req.Name))
+	if steppedDown {
+		u.infos.publish(info)
+	}
+	go u.announce(addrs)
+	return resp, nil
+}
+
+func (u *useCase) HandleGossip(_ context.Context, req domain.GossipRequest) domain.MembersResponse {
+	u.applyMembers(req.Members)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return domain.MembersResponse{Members: u.memberList()}
+}
+
+func (u *useCase) Members() []domain.Member {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.memberList()
+}
+
+/* gossip exchanges the member list with a random peer every gossip period, a joining server keeps joining instead */
+func (u *useCase) gossip(ctx context.Context) {
+	ticker := time.NewTicker(u.gossipPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		u.mu.Lock()
+		joining := u.joining
+		addrs := u.peerAddrs()
+		req := domain.GossipRequest{From: u.serverName, Members: u.memberList()}
+		u.mu.Unlock()
+		if len(addrs) == 0 {
+			continue
+		}
+		if joining {
+			u.join(ctx, addrs)
+			continue
+		}
+		addr := addrs[rand.N(len(addrs))]
+		resp, err := u.repo.Gossip(ctx, addr, req)
+		if err != nil {
+			u.logger.Debug("gossip member list", zap.String("addr", addr), zap.Error(err))
+			continue
+		}
+		u.applyMembers(resp.Members)
+	}
+}
+
+/* join asks the known servers one by one to add this one to the cluster */
+func (u *useCase) join(ctx context.Context, addrs []string) {
+	req := domain.JoinRequest{Name: u.serverName, Addr: u.selfAddr}
+	for _, addr := range addrs {
+		resp, err := u.repo.Join(ctx, addr, req)
+		if err != nil {
+			u.logger.Warn("join the cluster", zap.String("addr", addr), zap.Error(err))
+			continue
+		}
+		u.logger.Info("joined the cluster", zap.String("through", addr))
+		u.applyMembers(resp.Members)
+		return
+	}
+}
+
+/* announce pushes the member list to the given servers right away, so a change doesn't wait for gossip */
+func (u *useCase) announce(addrs []string) {
+	u.mu.Lock()
+	req := domain.GossipRequest{From: u.serverName, Members: u.memberList()}
+	u.mu.Unlock()
+	responses := broadcastTo(context.Background(), u, addrs,
+		func(ctx context.Context, addr string) (*domain.MembersResponse, error) {
+			return u.repo.Gossip(ctx, addr, req)
+		})
+	for _, resp := range responses {
+		u.applyMembers(resp.Members)
+	}
+}
+
+/* applyMembers keeps the entries newer than the known ones */
+func (u *useCase) applyMembers(members []domain.Member) {
+	u.mu.Lock()
+	steppedDown := false
+	for _, member := range members {
+		if known, ok := u.members[member.Name]; ok && !isNewer(member, known) {
+			continue
+		}
+		u.logger.Info("member list changed", zap.Any("member", member))
+		steppedDown = u.updateMember(member) || steppedDown
+	}
+	info := u.info()
+	u.mu.Unlock()
+	if steppedDown {
+		u.infos.publish(info)
+	}
+}
+
+/* the entries of the same version are ordered too, so that every server keeps the same one */
+func isNewer(member domain.Member, known domain.Member) bool {
+	switch {
+	case member.Version != known.Version:
+		return member.Version > known.Version
+	case member.Left != known.Left:
+		return member.Left
+	default:
+		return member.Addr > known.Addr
+	}
+}
+
+/*
+ * updateMember is called under the lock, it replaces the peer of the member, so a joined server gets a snapshot.
+ * It returns true if this server has left the cluster being the master
+ */
+func (u *useCase) updateMember(member domain.Member) bool {
+	u.members[member.Name] = member
+	if member.Name == u.serverName {
+		u.joining = false
+		if !member.Left {
+			return false
+		}
+		u.logger.Warn("the server is no longer a member of the cluster")
+		return u.role == leader && u.stepDown(u.term, "")
+	}
+	if p, ok := u.peers[member.Name]; ok {
+		p.stop()
+		delete(u.peers, member.Name)
+		delete(u.addrs, member.Name)
+	}
+	if !member.Left {
+		p := newPeer(member.Name, member.Addr)
+		u.peers[member.Name] = p
+		u.addrs[member.Name] = member.Addr
+		u.startPeer(p)
+	}
+	if u.role == leader {
+		u.signalAcks() /* the majority has changed */
+	}
+	return false
+}
+
+/* isMember is called under the lock, a server that isn't a member doesn't run for the master */
+func (u *useCase) isMember() bool {
+	member, ok := u.members[u.serverName]
+	return ok && !member.Left
+}
+
+/* memberList is called under the lock */
+func (u *useCase) memberList() []domain.Member {
+	members := make([]domain.Member, 0, len(u.members))
+	for _, member := range u.members {
+		members = append(members, member)
+	}
+	slices.SortFunc(members, func(lhs, rhs domain.Member) int {
+		return strings.Compare(lhs.Name, rhs.Name)
+	})
+	return members
+}
+
+/* peerAddrs is called under the lock */
+func (u *useCase) peerAddrs() []string {
+	addrs := make([]string, 0, len(u.addrs))
+	for _, addr := range u.addrs {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
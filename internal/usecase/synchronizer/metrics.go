@@ -0,0 +1,56 @@
+package synchronizer
+
+import (
+	"expvar"
+	"time"
+)
+
+/* metrics of the quorum durability mode and of the bootstrap of reserves, expvar serves them at /debug/vars */
+type replicationMetrics struct {
+	acked             *expvar.Int
+	ackTimeouts       *expvar.Int
+	ackFailures       *expvar.Int
+	latencyMsSum      *expvar.Int
+	latencyMsLast     *expvar.Int
+	latencyMsMax      *expvar.Int
+	snapshots         *expvar.Int
+	bootstraps        *expvar.Int
+	bootstrapFailures *expvar.Int
+}
+
+var metrics = newReplicationMetrics()
+
+func newReplicationMetrics() replicationMetrics {
+	m := replicationMetrics{
+		acked:             new(expvar.Int),
+		ackTimeouts:       new(expvar.Int),
+		ackFailures:       new(expvar.Int),
+		latencyMsSum:      new(expvar.Int),
+		latencyMsLast:     new(expvar.Int),
+		latencyMsMax:      new(expvar.Int),
+		snapshots:         new(expvar.Int),
+		bootstraps:        new(expvar.Int),
+		bootstrapFailures: new(expvar.Int),
+	}
+	vars := expvar.NewMap("replication")
+	vars.Set("acked", m.acked)
+	vars.Set("ack_timeouts", m.ackTimeouts)
+	vars.Set("ack_failures", m.ackFailures)
+	vars.Set("latency_ms_sum", m.latencyMsSum)
+	vars.Set("latency_ms_last", m.latencyMsLast)
+	vars.Set("latency_ms_max", m.latencyMsMax)
+	vars.Set("snapshots", m.snapshots)
+	vars.Set("bootstraps", m.bootstraps)
+	vars.Set("bootstrap_failures", m.bootstrapFailures)
+	return m
+}
+
+func (m replicationMetrics) observe(latency time.Duration) {
+	ms := latency.Milliseconds()
+	m.acked.Add(1)
+	m.latencyMsSum.Add(ms)
+	m.latencyMsLast.Set(ms)
+	if ms > m.latencyMsMax.Value() {
+		m.latencyMsMax.Set(ms)
+	}
+}
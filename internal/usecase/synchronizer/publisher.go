@@ -0,0 +1,51 @@
+package synchronizer
+
+import (
+	"sync"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+)
+
+/* publisher delivers server infos in order and doesn't block the election while nobody reads them */
+type publisher struct {
+	queue []domain.ServerInfo
+	wake  chan struct{}
+	out   chan domain.ServerInfo
+	mu    *sync.Mutex
+}
+
+func newPublisher() *publisher {
+	p := &publisher{
+		wake: make(chan struct{}, 1),
+		out:  make(chan domain.ServerInfo),
+		mu:   &sync.Mutex{},
+	}
+	go p.run()
+	return p
+}
+
+func (p *publisher) publish(info domain.ServerInfo) {
+	p.mu.Lock()
+	p.queue = append(p.queue, info)
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *publisher) run() {
+	for range p.wake {
+		for {
+			p.mu.Lock()
+			if len(p.queue) == 0 {
+				p.mu.Unlock()
+				break
+			}
+			info := p.queue[0]
+			p.queue = p.queue[1:]
+			p.mu.Unlock()
+			p.out <- info
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package synchronizer
+
+import (
+	"context"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	logRetention         = 4096
+	replicationBatchSize = 256
+)
+
+/*
+ * replicationLog is the tail of the master's log of changes. Every master starts a new log in its term
+ * right after the changes it has applied (baseTerm, baseSeq), so the reserves that have applied the same
+ * follow it as is and only the ones behind or ahead of it catch up from a snapshot.
+ * A reserve only keeps the position (term, lastSeq) of the log it has applied
+ */
+type replicationLog struct {
+	term     uint64
+	lastSeq  uint64
+	baseTerm uint64
+	baseSeq  uint64
+	entries  []domain.Change
+}
+
+func (l *replicationLog) reset(term uint64, lastSeq uint64) {
+	l.term = term
+	l.lastSeq = lastSeq
+	l.baseTerm, l.baseSeq = 0, 0
+	l.entries = nil
+}
+
+/* continueIn starts the log of the new master in its term, the sequence numbers go on from the applied changes */
+func (l *replicationLog) continueIn(term uint64) {
+	l.baseTerm, l.baseSeq = l.term, l.lastSeq
+	l.term = term
+	l.entries = nil
+}
+
+func (l *replicationLog) append(change domain.Change) {
+	l.lastSeq++
+	change.Seq = l.lastSeq
+	l.entries = append(l.entries, change)
+	if len(l.entries) > logRetention {
+		l.entries = append([]domain.Change(nil), l.entries[len(l.entries)-logRetention:]...)
+	}
+}
+
+/* since returns the entries starting from seq, false means they're no longer retained */
+func (l *replicationLog) since(seq uint64) ([]domain.Change, bool) {
+	if seq > l.lastSeq {
+		return nil, true
+	}
+	if len(l.entries) == 0 || seq < l.entries[0].Seq {
+		return nil, false
+	}
+	from := int(seq - l.entries[0].Seq)
+	to := min(from+replicationBatchSize, len(l.entries))
+	return append([]domain.Change(nil), l.entries[from:to]...), true
+}
+
+/* firstSeq is the oldest change still retained */
+func (l *replicationLog) firstSeq() uint64 {
+	if len(l.entries) == 0 {
+		return l.lastSeq + 1
+	}
+	return l.entries[0].Seq
+}
+
+/* isBehind tells whether the candidate's log is older than ours, such a candidate doesn't get our vote */
+func (l *replicationLog) isBehind(term uint64, lastSeq uint64) bool {
+	return term < l.term || (term == l.term && lastSeq < l.lastSeq)
+}
+
+/*
+ * peer is a reserve the master ships its log to, nextSeq = 0 means the reserve needs a snapshot.
+ * matchSeq is the last change of the current log the reserve has acknowledged,
+ * seenAt is the last time the reserve answered the master, draining is what it answered to the last heartbeat
+ */
+type peer struct {
+	name     string
+	addr     string
+	nextSeq  uint64
+	matchSeq uint64
+	seenAt   time.Time
+	draining bool
+	wake     chan struct{}
+	cancel   context.CancelFunc
+}
+
+func newPeer(name string, addr string) *peer {
+	return &peer{
+		name: name,
+		addr: addr,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+/* stop ends shipping the log to a server that has left the cluster */
+func (p *peer) stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
+func (p *peer) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+/* Append adds a change made on the master to the log, it's shipped to reserves right away */
+func (u *useCase) Append(change domain.Change) {
+	u.append(change)
+}
+
+/* append returns the position of the change in the log, false means the server isn't the master */
+func (u *useCase) append(change domain.Change) (term uint64, seq uint64, ok bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.appendLocked(change)
+}
+
+/* appendLocked is called under the lock */
+func (u *useCase) appendLocked(change domain.Change) (term uint64, seq uint64, ok bool) {
+	if u.role != leader {
+		return 0, 0, false
+	}
+	u.log.append(change)
+	for _, p := range u.peers {
+		p.notify()
+	}
+	return u.term, u.log.lastSeq, true
+}
+
+/*
+ * Commit makes the synchronizer a listener of the journal: every committed game state is a change.
+ * In the quorum durability mode it returns once the majority of servers has the change,
+ * so the game confirms a move only when it survives the failover of the master.
+ * A reserve owning the game when games are sharded forwards the change to the master
+ */
+func (u *useCase) Commit(ctx context.Context, gameUuid string, state *domain.GameState) error {
+	change := domain.Change{Kind: domain.GameChanged, GameUuid: gameUuid, State: state}
+	if u.sharding && !u.isLeader() {
+		return u.forward(ctx, change)
+	}
+	return u.commitChange(ctx, change)
+}
+
+/* CommitAccount ships a registered account like a move, only the master registers players */
+func (u *useCase) CommitAccount(ctx context.Context, account *domain.Account) error {
+	if !u.isLeader() {
+		return domain.ErrNotLeader
+	}
+	return u.commitChange(ctx, domain.Change{Kind: domain.AccountChanged, Account: account})
+}
+
+func (u *useCase) commitChange(ctx context.Context, change domain.Change) error {
+	term, seq, ok, err := u.appendMove(ctx, change)
+	if err != nil {
+		return err
+	}
+	if u.durability != QuorumDurability {
+		return nil
+	}
+	if !ok {
+		return domain.ErrNotLeader
+	}
+	startedAt := time.Now()
+	err = u.awaitQuorum(ctx, term, seq)
+	latency := time.Since(startedAt)
+	fields := []zap.Field{
+		zap.String("game uuid", change.GameUuid), zap.Uint64("seq", seq), zap.Duration("latency", latency),
+	}
+	switch {
+	case errors.Is(err, domain.ErrReplicationTimeout):
+		metrics.ackTimeouts.Add(1)
+		u.logger.Warn("change isn't acknowledged by the majority in time", fields...)
+		return err
+	case err != nil:
+		metrics.ackFailures.Add(1)
+		u.logger.Warn("change isn't acknowledged by the majority", append(fields, zap.Error(err))...)
+		return err
+	}
+	metrics.observe(latency)
+	u.logger.Info("change is acknowledged by the majority", fields...)
+	return nil
+}
+
+func (u *useCase) awaitQuorum(ctx context.Context, term uint64, seq uint64) error {
+	timer := time.NewTimer(u.ackTimeout)
+	defer timer.Stop()
+	for {
+		u.mu.Lock()
+		if u.role != leader || u.term != term {
+			u.mu.Unlock()
+			return domain.ErrNotLeader
+		}
+		acks := 1
+		for _, p := range u.peers {
+			if p.matchSeq >= seq {
+				acks++
+			}
+		}
+		if u.isMajority(acks) {
+			u.mu.Unlock()
+			return nil
+		}
+		wait := u.acks
+		u.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-timer.C:
+			return domain.ErrReplicationTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+/* signalAcks wakes up the commits awaiting the quorum, must be called under mu */
+func (u *useCase) signalAcks() {
+	close(u.acks)
+	u.acks = make(chan struct{})
+}
+
+/* Sync ships the log to every reserve while the server is the master and gossips the member list */
+func (u *useCase) Sync(ctx context.Context, hub domain.HubUseCase) {
+	u.mu.Lock()
+	u.hub = hub
+	u.runCtx = ctx
+	for _, p := range u.peers {
+		u.startPeer(p)
+	}
+	u.mu.Unlock()
+	go u.gossip(ctx)
+	<-ctx.Done()
+}
+
+/* startPeer is called under the lock, the peers added before Sync are started by it */
+func (u *useCase) startPeer(p *peer) {
+	if u.runCtx == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(u.runCtx)
+	p.cancel = cancel
+	go u.shipLog(ctx, p)
+}
+
+func (u *useCase) shipLog(ctx context.Context, p *peer) {
+	ticker := time.NewTicker(u.heartbeatPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		for u.replicate(ctx, p) {
+		}
+	}
+}
+
+/* replicate sends a single batch to the peer, true means there is more to send */
+func (u *useCase) replicate(ctx context.Context, p *peer) bool {
+	u.mu.Lock()
+	if u.role != leader || u.hub == nil {
+		u.mu.Unlock()
+		return false
+	}
+	req := domain.ReplicationRequest{
+		Term:     u.term,
+		Leader:   u.serverName,
+		LogTerm:  u.log.term,
+		BaseTerm: u.log.baseTerm,
+		BaseSeq:  u.log.baseSeq,
+		FirstSeq: u.log.firstSeq(),
+		LastSeq:  u.log.lastSeq,
+	}
+	changes, ok := u.log.since(p.nextSeq)
+	switch {
+	case p.nextSeq == 0 || !ok:
+		req.PrevSeq = u.log.lastSeq /* the reserve answers with its position or bootstraps */
+	case len(changes) == 0:
+		u.mu.Unlock()
+		return false
+	default:
+		req.PrevSeq = p.nextSeq - 1
+		req.Changes = changes
+	}
+	u.mu.Unlock()
+
+	resp, err := u.repo.Replicate(ctx, p.addr, req)
+	if err != nil {
+		u.logger.Debug("replicate log", zap.String("peer", p.name), zap.Error(err))
+		return false
+	}
+	if resp.Term > req.Term {
+		u.observeTerm(resp.Term)
+		return false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.role != leader || u.term != req.Term {
+		return false
+	}
+	p.seenAt = time.Now()
+	if !resp.Success && resp.LogTerm != u.log.term {
+		p.nextSeq = 0 /* the reserve follows another log, it bootstraps */
+		return false
+	}
+	p.nextSeq = resp.LastSeq + 1
+	if resp.Success && resp.LastSeq > p.matchSeq {
+		p.matchSeq = resp.LastSeq
+		u.signalAcks()
+	}
+	return resp.Success && p.nextSeq <= u.log.lastSeq
+}
+
+/*
+ * HandleReplication applies the master's changes on a reserve strictly in the order of sequence numbers.
+ * Nothing is applied while the reserve bootstraps, the master resends the changes following the snapshot
+ */
+func (u *useCase) HandleReplication(ctx context.Context, req domain.ReplicationRequest) domain.ReplicationResponse {
+	u.applyMu.Lock()
+	defer u.applyMu.Unlock()
+
+	u.mu.Lock()
+	if req.Term < u.term {
+		resp := u.replicationResponse(false)
+		u.mu.Unlock()
+		u.logger.Warn("rejected changes of a stale master",
+			zap.String("master", req.Leader), zap.Uint64("epoch", req.Term), zap.Uint64("current epoch", resp.Term))
+		return resp
+	}
+	if u.hub == nil {
+		resp := u.replicationResponse(false)
+		u.mu.Unlock()
+		return resp
+	}
+	changed := u.stepDown(req.Term, req.Leader)
+	u.heardAt = time.Now()
+	info := u.info()
+	logTerm, lastSeq, hub := u.log.term, u.log.lastSeq, u.hub
+	if req.LogTerm != logTerm && req.BaseTerm == logTerm && req.BaseSeq == lastSeq && !u.bootstrapping {
+		/* the new master has continued the log right where we are, no snapshot is needed */
+		u.log.reset(req.LogTerm, lastSeq)
+		logTerm = req.LogTerm
+	}
+	isGap := req.LogTerm != logTerm || req.PrevSeq > lastSeq
+	if req.LogTerm != logTerm || lastSeq+1 < req.FirstSeq {
+		u.startBootstrap(req.Leader)
+	}
+	if u.bootstrapping || isGap {
+		/* another log or a gap, the master will resend from our position or we bootstrap */
+		resp := u.replicationResponse(false)
+		u.mu.Unlock()
+		if changed {
+			u.infos.publish(info)
+		}
+		return resp
+	}
+	u.mu.Unlock()
+	if changed {
+		u.infos.publish(info)
+	}
+
+	changes := req.Changes[:0:0]
+	for _, v := range req.Changes {
+		if v.Seq > lastSeq {
+			changes = append(changes, v)
+			lastSeq = v.Seq
+		}
+	}
+	hub.ApplyChanges(ctx, changes)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.term == req.Term {
+		u.log.reset(logTerm, lastSeq)
+		u.caughtUp = lastSeq >= req.LastSeq
+	}
+	return u.replicationResponse(true)
+}
+
+func (u *useCase) replicationResponse(success bool) domain.ReplicationResponse {
+	return domain.ReplicationResponse{
+		Term:    u.term,
+		Success: success,
+		LogTerm: u.log.term,
+		LastSeq: u.log.lastSeq,
+	}
+}
@@ -0,0 +1,135 @@
+package synchronizer
+
+import (
+	"context"
+	"time"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+/*
+ * ownerLeaseFactor * electionTimeout is how long the master waits for a silent server before
+ * it reassigns the server's games. A reserve that doesn't hear of the master for electionTimeout
+ * stops serving its games, so two servers never serve the same game at once
+ */
+const ownerLeaseFactor = 2
+
+func (u *useCase) Sharded() bool {
+	return u.sharding
+}
+
+func (u *useCase) ServerName() string {
+	return u.serverName
+}
+
+func (u *useCase) MasterName() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.leaderName
+}
+
+/* LiveServers returns the master itself and the reserves that have answered it lately */
+func (u *useCase) LiveServers() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	servers := []string{u.serverName}
+	for name, p := range u.peers {
+		if u.isLive(p) {
+			servers = append(servers, name)
+		}
+	}
+	return servers
+}
+
+/* AcceptingServers returns the live servers the master places new games on */
+func (u *useCase) AcceptingServers() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	servers := make([]string, 0, len(u.peers)+1)
+	if !u.draining {
+		servers = append(servers, u.serverName)
+	}
+	for name, p := range u.peers {
+		if u.isLive(p) && !p.draining {
+			servers = append(servers, name)
+		}
+	}
+	return servers
+}
+
+/* isLive is called under the lock */
+func (u *useCase) isLive(p *peer) bool {
+	return time.Since(p.seenAt) < ownerLeaseFactor*u.electionTimeout
+}
+
+func (u *useCase) markSeen(addr string, draining bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, p := range u.peers {
+		if p.addr == addr {
+			p.seenAt = time.Now()
+			p.draining = draining
+		}
+	}
+}
+
+/*
+ * forward hands the change of a game the reserve owns over to the master. A change rejected by the master
+ * (the game has been reassigned or there is no master) or not acknowledged by the majority
+ * isn't confirmed to the players, an unreachable master is treated as in the quorum durability mode: the change reaches it with the next one
+ */
+func (u *useCase) forward(ctx context.Context, change domain.Change) error {
+	u.mu.Lock()
+	req := domain.ForwardRequest{Term: u.term, Server: u.serverName, Change: change}
+	addr, ok := u.addrs[u.leaderName]
+	u.mu.Unlock()
+	if !ok {
+		return domain.ErrNotLeader
+	}
+	resp, err := u.repo.Forward(ctx, addr, req)
+	switch {
+	case err != nil:
+		u.logger.Warn("forward change to the master", zap.String("game uuid", change.GameUuid), zap.Error(err))
+		if u.durability == QuorumDurability {
+			return domain.ErrReplicationTimeout
+		}
+		return nil
+	case resp.Success:
+		return nil
+	case resp.Unacknowledged:
+		return domain.ErrReplicationTimeout
+	case resp.Owner != "":
+		u.logger.Warn("the master rejected changes of the game owned by another server",
+			zap.String("game uuid", change.GameUuid), zap.String("owner", resp.Owner))
+		return domain.ErrNotOwner
+	default:
+		u.observeTerm(resp.Term)
+		return domain.ErrNotLeader
+	}
+}
+
+/* HandleForward puts the change of the game owner into the master's log as if the change was made on the master */
+func (u *useCase) HandleForward(ctx context.Context, req domain.ForwardRequest) domain.ForwardResponse {
+	u.observeTerm(req.Term)
+	u.mu.Lock()
+	resp := domain.ForwardResponse{Term: u.term}
+	isLeader, hub := u.role == leader, u.hub
+	u.mu.Unlock()
+	if !isLeader || hub == nil {
+		return resp
+	}
+	owner, ok := hub.Owner(req.Change.GameUuid)
+	if !ok || owner != req.Server {
+		resp.Owner = owner
+		u.logger.Warn("rejected changes of the game owned by another server", zap.String("server", req.Server),
+			zap.String("game uuid", req.Change.GameUuid), zap.String("owner", owner))
+		return resp
+	}
+	hub.ApplyChanges(ctx, []domain.Change{req.Change})
+	err := u.commitChange(ctx, req.Change)
+	resp.Success = err == nil
+	resp.Unacknowledged = errors.Is(err, domain.ErrReplicationTimeout)
+	return resp
+}
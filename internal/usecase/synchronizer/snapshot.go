@@ -0,0 +1,172 @@
+package synchronizer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+/*
+ * A reserve that can't be served from the master's log (it has just started, followed another master
+ * or fell too far behind) bootstraps: it downloads the master's serialized state chunk by chunk, checks the checksum,
+ * applies it and then gets the changes following the snapshot as usual.
+ * The master serves the same snapshot to the reserves bootstrapping within snapshotReuse
+ */
+const (
+	snapshotChunkSize = 64 << 10
+	snapshotReuse     = 5 * time.Second
+)
+
+type snapshot struct {
+	info    domain.SnapshotInfo
+	data    []byte
+	takenAt time.Time
+}
+
+func (u *useCase) HandleSnapshot(_ context.Context, req domain.SnapshotRequest) domain.SnapshotInfo {
+	u.observeTerm(req.Term)
+	u.snapshotMu.Lock()
+	defer u.snapshotMu.Unlock()
+
+	u.mu.Lock()
+	term, isLeader, hub, last := u.term, u.role == leader, u.hub, u.snapshot
+	info := domain.SnapshotInfo{Term: term, Id: uuid.NewString(), LogTerm: u.log.term, LastSeq: u.log.lastSeq}
+	/* the changes following a reused snapshot must still be in the log */
+	isReusable := last != nil && last.info.Term == term && time.Since(last.takenAt) < snapshotReuse &&
+		last.info.LastSeq+1 >= u.log.firstSeq()
+	u.mu.Unlock()
+	if !isLeader || hub == nil {
+		return domain.SnapshotInfo{Term: term}
+	}
+	if isReusable {
+		return last.info
+	}
+
+	/* changes made while the snapshot is taken are in both, applying them twice does no harm */
+	data, err := jsoniter.Marshal(hub.State())
+	if err != nil {
+		u.logger.Error("marshal snapshot", zap.Error(err))
+		return domain.SnapshotInfo{Term: term}
+	}
+	info.Success = true
+	info.Size = len(data)
+	info.Chunks = (len(data) + snapshotChunkSize - 1) / snapshotChunkSize
+	info.Checksum = checksum(data)
+
+	u.mu.Lock()
+	u.snapshot = &snapshot{info: info, data: data, takenAt: time.Now()}
+	u.mu.Unlock()
+	metrics.snapshots.Add(1)
+	u.logger.Info("took snapshot", zap.String("server", req.Server), zap.String("id", info.Id),
+		zap.Uint64("seq", info.LastSeq), zap.Int("size", info.Size), zap.Int("chunks", info.Chunks))
+	return info
+}
+
+func (u *useCase) HandleSnapshotChunk(_ context.Context, req domain.ChunkRequest) domain.ChunkResponse {
+	u.observeTerm(req.Term)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	resp := domain.ChunkResponse{Term: u.term}
+	s := u.snapshot
+	if u.role != leader || s == nil || s.info.Id != req.Id || s.info.Term != u.term ||
+		req.Index < 0 || req.Index >= s.info.Chunks {
+		return resp
+	}
+	from := req.Index * snapshotChunkSize
+	resp.Data = s.data[from:min(from+snapshotChunkSize, len(s.data))]
+	resp.Success = true
+	return resp
+}
+
+/* startBootstrap is called under the lock, the reserve bootstraps once at a time */
+func (u *useCase) startBootstrap(leaderName string) {
+	addr, ok := u.addrs[leaderName]
+	if u.bootstrapping || !ok || u.runCtx == nil {
+		return
+	}
+	u.bootstrapping = true
+	u.caughtUp = false
+	go func() {
+		if err := u.bootstrap(u.runCtx, addr); err != nil {
+			metrics.bootstrapFailures.Add(1)
+			u.logger.Warn("bootstrap from the master's snapshot", zap.String("master", leaderName), zap.Error(err))
+		}
+		u.mu.Lock()
+		u.bootstrapping = false
+		u.mu.Unlock()
+	}()
+}
+
+func (u *useCase) bootstrap(ctx context.Context, addr string) error {
+	startedAt := time.Now()
+	u.mu.Lock()
+	term, hub := u.term, u.hub
+	u.mu.Unlock()
+	info, err := u.repo.Snapshot(ctx, addr, domain.SnapshotRequest{Term: term, Server: u.serverName})
+	if err != nil {
+		return errors.WithMessage(err, "request snapshot")
+	}
+	if !info.Success || info.Term != term {
+		u.observeTerm(info.Term)
+		return domain.ErrNotLeader
+	}
+	data := make([]byte, 0, info.Size)
+	for i := 0; i < info.Chunks; i++ {
+		chunk, err := u.repo.SnapshotChunk(ctx, addr, domain.ChunkRequest{Term: term, Id: info.Id, Index: i})
+		if err != nil {
+			return errors.WithMessagef(err, "download chunk %d of %d", i+1, info.Chunks)
+		}
+		if !chunk.Success {
+			return errors.WithMessagef(domain.ErrSnapshotExpired, "download chunk %d of %d", i+1, info.Chunks)
+		}
+		data = append(data, chunk.Data...)
+	}
+	if len(data) != info.Size || checksum(data) != info.Checksum {
+		return domain.ErrSnapshotCorrupted
+	}
+	state := domain.HubState{}
+	if err := jsoniter.Unmarshal(data, &state); err != nil {
+		return errors.WithMessage(err, "unmarshal snapshot")
+	}
+
+	u.applyMu.Lock()
+	defer u.applyMu.Unlock()
+	u.mu.Lock()
+	isStale := u.term != term || u.log.isBehind(info.LogTerm, info.LastSeq)
+	u.mu.Unlock()
+	if isStale {
+		return nil /* another master has been elected or the changes have already come */
+	}
+	hub.ApplyStates(ctx, state)
+	u.mu.Lock()
+	u.log.reset(info.LogTerm, info.LastSeq)
+	u.mu.Unlock()
+	metrics.bootstraps.Add(1)
+	u.logger.Info("bootstrapped from the master's snapshot", zap.Uint64("seq", info.LastSeq),
+		zap.Int("size", info.Size), zap.Int("chunks", info.Chunks), zap.Duration("took", time.Since(startedAt)))
+	return nil
+}
+
+/* Ready tells whether the server can serve: the master always can, a reserve once it has caught up with the master */
+func (u *useCase) Ready() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.isReady()
+}
+
+/* isReady is called under the lock */
+func (u *useCase) isReady() bool {
+	return u.role == leader || (u.caughtUp && !u.bootstrapping && u.hearsLeader())
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
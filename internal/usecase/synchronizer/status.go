@@ -0,0 +1,76 @@
+package synchronizer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
+)
+
+func (u *useCase) NodeStatus() domain.NodeStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return domain.NodeStatus{
+		Name:     u.serverName,
+		Addr:     u.selfAddr,
+		Role:     u.info().ServerRole,
+		Master:   u.leaderName,
+		Epoch:    u.term,
+		Ready:    u.isReady(),
+		Draining: u.draining,
+		LogTerm:  u.log.term,
+		LastSeq:  u.log.lastSeq,
+	}
+}
+
+/* ClusterStatus asks every member for its status, local is the status of this server */
+func (u *useCase) ClusterStatus(ctx context.Context, local domain.NodeStatus) domain.ClusterStatus {
+	u.mu.Lock()
+	members := u.memberList()
+	u.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, u.electionTimeout)
+	defer cancel()
+	var (
+		wg    sync.WaitGroup
+		nodes = make([]domain.NodeStatus, 0, len(members))
+	)
+	for _, member := range members {
+		if member.Left {
+			continue
+		}
+		nodes = append(nodes, domain.NodeStatus{Name: member.Name, Addr: member.Addr})
+		if member.Name == u.serverName {
+			nodes[len(nodes)-1] = local
+			continue
+		}
+		wg.Add(1)
+		go func(node *domain.NodeStatus) {
+			defer wg.Done()
+			status, err := u.repo.NodeStatus(ctx, node.Addr)
+			if err != nil {
+				node.Error = err.Error()
+				return
+			}
+			*node = *status
+		}(&nodes[len(nodes)-1])
+	}
+	wg.Wait()
+
+	status := domain.ClusterStatus{Nodes: nodes}
+	var master *domain.NodeStatus
+	for i, node := range nodes {
+		if node.Error == "" && node.Role == domain.MasterServer && (master == nil || node.Epoch > master.Epoch) {
+			master = &nodes[i]
+		}
+	}
+	if master != nil {
+		status.Master, status.Epoch = master.Name, master.Epoch
+	}
+	for i := range nodes {
+		nodes[i].Lag = -1
+		if master != nil && nodes[i].Error == "" && nodes[i].LogTerm == master.LogTerm {
+			nodes[i].Lag = int64(master.LastSeq) - int64(min(nodes[i].LastSeq, master.LastSeq))
+		}
+	}
+	return status
+}
@@ -2,132 +2,173 @@ package synchronizer
 
 import (
 	"context"
+	"maps"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/kiryu-dev/tic-tac-toe/internal/config"
 	"github.com/kiryu-dev/tic-tac-toe/internal/domain"
-	"github.com/pkg/errors"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
+type electionRole byte
+
+const (
+	follower electionRole = iota
+	candidate
+	leader
+)
+
 type useCase struct {
-	repo       domain.SyncRepository
-	addrs      map[string]string
-	masterName *atomic.String
-	serverName string
-	logger     *zap.Logger
-	ticker     *time.Ticker
-	srvChan    chan domain.ServerInfo
+	repo            domain.SyncRepository
+	addrs           map[string]string
+	serverName      string
+	heartbeatPeriod time.Duration
+	electionTimeout time.Duration
+	durability      string
+	ackTimeout      time.Duration
+	sharding        bool
+	gossipPeriod    time.Duration
+	selfAddr        string
+	members         map[string]domain.Member /* every known server including this one and the ones that have left */
+	joining         bool                     /* the server isn't a member yet, it joins the cluster through the known ones */
+	term            uint64
+	votedFor        string
+	role            electionRole
+	leaderName      string
+	deadline        time.Time /* a follower starts an election when it hasn't heard of the leader until the deadline */
+	heardAt         time.Time /* the last time the leader was heard of */
+	heartbeatAt     time.Time
+	quorumAt        time.Time /* the last time the majority answered the leader's heartbeats */
+	log             replicationLog
+	peers           map[string]*peer
+	acks            chan struct{} /* closed and replaced when a reserve acknowledges changes or the role changes */
+	hub             domain.HubUseCase
+	runCtx          context.Context /* the context of Sync, the log is shipped to the peers joining later within it */
+	started         *atomic.Bool
+	snapshot        *snapshot /* the last snapshot the master has taken for bootstrapping reserves */
+	bootstrapping   bool
+	caughtUp        bool          /* the reserve has applied the master's log up to the end */
+	draining        bool          /* the server takes no new games and doesn't run for the master */
+	successor       string        /* the server the master hands its role over to */
+	handedOver      chan struct{} /* closed when the handover ends, the moves are held back until then */
+	snapshotMu      *sync.Mutex
+	applyMu         *sync.Mutex
+	mu              *sync.Mutex
+	infos           *publisher
+	logger          *zap.Logger
 }
 
 const (
-	httpPrefix        = "http://"
-	healthCheckPeriod = 2 * time.Second
+	httpPrefix             = "http://"
+	defaultHeartbeatPeriod = 500 * time.Millisecond
+	defaultElectionTimeout = 2 * time.Second
+	defaultAckTimeout      = 3 * time.Second
 )
 
-func New(repo domain.SyncRepository, cfg []config.ServerConfig,
-	logger *zap.Logger) *useCase {
+const (
+	AsyncDurability  = "async"
+	QuorumDurability = "quorum"
+)
+
+/* the servers of config.Servers are the initial members, a server missing from them joins the cluster through them */
+func New(repo domain.SyncRepository, cfg []config.ServerConfig, electionCfg config.ElectionConfig,
+	replicationCfg config.ReplicationConfig, membershipCfg config.MembershipConfig, logger *zap.Logger) *useCase {
 	addrs := make(map[string]string)
 	serverName := os.Getenv("SERVER_NAME")
 	port := os.Getenv("SERVER_PORT")
 	logger.Info("server name: " + serverName)
+	isMember := false
 	for _, addr := range cfg {
-		if addr.Host != serverName {
-			fullAddr := httpPrefix + addr.Host + port
-			addrs[addr.Host] = fullAddr
+		if addr.Host == serverName {
+			isMember = true
+			continue
 		}
+		addrs[addr.Host] = httpPrefix + addr.Host + port
 	}
 	logger.Info("defined servers", zap.Any("servers", addrs))
-	return &useCase{
-		repo:       repo,
-		addrs:      addrs,
-		serverName: serverName,
-		masterName: atomic.NewString(""),
-		logger:     logger,
-		ticker:     time.NewTicker(healthCheckPeriod),
-		srvChan:    make(chan domain.ServerInfo),
+	selfAddr := httpPrefix + serverName + port
+	u := NewNode(repo, serverName, selfAddr, addrs, electionCfg, replicationCfg, membershipCfg, logger)
+	if !isMember {
+		delete(u.members, serverName)
+		u.joining = true
 	}
+	return u
 }
 
-func (u *useCase) Sync(ctx context.Context, statesChan <-chan map[string]*domain.GameState) {
-	for {
-		select {
-		case v := <-statesChan:
-			if u.serverName != u.masterName.Load() {
-				continue
-			}
-			u.logger.Info("starting sync games states...")
-			for _, addr := range u.addrs {
-				err := u.repo.Sync(ctx, addr, v)
-				if err != nil {
-					u.logger.Warn(err.Error())
-				}
-			}
-		}
+/* NewNode creates the synchronizer of a member of the cluster with explicitly given peers (name -> address) */
+func NewNode(repo domain.SyncRepository, serverName string, selfAddr string, addrs map[string]string,
+	electionCfg config.ElectionConfig, replicationCfg config.ReplicationConfig,
+	membershipCfg config.MembershipConfig, logger *zap.Logger) *useCase {
+	heartbeatPeriod := electionCfg.HeartbeatPeriod
+	if heartbeatPeriod <= 0 {
+		heartbeatPeriod = defaultHeartbeatPeriod
 	}
-}
-
-func (u *useCase) DefineMasterServer(ctx context.Context) {
-	master := u.serverName
-	for host, addr := range u.addrs {
-		res, err := u.repo.HealthCheck(ctx, addr)
-		if err != nil {
-			u.logger.Warn(err.Error())
-			continue
-		}
-		if res.Role == domain.MasterServer {
-			master = host
-			break
-		}
-		master = u.compareMasters(master, host)
+	electionTimeout := electionCfg.ElectionTimeout
+	if electionTimeout <= 0 {
+		electionTimeout = defaultElectionTimeout
 	}
-
-	serverRole := domain.ReserveServer
-	u.masterName.Store(master)
-	if master == u.serverName {
-		serverRole = domain.MasterServer
+	durability := replicationCfg.Durability
+	switch durability {
+	case AsyncDurability, QuorumDurability:
+	case "":
+		durability = AsyncDurability
+	default:
+		logger.Warn("unknown durability mode, falling back to async", zap.String("durability", durability))
+		durability = AsyncDurability
 	}
-
-	u.srvChan <- domain.ServerInfo{
-		ServerRole:       serverRole,
-		MasterServerName: master,
+	ackTimeout := replicationCfg.AckTimeout
+	if ackTimeout <= 0 {
+		ackTimeout = defaultAckTimeout
+	}
+	gossipPeriod := membershipCfg.GossipPeriod
+	if gossipPeriod <= 0 {
+		gossipPeriod = defaultGossipPeriod
+	}
+	peers := make(map[string]*peer, len(addrs))
+	members := make(map[string]domain.Member, len(addrs)+1)
+	for name, addr := range addrs {
+		peers[name] = newPeer(name, addr)
+		members[name] = domain.Member{Name: name, Addr: addr}
+	}
+	members[serverName] = domain.Member{Name: serverName, Addr: selfAddr}
+	return &useCase{
+		repo:            repo,
+		addrs:           maps.Clone(addrs),
+		serverName:      serverName,
+		heartbeatPeriod: heartbeatPeriod,
+		electionTimeout: electionTimeout,
+		durability:      durability,
+		ackTimeout:      ackTimeout,
+		sharding:        replicationCfg.Sharding,
+		gossipPeriod:    gossipPeriod,
+		selfAddr:        selfAddr,
+		members:         members,
+		peers:           peers,
+		acks:            make(chan struct{}),
+		started:         atomic.NewBool(false),
+		snapshotMu:      &sync.Mutex{},
+		applyMu:         &sync.Mutex{},
+		mu:              &sync.Mutex{},
+		infos:           newPublisher(),
+		logger:          logger,
 	}
 }
 
-func (u *useCase) CheckMasterHealth(ctx context.Context) error {
-	for range u.ticker.C {
-		masterName := u.masterName.Load()
-		if masterName == u.serverName {
-			break
-		}
-		u.logger.Info("starting to check master server's health", zap.String("host", masterName))
-
-		masterAddr, ok := u.addrs[masterName]
-		if !ok {
-			return errors.Errorf("undefined master server '%s'", u.masterName)
-		}
-
-		_, err := u.repo.HealthCheck(ctx, masterAddr)
-		if err != nil {
-			u.logger.Warn(err.Error())
-			u.masterName.Store(u.serverName)
-			go u.DefineMasterServer(ctx)
-			break
-		}
-	}
-	return nil
+func (u *useCase) ServerInfoChan() <-chan domain.ServerInfo {
+	return u.infos.out
 }
 
-func (u *useCase) compareMasters(lhs string, rhs string) string {
-	u.logger.Info("compare masters", zap.String("lhs", lhs), zap.String("rhs", rhs))
-	if lhs > rhs {
-		return rhs
-	}
-	return lhs
+func (u *useCase) Epoch() uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.term
 }
 
-func (u *useCase) ServerInfoChan() <-chan domain.ServerInfo {
-	return u.srvChan
+func (u *useCase) isLeader() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.role == leader
 }
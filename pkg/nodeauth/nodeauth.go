@@ -0,0 +1,136 @@
+package nodeauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Requests between the servers are signed with HMAC-SHA256 of a key shared by the cluster.
+ * The signature covers the method, the path with the query, the sending node, the time, a random nonce and the body.
+ * A request older than maxSkew is rejected, and the nonces seen within maxSkew are remembered,
+ * so a captured request can't be replayed either later or right away
+ */
+const (
+	NodeHeader      = "X-Node-Name"
+	TimestampHeader = "X-Node-Timestamp"
+	NonceHeader     = "X-Node-Nonce"
+	SignatureHeader = "X-Node-Signature"
+)
+
+var (
+	ErrNotSigned    = errors.New("the request isn't signed")
+	ErrBadTimestamp = errors.New("the request timestamp is malformed or out of the allowed skew")
+	ErrBadSignature = errors.New("the request signature doesn't match")
+	ErrReplayed     = errors.New("the request has already been received")
+)
+
+const (
+	defaultMaxSkew = 30 * time.Second
+	nonceSize      = 16
+)
+
+type Authenticator struct {
+	key      []byte
+	node     string
+	maxSkew  time.Duration
+	seen     map[string]time.Time /* the nonces of the verified requests until their timestamps are out of the skew */
+	prunedAt time.Time
+	mu       *sync.Mutex
+}
+
+/* New returns nil for an empty key, a nil authenticator signs nothing and accepts everything */
+func New(key string, node string, maxSkew time.Duration) *Authenticator {
+	if key == "" {
+		return nil
+	}
+	if maxSkew <= 0 {
+		maxSkew = defaultMaxSkew
+	}
+	return &Authenticator{
+		key:     []byte(key),
+		node:    node,
+		maxSkew: maxSkew,
+		seen:    make(map[string]time.Time),
+		mu:      &sync.Mutex{},
+	}
+}
+
+func (a *Authenticator) Enabled() bool {
+	return a != nil
+}
+
+func (a *Authenticator) Sign(req *http.Request, body []byte) {
+	if a == nil {
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := make([]byte, nonceSize)
+	_, _ = rand.Read(nonce)
+	req.Header.Set(NodeHeader, a.node)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(NonceHeader, hex.EncodeToString(nonce))
+	req.Header.Set(SignatureHeader,
+		a.signature(req.Method, req.URL.RequestURI(), a.node, timestamp, req.Header.Get(NonceHeader), body))
+}
+
+func (a *Authenticator) Verify(req *http.Request, body []byte) error {
+	if a == nil {
+		return nil
+	}
+	node, timestamp, nonce, signature := req.Header.Get(NodeHeader), req.Header.Get(TimestampHeader),
+		req.Header.Get(NonceHeader), req.Header.Get(SignatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return ErrNotSigned
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadTimestamp
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return ErrBadTimestamp
+	}
+	expected := a.signature(req.Method, req.URL.RequestURI(), node, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrBadSignature
+	}
+	return a.remember(node+"/"+nonce, time.Unix(unix, 0).Add(a.maxSkew))
+}
+
+/* remember rejects a nonce seen before, the ones whose requests would be rejected by the skew anyway are forgotten */
+func (a *Authenticator) remember(nonce string, expiresAt time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if now := time.Now(); now.Sub(a.prunedAt) >= time.Second {
+		for v, at := range a.seen {
+			if now.After(at) {
+				delete(a.seen, v)
+			}
+		}
+		a.prunedAt = now
+	}
+	if _, ok := a.seen[nonce]; ok {
+		return ErrReplayed
+	}
+	a.seen[nonce] = expiresAt
+	return nil
+}
+
+func (a *Authenticator) signature(method string, uri string, node string, timestamp string, nonce string,
+	body []byte) string {
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, a.key)
+	for _, part := range []string{method, uri, node, timestamp, nonce, hex.EncodeToString(bodySum[:])} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
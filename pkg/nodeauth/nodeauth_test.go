@@ -0,0 +1,169 @@
+package nodeauth
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const testKey = "cluster-key"
+
+func signedRequest(a *Authenticator, target string, body string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, target, nil)
+	a.Sign(req, []byte(body))
+	return req
+}
+
+/* resign moves the request to the time and signs it again, as a node with a skewed clock would */
+func resign(a *Authenticator, req *http.Request, at time.Time, body string) {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, a.signature(req.Method, req.URL.RequestURI(), req.Header.Get(NodeHeader),
+		timestamp, req.Header.Get(NonceHeader), []byte(body)))
+}
+
+/* TestVerify checks that a request passes only as it was signed, by the key of the cluster and in time */
+func TestVerify(t *testing.T) {
+	const body = `{"code":"abc"}`
+	tests := []struct {
+		name    string
+		tamper  func(req *http.Request) []byte
+		wantErr error
+	}{
+		{
+			name: "as signed",
+			tamper: func(*http.Request) []byte {
+				return []byte(body)
+			},
+		},
+		{
+			name: "body",
+			tamper: func(*http.Request) []byte {
+				return []byte(`{"code":"abd"}`)
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "path",
+			tamper: func(req *http.Request) []byte {
+				req.URL.Path = "/internal/rooms/other"
+				return []byte(body)
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "query",
+			tamper: func(req *http.Request) []byte {
+				req.URL.RawQuery = "code=other"
+				return []byte(body)
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "method",
+			tamper: func(req *http.Request) []byte {
+				req.Method = http.MethodDelete
+				return []byte(body)
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "node",
+			tamper: func(req *http.Request) []byte {
+				req.Header.Set(NodeHeader, "node-3")
+				return []byte(body)
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "another key",
+			tamper: func(req *http.Request) []byte {
+				New("another-key", "node-1", 0).Sign(req, []byte(body))
+				return []byte(body)
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "not signed",
+			tamper: func(req *http.Request) []byte {
+				req.Header.Del(SignatureHeader)
+				return []byte(body)
+			},
+			wantErr: ErrNotSigned,
+		},
+		{
+			name: "malformed timestamp",
+			tamper: func(req *http.Request) []byte {
+				req.Header.Set(TimestampHeader, "yesterday")
+				return []byte(body)
+			},
+			wantErr: ErrBadTimestamp,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(testKey, "node-1", 0)
+			req := signedRequest(a, "http://node-2/internal/rooms?code=abc", body)
+			received := tt.tamper(req)
+			if err := New(testKey, "node-2", 0).Verify(req, received); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verify: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySkew(t *testing.T) {
+	const maxSkew = time.Minute
+	tests := []struct {
+		name    string
+		shift   time.Duration
+		wantErr error
+	}{
+		{name: "slightly behind", shift: -maxSkew / 2},
+		{name: "slightly ahead", shift: maxSkew / 2},
+		{name: "too old", shift: -2 * maxSkew, wantErr: ErrBadTimestamp},
+		{name: "from the future", shift: 2 * maxSkew, wantErr: ErrBadTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(testKey, "node-1", maxSkew)
+			req := signedRequest(a, "http://node-2/internal/forward", "")
+			resign(a, req, time.Now().Add(tt.shift), "")
+			if err := a.Verify(req, nil); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verify: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	a := New(testKey, "node-1", 0)
+	req := signedRequest(a, "http://node-2/internal/forward", "move")
+	if err := a.Verify(req, []byte("move")); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := a.Verify(req, []byte("move")); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("verify the replay: got %v, want %v", err, ErrReplayed)
+	}
+	if err := a.Verify(signedRequest(a, "http://node-2/internal/forward", "move"), []byte("move")); err != nil {
+		t.Fatalf("verify the same request with a new nonce: %v", err)
+	}
+}
+
+/* TestDisabled checks that without a key nothing is signed and everything is accepted */
+func TestDisabled(t *testing.T) {
+	a := New("", "node-1", 0)
+	if a.Enabled() {
+		t.Fatalf("the authenticator without a key is enabled")
+	}
+	req := signedRequest(a, "http://node-2/internal/forward", "")
+	if req.Header.Get(SignatureHeader) != "" {
+		t.Fatalf("the request is signed without a key")
+	}
+	if err := a.Verify(req, nil); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+}
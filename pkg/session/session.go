@@ -0,0 +1,94 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+)
+
+/*
+ * A session token is "<claims>.<signature>": the base64 of the account id with the expiry time
+ * and the base64 of their HMAC-SHA256 under a key shared by the cluster,
+ * so any server checks the token itself and the players keep their sessions after failover
+ */
+var (
+	ErrMalformedToken = errors.New("the session token is malformed")
+	ErrBadSignature   = errors.New("the session token signature doesn't match")
+	ErrExpired        = errors.New("the session token has expired")
+)
+
+const defaultTTL = 24 * time.Hour
+
+var encoding = base64.RawURLEncoding
+
+type claims struct {
+	Sub string `json:"sub"`
+	Exp int64  `json:"exp"`
+}
+
+type Issuer struct {
+	key []byte
+	ttl time.Duration
+}
+
+/* New returns nil for an empty key, the server refuses to start without it */
+func New(key string, ttl time.Duration) *Issuer {
+	if key == "" {
+		return nil
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &Issuer{
+		key: []byte(key),
+		ttl: ttl,
+	}
+}
+
+func (i *Issuer) Issue(accountId string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(i.ttl)
+	data, err := jsoniter.Marshal(claims{Sub: accountId, Exp: expiresAt.Unix()})
+	if err != nil {
+		return "", time.Time{}, errors.WithMessage(err, "marshal session claims")
+	}
+	payload := encoding.EncodeToString(data)
+	return payload + "." + encoding.EncodeToString(i.signature(payload)), expiresAt, nil
+}
+
+/* Verify returns the account id of a valid token */
+func (i *Issuer) Verify(token string) (string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrMalformedToken
+	}
+	mac, err := encoding.DecodeString(signature)
+	if err != nil {
+		return "", ErrMalformedToken
+	}
+	if !hmac.Equal(mac, i.signature(payload)) {
+		return "", ErrBadSignature
+	}
+	data, err := encoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrMalformedToken
+	}
+	c := claims{}
+	if err := jsoniter.Unmarshal(data, &c); err != nil || c.Sub == "" {
+		return "", ErrMalformedToken
+	}
+	if time.Now().After(time.Unix(c.Exp, 0)) {
+		return "", ErrExpired
+	}
+	return c.Sub, nil
+}
+
+func (i *Issuer) signature(payload string) []byte {
+	mac := hmac.New(sha256.New, i.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const testKey = "cluster-key"
+
+/* signed signs the payload as is, to check what a valid signature over bad claims gives */
+func signed(i *Issuer, payload string) string {
+	return payload + "." + encoding.EncodeToString(i.signature(payload))
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	i := New(testKey, time.Hour)
+	token, expiresAt, err := i.Issue("account-1")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if until := time.Until(expiresAt); until <= 59*time.Minute || until > time.Hour {
+		t.Fatalf("the token expires in %v, want an hour", until)
+	}
+	accountId, err := i.Verify(token)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if accountId != "account-1" {
+		t.Fatalf("got account '%s', want 'account-1'", accountId)
+	}
+	if _, err := New(testKey, 0).Verify(token); err != nil {
+		t.Fatalf("verify by another server of the cluster: %v", err)
+	}
+}
+
+/* TestVerifyRejects checks that a token is accepted only unchanged, under the cluster key and before it expires */
+func TestVerifyRejects(t *testing.T) {
+	i := New(testKey, time.Hour)
+	token, _, err := i.Issue("account-1")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	expired, _, err := (&Issuer{key: []byte(testKey), ttl: -time.Minute}).Issue("account-1")
+	if err != nil {
+		t.Fatalf("issue expired: %v", err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+	forged, _, err := New(testKey, time.Hour).Issue("account-2")
+	if err != nil {
+		t.Fatalf("issue forged: %v", err)
+	}
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "expired", token: expired, wantErr: ErrExpired},
+		{name: "another key", token: signed(New("another-key", 0), payload), wantErr: ErrBadSignature},
+		{name: "another account", token: forgedPayload + "." + signature, wantErr: ErrBadSignature},
+		{name: "no signature", token: payload, wantErr: ErrMalformedToken},
+		{name: "signature isn't base64", token: payload + ".!!!", wantErr: ErrMalformedToken},
+		{name: "claims aren't json", token: signed(i, encoding.EncodeToString([]byte("account-1"))),
+			wantErr: ErrMalformedToken},
+		{name: "no account", token: signed(i, encoding.EncodeToString([]byte(`{"exp":9999999999}`))),
+			wantErr: ErrMalformedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := i.Verify(tt.token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verify: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewWithoutKey(t *testing.T) {
+	if New("", time.Hour) != nil {
+		t.Fatalf("got an issuer without a key")
+	}
+}